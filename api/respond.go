@@ -2,6 +2,7 @@ package api
 
 import (
 	"aging-api/responses"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,3 +10,10 @@ import (
 func Respond(c *gin.Context, Status int, Message string, Data interface{}) {
 	c.JSON(Status, responses.Response{Status: Status, Message: Message, Data: map[string]interface{}{"data": Data}})
 }
+
+// RespondPage sends one page of a listing. The documents are the data, as
+// with Respond, alongside how many matched in all and the cursor to pass for
+// the next page, which is empty on the last one.
+func RespondPage(c *gin.Context, Items interface{}, Total int, NextCursor string) {
+	c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": Items, "total": Total, "nextCursor": NextCursor}})
+}
@@ -1,39 +1,1811 @@
 package main
 
 import (
+	"aging-api/auth"
+	"aging-api/mail"
+	"aging-api/models"
+	"aging-api/retention"
+	"aging-api/search"
+	"aging-api/store"
+	"aging-api/store/memstore"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"math"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var testStore = memstore.New()
+
+var testMail = &outbox{}
+
+var router = func() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	return setupRouter(testStore, testMail)
+}()
+
+// outbox keeps the mail the API sends so tests can read tokens out of it.
+type outbox struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (o *outbox) Send(ctx context.Context, message mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, message)
+	return nil
+}
+
+// lastToken is the token in the latest mail to an address.
+func (o *outbox) lastToken(to string) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To == to {
+			return strings.Split(o.messages[i].Body, "\n\n")[1]
+		}
+	}
+	return ""
+}
+
+// signUp creates a user and verifies their email address.
+func signUp(t *testing.T, email string, password string) string {
+	response := request(http.MethodPost, "/api/v1/users", map[string]string{"email": email, "password": password})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Sign up: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	verify := request(http.MethodPost, "/api/v1/email/verify", map[string]string{"token": testMail.lastToken(email)})
+	if verify.Code != http.StatusOK {
+		t.Fatalf("Verify email: response: %v, body: %v", verify.Code, verify.Body.String())
+	}
+	return createdId(response)
+}
+
+// adminToken is sent with every request made through request.
+var adminToken = tokenFor(models.RoleAdmin)
+
+// testOrganisation is the distillery users made by tokenFor belong to.
+var testOrganisation = func() models.Organisation {
+	organisation := models.Organisation{Name: "Test Distillery"}
+	if err := testStore.Organisations.Create(context.Background(), &organisation); err != nil {
+		panic(err)
+	}
+	return organisation
+}()
+
+func tokenFor(role string) string {
+	return tokenAs(role+"@test.test", role, &testOrganisation.Id)
+}
+
+// tokenAs creates a user, a member of organisationId unless it is nil, and
+// returns an access token for them.
+func tokenAs(email string, role string, organisationId *primitive.ObjectID) string {
+	user := models.User{Email: email, Password: "x", Role: role}
+	if err := testStore.Users.Create(context.Background(), &user); err != nil {
+		panic(err)
+	}
+	if organisationId != nil {
+		membership := models.Membership{OrganisationId: *organisationId, UserId: user.Id}
+		if err := testStore.Memberships.Create(context.Background(), &membership); err != nil {
+			panic(err)
+		}
+	}
+	session := models.Session{UserId: user.Id, TokenHash: email, ExpiresAt: primitive.NewDateTimeFromTime(time.Now().Add(time.Hour))}
+	if err := testStore.Sessions.Create(context.Background(), &session); err != nil {
+		panic(err)
+	}
+	token, err := auth.CreateJWT(user.Id.Hex(), session.Id.Hex())
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+func request(method string, path string, body interface{}) *httptest.ResponseRecorder {
+	return requestAs(adminToken, method, path, body)
+}
+
+func requestAs(token string, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	return requestIn(token, "", method, path, body)
+}
+
+// requestIn names the organisation the request is for.
+func requestIn(token string, organisationId string, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	postData, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(postData))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if organisationId != "" {
+		req.Header.Set(auth.OrganisationHeader, organisationId)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, req)
+	return response
+}
+
+func createdId(response *httptest.ResponseRecorder) string {
+	var created struct {
+		Data struct {
+			Data string `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &created)
+	return created.Data.Data
+}
+
 func TestCreateUser(t *testing.T) {
-	postData, _ := json.Marshal(map[string]string{
+	response := request(http.MethodPost, "/api/v1/users", map[string]string{
 		"email":    "test@test.test",
 		"password": "123456",
 	})
-	body := bytes.NewBuffer(postData)
-	response, err := http.Post("http://localhost:6000/user", "application/json", body)
-	if response.Status != "201 Created" {
-		t.Errorf("Create User: response: %v, want: %v, error: %v", response.Status, "201 Created", err)
+	if response.Code != http.StatusCreated {
+		t.Errorf("Create User: response: %v, want: %v, body: %v", response.Code, http.StatusCreated, response.Body.String())
+	}
+
+	response = request(http.MethodPost, "/api/v1/users", map[string]string{
+		"email":    "test@test.test",
+		"password": "abcdef",
+	})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Create duplicate User: response: %v, want: %v", response.Code, http.StatusBadRequest)
 	}
 }
 
 func TestLogin(t *testing.T) {
-	postData, _ := json.Marshal(map[string]string{
-		"email":    "test@test.test",
+	signUp(t, "login@test.test", "123456")
+
+	response := request(http.MethodPost, "/api/v1/login", map[string]string{
+		"email":    "login@test.test",
 		"password": "123456",
 	})
-	body := bytes.NewBuffer(postData)
-	response, err := http.Post("http://localhost:6000/login", "application/json", body)
-	if err != nil {
-		t.Errorf("Login: error: %v", err)
-	}
-	defer response.Body.Close()
 	responseBody, _ := io.ReadAll(response.Body)
-	want := "200 OK"
-	if response.Status != want {
-		t.Errorf("Login User: response: %v, want: %v, error: %v", response.Status, want, (string)(responseBody))
+	want := http.StatusOK
+	if response.Code != want {
+		t.Errorf("Login User: response: %v, want: %v, error: %v", response.Code, want, (string)(responseBody))
+	}
+}
+
+func TestSpiritLifecycle(t *testing.T) {
+	response := request(http.MethodPost, "/api/v1/spirits", map[string]interface{}{
+		"name":       "Rye",
+		"volume":     200,
+		"initialABV": 63.5,
+	})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Create Spirit: response: %v, want: %v, body: %v", response.Code, http.StatusCreated, response.Body.String())
+	}
+
+	path := "/api/v1/spirits/" + createdId(response)
+
+	response = request(http.MethodPut, path, map[string]interface{}{
+		"name":       "Rye",
+		"volume":     180,
+		"initialABV": 63.5,
+	})
+	if response.Code != http.StatusOK {
+		t.Errorf("Update Spirit: response: %v, want: %v, body: %v", response.Code, http.StatusOK, response.Body.String())
+	}
+
+	if response = request(http.MethodDelete, path, nil); response.Code != http.StatusOK {
+		t.Errorf("Delete Spirit: response: %v, want: %v", response.Code, http.StatusOK)
+	}
+
+	if response = request(http.MethodGet, path, nil); response.Code != http.StatusNotFound {
+		t.Errorf("Get deleted Spirit: response: %v, want: %v", response.Code, http.StatusNotFound)
+	}
+}
+
+func TestBatchReferences(t *testing.T) {
+	response := request(http.MethodPost, "/api/v1/batches", map[string]interface{}{
+		"volume":         190,
+		"measurementIds": []string{"62e0f1c3a2b4c5d6e7f80910"},
+	})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Create Batch with missing measurement: response: %v, want: %v", response.Code, http.StatusBadRequest)
+	}
+
+	response = request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{
+		"volume":   200,
+		"material": "American Oak",
+		"process":  "Charred",
+	})
+	vesselId := createdId(response)
+
+	response = request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 190})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Create Batch: response: %v, want: %v, body: %v", response.Code, http.StatusCreated, response.Body.String())
+	}
+	batchId := createdId(response)
+	request(http.MethodPost, "/api/v1/batches/"+batchId+"/fill", map[string]interface{}{"vesselId": vesselId, "volume": 190})
+
+	var batch struct {
+		Data struct {
+			Data models.Batch `json:"data"`
+		} `json:"data"`
+	}
+	response = request(http.MethodGet, "/api/v1/batches/"+batchId+"?expand=vessels", nil)
+	json.Unmarshal(response.Body.Bytes(), &batch)
+	if len(batch.Data.Data.Vessels) != 1 || batch.Data.Data.Vessels[0].Material != "American Oak" {
+		t.Errorf("Get Batch expanded: vessels: %+v", batch.Data.Data.Vessels)
+	}
+
+	var vessel struct {
+		Data struct {
+			Data models.Vessel `json:"data"`
+		} `json:"data"`
+	}
+	response = request(http.MethodGet, "/api/v1/vessels/"+vesselId, nil)
+	json.Unmarshal(response.Body.Bytes(), &vessel)
+	if len(vessel.Data.Data.BatchIds) != 1 || vessel.Data.Data.BatchIds[0].Hex() != batchId {
+		t.Errorf("Get Vessel: batchIds: %v, want: [%v]", vessel.Data.Data.BatchIds, batchId)
+	}
+
+	response = request(http.MethodPut, "/api/v1/batches/"+batchId, map[string]interface{}{"volume": 185, "vesselIds": []string{}})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Update Batch vessels: response: %v, want: %v", response.Code, http.StatusBadRequest)
+	}
+	response = request(http.MethodPut, "/api/v1/batches/"+batchId, map[string]interface{}{"volume": 185, "vesselIds": []string{vesselId}})
+	if response.Code != http.StatusOK {
+		t.Errorf("Update Batch with its own vessels: response: %v, want: %v, body: %v", response.Code, http.StatusOK, response.Body.String())
+	}
+}
+
+func TestBatchLifecycle(t *testing.T) {
+	first := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{
+		"volume": 200, "material": "French Oak", "process": "Toasted",
+	}))
+	second := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{
+		"volume": 250, "material": "Stainless",
+	}))
+	third := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{
+		"volume": 100, "material": "Glass",
+	}))
+	if response := request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 300, "vesselIds": []string{first}}); response.Code != http.StatusBadRequest {
+		t.Errorf("Create Batch straight into a vessel: response: %v, want: %v", response.Code, http.StatusBadRequest)
+	}
+	batchPath := "/api/v1/batches/" + createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{
+		"volume": 300,
+	}))
+
+	steps := []struct {
+		path string
+		body map[string]interface{}
+		want int
+	}{
+		{"/fill", map[string]interface{}{"vesselId": first, "volume": 200}, http.StatusCreated},
+		{"/fill", map[string]interface{}{"vesselId": first, "volume": 10}, http.StatusBadRequest},
+		{"/fill", map[string]interface{}{"vesselId": second, "volume": 150}, http.StatusBadRequest},
+		{"/transfer", map[string]interface{}{"fromVesselId": first, "toVesselId": second, "volume": 150}, http.StatusCreated},
+		{"/transfer", map[string]interface{}{"fromVesselId": first, "toVesselId": second, "volume": 60}, http.StatusBadRequest},
+		{"/dump", map[string]interface{}{"vesselId": second}, http.StatusCreated},
+		{"/fill", map[string]interface{}{"vesselId": second, "volume": 10}, http.StatusBadRequest},
+		{"/transfer", map[string]interface{}{"fromVesselId": first, "toVesselId": third, "volume": 50}, http.StatusCreated},
+		{"/fill", map[string]interface{}{"vesselId": first, "volume": 50}, http.StatusCreated},
+	}
+	for _, step := range steps {
+		if response := request(http.MethodPost, batchPath+step.path, step.body); response.Code != step.want {
+			t.Errorf("POST %v %v: response: %v, want: %v, body: %v", step.path, step.body, response.Code, step.want, response.Body.String())
+		}
+	}
+
+	var timeline struct {
+		Data struct {
+			Data []models.Movement `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, batchPath+"/timeline", nil).Body.Bytes(), &timeline)
+	if len(timeline.Data.Data) != 5 || timeline.Data.Data[2].Type != models.MovementDump || timeline.Data.Data[2].Volume != 150 {
+		t.Errorf("Batch timeline: got: %+v", timeline.Data.Data)
+	}
+
+	json.Unmarshal(request(http.MethodGet, "/api/v1/vessels/"+second+"/timeline", nil).Body.Bytes(), &timeline)
+	if len(timeline.Data.Data) != 2 {
+		t.Errorf("Vessel timeline: got: %+v", timeline.Data.Data)
+	}
+
+	fourth := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{
+		"volume": 100, "material": "Glass",
+	}))
+	broken := *testStore
+	broken.Batches = unwritableBatches{testStore.Batches}
+	body, _ := json.Marshal(map[string]interface{}{"vesselId": fourth, "volume": 50})
+	req := httptest.NewRequest(http.MethodPost, batchPath+"/fill", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	response := httptest.NewRecorder()
+	setupRouter(&broken, testMail).ServeHTTP(response, req)
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("Fill that fails part way: response: %v, want: %v", response.Code, http.StatusInternalServerError)
+	}
+	var vessel struct {
+		Data struct {
+			Data models.Vessel `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/vessels/"+fourth, nil).Body.Bytes(), &vessel)
+	timeline.Data.Data = nil
+	json.Unmarshal(request(http.MethodGet, "/api/v1/vessels/"+fourth+"/timeline", nil).Body.Bytes(), &timeline)
+	if vessel.Data.Data.FillLevel != 0 || vessel.Data.Data.CurrentStatus() != models.VesselEmpty || len(timeline.Data.Data) != 0 {
+		t.Errorf("Vessel after a failed fill: fill level: %v, timeline: %+v", vessel.Data.Data.FillLevel, timeline.Data.Data)
+	}
+}
+
+// unwritableBatches fails every batch update, to break a write part way.
+type unwritableBatches struct {
+	store.BatchRepository
+}
+
+func (unwritableBatches) Update(ctx context.Context, batch *models.Batch) error {
+	return errors.New("batches are read-only")
+}
+
+func TestVesselOccupancy(t *testing.T) {
+	small := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{
+		"volume": 100, "material": "Glass",
+	}))
+	large := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{
+		"volume": 1000, "material": "Glass",
+	}))
+	batchPath := "/api/v1/batches/" + createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{
+		"volume": 100,
+	}))
+	request(http.MethodPost, batchPath+"/fill", map[string]interface{}{"vesselId": small, "volume": 100})
+
+	var vessels struct {
+		Data struct {
+			Data []models.Vessel `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/vessels?status=empty&minCapacity=500", nil).Body.Bytes(), &vessels)
+	found := false
+	for _, vessel := range vessels.Data.Data {
+		if vessel.Status != models.VesselEmpty || vessel.Volume < 500 {
+			t.Errorf("List Vessels: unexpected vessel: %+v", vessel)
+		}
+		found = found || vessel.Id.Hex() == large
+	}
+	if !found {
+		t.Errorf("List Vessels: missing vessel %v", large)
+	}
+
+	statusPath := "/api/v1/vessels/" + small + "/status"
+	steps := []struct {
+		status string
+		want   int
+	}{
+		{models.VesselRetired, http.StatusBadRequest},
+		{models.VesselResting, http.StatusOK},
+		{models.VesselDumped, http.StatusBadRequest},
+	}
+	for _, step := range steps {
+		if response := request(http.MethodPost, statusPath, map[string]string{"status": step.status}); response.Code != step.want {
+			t.Errorf("Set status %v: response: %v, want: %v, body: %v", step.status, response.Code, step.want, response.Body.String())
+		}
+	}
+
+	request(http.MethodPost, batchPath+"/dump", map[string]interface{}{"vesselId": small})
+	for _, status := range []string{models.VesselEmpty, models.VesselRetired} {
+		if response := request(http.MethodPost, statusPath, map[string]string{"status": status}); response.Code != http.StatusOK {
+			t.Errorf("Set status %v: response: %v, body: %v", status, response.Code, response.Body.String())
+		}
+	}
+}
+
+func TestCaskHistory(t *testing.T) {
+	vessel := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{
+		"volume": 200, "material": "American Oak", "process": "Toasted",
+	}))
+	first := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	second := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	request(http.MethodPost, "/api/v1/spirits", map[string]interface{}{
+		"name": "Cask Rye", "volume": 200, "initialABV": 62, "batchIds": []string{first},
+	})
+
+	request(http.MethodPost, "/api/v1/batches/"+first+"/fill", map[string]interface{}{"vesselId": vessel, "volume": 200})
+	request(http.MethodPost, "/api/v1/batches/"+first+"/dump", map[string]interface{}{"vesselId": vessel})
+
+	treatment := map[string]interface{}{"process": "Charred", "notes": "level 3 char"}
+	if response := request(http.MethodPost, "/api/v1/vessels/"+vessel+"/treatments", treatment); response.Code != http.StatusCreated {
+		t.Errorf("Add treatment: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	request(http.MethodPost, "/api/v1/vessels/"+vessel+"/status", map[string]string{"status": models.VesselEmpty})
+	request(http.MethodPost, "/api/v1/batches/"+second+"/fill", map[string]interface{}{"vesselId": vessel, "volume": 150})
+
+	var vessels struct {
+		Data struct {
+			Data []models.Vessel `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/vessels?fillNumber=2&priorContents=cask%20rye", nil).Body.Bytes(), &vessels)
+	if len(vessels.Data.Data) != 1 || vessels.Data.Data[0].Id.Hex() != vessel {
+		t.Fatalf("List Vessels: got: %+v", vessels.Data.Data)
+	}
+	found := vessels.Data.Data[0]
+	if found.Process != "Charred" || len(found.Treatments) != 1 {
+		t.Errorf("Vessel treatments: process: %v, treatments: %+v", found.Process, found.Treatments)
+	}
+}
+
+func TestAngelsShare(t *testing.T) {
+	vessel := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{
+		"volume": 200, "material": "American Oak", "process": "Charred", "location": "Warehouse 7",
+	}))
+	batch := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	request(http.MethodPost, "/api/v1/spirits", map[string]interface{}{
+		"name": "Warehouse Malt", "volume": 200, "initialABV": 62, "batchIds": []string{batch},
+	})
+
+	filled := time.Now().AddDate(-2, 0, 0).UTC().Format(time.RFC3339)
+	request(http.MethodPost, "/api/v1/batches/"+batch+"/fill", map[string]interface{}{"vesselId": vessel, "volume": 200, "date": filled})
+	response := request(http.MethodPost, "/api/v1/measurements", map[string]interface{}{
+		"batchId": batch, "vesselId": vessel, "volume": 180, "abv": 60, "image": "dip.jpg",
+	})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Create Measurement: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	// A dip recorded against the vessel alone still counts for the batch,
+	// and one from before the batch went in counts for neither.
+	request(http.MethodPost, "/api/v1/measurements", map[string]interface{}{
+		"vesselId": vessel, "volume": 178, "abv": 60, "image": "dip2.jpg", "date": time.Now().Add(time.Minute).UTC().Format(time.RFC3339),
+	})
+	request(http.MethodPost, "/api/v1/measurements", map[string]interface{}{
+		"vesselId": vessel, "volume": 40, "abv": 50, "image": "old.jpg", "date": time.Now().AddDate(-3, 0, 0).UTC().Format(time.RFC3339),
+	})
+
+	var loss struct {
+		Data struct {
+			Data struct {
+				VolumeLoss              float64 `json:"volumeLoss"`
+				AnnualVolumeLossPercent float64 `json:"annualVolumeLossPercent"`
+				Vessels                 []struct {
+					VesselId    string  `json:"vesselId"`
+					VolumeLoss  float64 `json:"volumeLoss"`
+					AlcoholLoss float64 `json:"alcoholLoss"`
+				} `json:"vessels"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/batches/"+batch+"/loss", nil).Body.Bytes(), &loss)
+	got := loss.Data.Data
+	if math.Abs(got.VolumeLoss-22) > 0.01 || math.Abs(got.AnnualVolumeLossPercent-5.66) > 0.05 || len(got.Vessels) != 1 {
+		t.Fatalf("Batch loss: got: %+v", got)
+	}
+
+	var vesselLoss struct {
+		Data struct {
+			Data struct {
+				VolumeLoss  float64 `json:"volumeLoss"`
+				AlcoholLoss float64 `json:"alcoholLoss"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/vessels/"+vessel+"/loss", nil).Body.Bytes(), &vesselLoss)
+	if vesselLoss.Data.Data.VolumeLoss != got.Vessels[0].VolumeLoss || vesselLoss.Data.Data.AlcoholLoss != got.Vessels[0].AlcoholLoss {
+		t.Errorf("Vessel loss %+v differs from batch loss in the vessel %+v", vesselLoss.Data.Data, got.Vessels[0])
+	}
+
+	var groups struct {
+		Data struct {
+			Data []struct {
+				Group      string  `json:"group"`
+				VolumeLoss float64 `json:"volumeLoss"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/reports/loss?groupBy=location", nil).Body.Bytes(), &groups)
+	found := false
+	for _, group := range groups.Data.Data {
+		if group.Group == "Warehouse 7" {
+			found = math.Abs(group.VolumeLoss-22) < 0.01
+		}
+	}
+	if !found {
+		t.Errorf("Loss report: got: %+v", groups.Data.Data)
+	}
+}
+
+func TestAlcoholContent(t *testing.T) {
+	batch := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	request(http.MethodPost, "/api/v1/spirits", map[string]interface{}{
+		"name": "Proof Bourbon", "volume": 200, "initialABV": 62, "batchIds": []string{batch},
+	})
+
+	var found struct {
+		Data struct {
+			Data models.Batch `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/batches/"+batch+"?units=proofGallons", nil).Body.Bytes(), &found)
+	if alcohol := found.Data.Data.Alcohol; alcohol == nil || math.Abs(alcohol.Volume-65.51) > 0.01 || math.Abs(alcohol.LAA-124) > 0.01 {
+		t.Errorf("Batch alcohol at initial ABV: got: %+v", alcohol)
+	}
+
+	request(http.MethodPost, "/api/v1/measurements", map[string]interface{}{"batchId": batch, "abv": 60, "image": "hydrometer.jpg"})
+	json.Unmarshal(request(http.MethodGet, "/api/v1/batches/"+batch, nil).Body.Bytes(), &found)
+	if alcohol := found.Data.Data.Alcohol; alcohol == nil || alcohol.Unit != "litres" || math.Abs(alcohol.LAA-120) > 0.01 {
+		t.Errorf("Batch alcohol at measured ABV: got: %+v", alcohol)
+	}
+
+	if response := request(http.MethodGet, "/api/v1/batches/"+batch+"?units=hogsheads", nil); response.Code != http.StatusBadRequest {
+		t.Errorf("Unknown units: response: %v", response.Code)
+	}
+}
+
+func TestTemperatureCorrectedABV(t *testing.T) {
+	reading := map[string]interface{}{"apparentABV": 40, "temperature": 25, "image": "hydrometer.jpg"}
+	id := createdId(request(http.MethodPost, "/api/v1/measurements", reading))
+
+	var found struct {
+		Data struct {
+			Data models.Measurement `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/measurements/"+id, nil).Body.Bytes(), &found)
+	measurement := found.Data.Data
+	if math.Abs(float64(measurement.ABV)-38.0) > 0.05 || measurement.ApparentABV != 40 || measurement.Temperature == nil {
+		t.Errorf("Corrected ABV: got: %+v", measurement)
+	}
+
+	delete(reading, "temperature")
+	if response := request(http.MethodPost, "/api/v1/measurements", reading); response.Code != http.StatusBadRequest {
+		t.Errorf("Apparent ABV without temperature: response: %v", response.Code)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	taster := tokenFor(models.RoleTaster)
+
+	if response := requestAs("", http.MethodGet, "/api/v1/spirits", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("Without token: response: %v", response.Code)
+	}
+	if response := requestAs("not-a-token", http.MethodGet, "/api/v1/spirits", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("Invalid token: response: %v", response.Code)
+	}
+	if response := requestAs(taster, http.MethodGet, "/api/v1/vessels", nil); response.Code != http.StatusOK {
+		t.Errorf("Taster reads vessels: response: %v", response.Code)
+	}
+	if response := requestAs(taster, http.MethodPost, "/api/v1/vessels", map[string]interface{}{"volume": 200}); response.Code != http.StatusForbidden {
+		t.Errorf("Taster creates vessel: response: %v", response.Code)
+	}
+	if response := requestAs(taster, http.MethodGet, "/api/v1/users", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Taster lists users: response: %v", response.Code)
+	}
+
+	user := createdId(request(http.MethodPost, "/api/v1/users", map[string]string{"email": "cellar@test.test", "password": "pass1234"}))
+	response := request(http.MethodPut, "/api/v1/users/"+user+"/role", map[string]string{"role": models.RoleCellarMaster})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Set role: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodPut, "/api/v1/users/"+user+"/role", map[string]string{"role": "owner"}); response.Code != http.StatusBadRequest {
+		t.Errorf("Set unknown role: response: %v", response.Code)
+	}
+	if response := requestAs(taster, http.MethodPut, "/api/v1/users/"+user+"/role", map[string]string{"role": models.RoleAdmin}); response.Code != http.StatusForbidden {
+		t.Errorf("Taster sets role: response: %v", response.Code)
+	}
+}
+
+func TestMe(t *testing.T) {
+	var me struct {
+		Data struct {
+			Data models.User `json:"data"`
+		} `json:"data"`
+	}
+	response := request(http.MethodGet, "/api/v1/me", nil)
+	json.Unmarshal(response.Body.Bytes(), &me)
+	if response.Code != http.StatusOK || me.Data.Data.Email != "admin@test.test" || me.Data.Data.Password != "" {
+		t.Errorf("Me: response: %v, body: %v", response.Code, response.Body.String())
+	}
+
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": me.Data.Data.Id.Hex(),
+		"sid":    primitive.NewObjectID().Hex(),
+		"exp":    time.Now().Add(-time.Minute).Unix(),
+	}).SignedString([]byte(os.Getenv("SESSION_SECRET")))
+	if response := requestAs(expired, http.MethodGet, "/api/v1/me", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("Me with expired token: response: %v", response.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	req.Header.Set("Authorization", adminToken)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, req)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Me without Bearer prefix: response: %v", response.Code)
+	}
+}
+
+func login(t *testing.T, email string) (string, string) {
+	var tokens struct {
+		Data struct {
+			Data struct {
+				AccessToken  string `json:"accessToken"`
+				RefreshToken string `json:"refreshToken"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	response := request(http.MethodPost, "/api/v1/login", map[string]string{"email": email, "password": "pass1234"})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Login: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	json.Unmarshal(response.Body.Bytes(), &tokens)
+	return tokens.Data.Data.AccessToken, tokens.Data.Data.RefreshToken
+}
+
+func refresh(refreshToken string) (*httptest.ResponseRecorder, string, string) {
+	var tokens struct {
+		Data struct {
+			Data struct {
+				AccessToken  string `json:"accessToken"`
+				RefreshToken string `json:"refreshToken"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	response := requestAs("", http.MethodPost, "/api/v1/token/refresh", map[string]string{"refreshToken": refreshToken})
+	json.Unmarshal(response.Body.Bytes(), &tokens)
+	return response, tokens.Data.Data.AccessToken, tokens.Data.Data.RefreshToken
+}
+
+func TestSessions(t *testing.T) {
+	user := signUp(t, "leaver@test.test", "pass1234")
+
+	access, refreshToken := login(t, "leaver@test.test")
+	if response := requestAs(access, http.MethodGet, "/api/v1/me", nil); response.Code != http.StatusOK {
+		t.Fatalf("Me after login: response: %v", response.Code)
+	}
+
+	response, rotatedAccess, rotatedRefresh := refresh(refreshToken)
+	if response.Code != http.StatusOK || rotatedRefresh == refreshToken {
+		t.Fatalf("Refresh: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := requestAs(access, http.MethodGet, "/api/v1/me", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("Me with access token of refreshed session: response: %v", response.Code)
+	}
+	if response, _, _ := refresh(refreshToken); response.Code != http.StatusUnauthorized {
+		t.Errorf("Reuse refresh token: response: %v", response.Code)
+	}
+	if response := requestAs(rotatedAccess, http.MethodGet, "/api/v1/me", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("Me after refresh token reuse: response: %v", response.Code)
+	}
+
+	access, _ = login(t, "leaver@test.test")
+	if response := requestAs(access, http.MethodPost, "/api/v1/logout", nil); response.Code != http.StatusOK {
+		t.Errorf("Logout: response: %v", response.Code)
+	}
+	if response := requestAs(access, http.MethodGet, "/api/v1/me", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("Me after logout: response: %v", response.Code)
+	}
+
+	access, refreshToken = login(t, "leaver@test.test")
+	var created struct {
+		Data struct {
+			Data struct {
+				Key string `json:"key"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	response = requestAs(access, http.MethodPost, "/api/v1/me/keys", map[string]interface{}{"label": "laptop", "scopes": []string{"spirits:read"}})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Create API key: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	json.Unmarshal(response.Body.Bytes(), &created)
+	key := created.Data.Data.Key
+	if response := requestAs(key, http.MethodGet, "/api/v1/spirits", nil); response.Code == http.StatusUnauthorized {
+		t.Errorf("API key before sessions revoked: response: %v", response.Code)
+	}
+
+	var revoked struct {
+		Data struct {
+			Data map[string]int `json:"data"`
+		} `json:"data"`
+	}
+	response = request(http.MethodDelete, "/api/v1/users/"+user+"/sessions", nil)
+	if response.Code != http.StatusOK {
+		t.Errorf("Revoke sessions: response: %v", response.Code)
+	}
+	json.Unmarshal(response.Body.Bytes(), &revoked)
+	if revoked.Data.Data["revoked"] != 1 || revoked.Data.Data["revokedApiKeys"] != 1 {
+		t.Errorf("Revoke sessions: revoked %v", revoked.Data.Data)
+	}
+	if response := requestAs(key, http.MethodGet, "/api/v1/spirits", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("API key after sessions revoked: response: %v", response.Code)
+	}
+	if response := requestAs(access, http.MethodGet, "/api/v1/me", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("Me after sessions revoked: response: %v", response.Code)
+	}
+	if response, _, _ := refresh(refreshToken); response.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh after sessions revoked: response: %v", response.Code)
+	}
+}
+
+func TestApiKeys(t *testing.T) {
+	var created struct {
+		Data struct {
+			Data struct {
+				Key    string        `json:"key"`
+				ApiKey models.ApiKey `json:"apiKey"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	response := request(http.MethodPost, "/api/v1/me/keys", map[string]interface{}{
+		"label": "barrel room gateway", "scopes": []string{"measurements:write"},
+	})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Create API key: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	json.Unmarshal(response.Body.Bytes(), &created)
+	key, keyId := created.Data.Data.Key, created.Data.Data.ApiKey.Id.Hex()
+
+	reading := map[string]interface{}{"abv": 61.2, "image": "gateway.jpg"}
+	if response := requestAs(key, http.MethodPost, "/api/v1/measurements", reading); response.Code != http.StatusCreated {
+		t.Errorf("Create Measurement with API key: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := requestAs(key, http.MethodGet, "/api/v1/vessels", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Out of scope with API key: response: %v", response.Code)
+	}
+	if response := requestAs(key, http.MethodGet, "/api/v1/me/keys", nil); response.Code != http.StatusForbidden {
+		t.Errorf("List API keys with API key: response: %v", response.Code)
+	}
+	if response := request(http.MethodPost, "/api/v1/me/keys", map[string]interface{}{"label": "x", "scopes": []string{"cellar:own"}}); response.Code != http.StatusBadRequest {
+		t.Errorf("Create API key with unknown scope: response: %v", response.Code)
+	}
+	cellarMaster := tokenFor(models.RoleCellarMaster)
+	if response := requestAs(cellarMaster, http.MethodPost, "/api/v1/me/keys", map[string]interface{}{"label": "x", "scopes": []string{"users:manage"}}); response.Code != http.StatusForbidden {
+		t.Errorf("Create API key beyond role: response: %v", response.Code)
+	}
+
+	if response := request(http.MethodDelete, "/api/v1/me/keys/"+keyId, nil); response.Code != http.StatusOK {
+		t.Errorf("Revoke API key: response: %v", response.Code)
+	}
+	if response := requestAs(key, http.MethodPost, "/api/v1/measurements", reading); response.Code != http.StatusUnauthorized {
+		t.Errorf("Revoked API key: response: %v", response.Code)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	request(http.MethodPost, "/api/v1/users", map[string]string{"email": "unverified@test.test", "password": "pass1234"})
+	first := testMail.lastToken("unverified@test.test")
+
+	login := map[string]string{"email": "unverified@test.test", "password": "pass1234"}
+	if response := request(http.MethodPost, "/api/v1/login", login); response.Code != http.StatusForbidden {
+		t.Errorf("Login unverified: response: %v", response.Code)
+	}
+
+	if response := request(http.MethodPost, "/api/v1/email/verify/resend", map[string]string{"email": "unverified@test.test"}); response.Code != http.StatusOK {
+		t.Errorf("Resend verification: response: %v", response.Code)
+	}
+	if response := request(http.MethodPost, "/api/v1/email/verify/resend", map[string]string{"email": "nobody@test.test"}); response.Code != http.StatusOK {
+		t.Errorf("Resend verification to unknown address: response: %v", response.Code)
+	}
+	second := testMail.lastToken("unverified@test.test")
+	if first == second {
+		t.Fatal("Resend verification: no new token was mailed")
+	}
+
+	if response := request(http.MethodPost, "/api/v1/email/verify", map[string]string{"token": second}); response.Code != http.StatusOK {
+		t.Errorf("Verify email: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodPost, "/api/v1/email/verify", map[string]string{"token": second}); response.Code != http.StatusBadRequest {
+		t.Errorf("Reuse verification token: response: %v", response.Code)
+	}
+	if response := request(http.MethodPost, "/api/v1/login", login); response.Code != http.StatusOK {
+		t.Errorf("Login verified: response: %v", response.Code)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	signUp(t, "forgetful@test.test", "old-password")
+
+	if response := request(http.MethodPost, "/api/v1/password/forgot", map[string]string{"email": "forgetful@test.test"}); response.Code != http.StatusOK {
+		t.Fatalf("Forgot password: response: %v", response.Code)
+	}
+	token := testMail.lastToken("forgetful@test.test")
+
+	if response := request(http.MethodPost, "/api/v1/email/verify", map[string]string{"token": token}); response.Code != http.StatusBadRequest {
+		t.Errorf("Reset token used to verify email: response: %v", response.Code)
+	}
+	reset := map[string]string{"token": token, "password": "new-password"}
+	if response := request(http.MethodPost, "/api/v1/password/reset", reset); response.Code != http.StatusOK {
+		t.Fatalf("Reset password: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodPost, "/api/v1/password/reset", reset); response.Code != http.StatusBadRequest {
+		t.Errorf("Reuse reset token: response: %v", response.Code)
+	}
+
+	if response := request(http.MethodPost, "/api/v1/login", map[string]string{"email": "forgetful@test.test", "password": "old-password"}); response.Code != http.StatusUnauthorized {
+		t.Errorf("Login with old password: response: %v", response.Code)
+	}
+	if response := request(http.MethodPost, "/api/v1/login", map[string]string{"email": "forgetful@test.test", "password": "new-password"}); response.Code != http.StatusOK {
+		t.Errorf("Login with new password: response: %v", response.Code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	signUp(t, "guessed@test.test", "right-password")
+
+	var failure struct {
+		Data struct {
+			Data string `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodPost, "/api/v1/login", map[string]string{"email": "nobody@test.test", "password": "x"}).Body.Bytes(), &failure)
+	unknownAccount := failure.Data.Data
+
+	wrong := map[string]string{"email": "guessed@test.test", "password": "wrong-password"}
+	for i := 0; i < auth.AccountFailureLimit; i++ {
+		response := request(http.MethodPost, "/api/v1/login", wrong)
+		json.Unmarshal(response.Body.Bytes(), &failure)
+		if response.Code != http.StatusUnauthorized || failure.Data.Data != unknownAccount {
+			t.Errorf("Wrong password %d: response: %v, body: %v", i+1, response.Code, response.Body.String())
+		}
+	}
+
+	right := map[string]string{"email": "guessed@test.test", "password": "right-password"}
+	response := request(http.MethodPost, "/api/v1/login", right)
+	if response.Code != http.StatusTooManyRequests || response.Header().Get("Retry-After") == "" {
+		t.Errorf("Login while locked: response: %v, Retry-After: %q", response.Code, response.Header().Get("Retry-After"))
+	}
+
+	var lockouts struct {
+		Data struct {
+			Data []models.Lockout `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/lockouts?active=true", nil).Body.Bytes(), &lockouts)
+	var lockoutId string
+	for _, lockout := range lockouts.Data.Data {
+		if lockout.Key == "email:guessed@test.test" {
+			lockoutId = lockout.Id.Hex()
+		}
+	}
+	if lockoutId == "" {
+		t.Fatalf("List lockouts: got: %+v", lockouts.Data.Data)
+	}
+
+	if response := request(http.MethodDelete, "/api/v1/lockouts/"+lockoutId, nil); response.Code != http.StatusOK {
+		t.Errorf("Clear lockout: response: %v", response.Code)
+	}
+	if response := request(http.MethodPost, "/api/v1/login", right); response.Code != http.StatusOK {
+		t.Errorf("Login after lockout cleared: response: %v", response.Code)
+	}
+}
+
+func TestLoginLockoutIgnoresForwardedFor(t *testing.T) {
+	for i, forwarded := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		body, _ := json.Marshal(map[string]string{"email": "spoofer" + forwarded + "@test.test", "password": "x"})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwarded)
+		req.RemoteAddr = "198.51.100.7:4242"
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, req)
+		if response.Code != http.StatusUnauthorized {
+			t.Errorf("Login %d: response: %v", i+1, response.Code)
+		}
+	}
+
+	lockout, err := testStore.Lockouts.FindByKey(context.Background(), "ip:198.51.100.7")
+	if err != nil || lockout.Failures != 3 {
+		t.Errorf("Failures from the connecting address: got: %+v, error: %v", lockout, err)
+	}
+	if _, err := testStore.Lockouts.FindByKey(context.Background(), "ip:203.0.113.1"); err == nil {
+		t.Errorf("Failures counted against a forwarded address")
+	}
+}
+
+func TestPruneLockouts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	stale := models.Lockout{Key: "email:stale@example.com", Failures: 1,
+		LastFailureAt: primitive.NewDateTimeFromTime(now.Add(-2 * auth.MaxLockout))}
+	recent := models.Lockout{Key: "email:recent@example.com", Failures: 1,
+		LastFailureAt: primitive.NewDateTimeFromTime(now.Add(-time.Hour))}
+	for _, lockout := range []*models.Lockout{&stale, &recent} {
+		if err := testStore.Lockouts.Create(ctx, lockout); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := retention.PruneLockouts(ctx, testStore, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testStore.Lockouts.FindByKey(ctx, stale.Key); err == nil {
+		t.Errorf("Lockout quiet for %v not pruned", 2*auth.MaxLockout)
+	}
+	if _, err := testStore.Lockouts.FindByKey(ctx, recent.Key); err != nil {
+		t.Errorf("Recent lockout pruned: %v", err)
+	}
+}
+
+func TestOrganisations(t *testing.T) {
+	var created struct {
+		Data struct {
+			Data models.Organisation `json:"data"`
+		} `json:"data"`
+	}
+	founder := tokenAs("founder@test.test", models.RoleAdmin, &testOrganisation.Id)
+	response := requestAs(founder, http.MethodPost, "/api/v1/organisations", map[string]string{"name": "Rival Distillery"})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Create Organisation: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	json.Unmarshal(response.Body.Bytes(), &created)
+	rivalOrg := created.Data.Data.Id.Hex()
+
+	if response := requestAs(founder, http.MethodGet, "/api/v1/spirits", nil); response.Code != http.StatusBadRequest {
+		t.Errorf("Member of two organisations without header: response: %v", response.Code)
+	}
+	if response := requestIn(founder, rivalOrg, http.MethodGet, "/api/v1/spirits", nil); response.Code != http.StatusOK {
+		t.Errorf("Member of two organisations with header: response: %v", response.Code)
+	}
+
+	var me struct {
+		Data struct {
+			Data models.User `json:"data"`
+		} `json:"data"`
+	}
+	rival := tokenAs("rival@test.test", models.RoleCellarMaster, nil)
+	if response := requestAs(rival, http.MethodGet, "/api/v1/spirits", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Read spirits without an organisation: response: %v", response.Code)
+	}
+	json.Unmarshal(requestAs(rival, http.MethodGet, "/api/v1/me", nil).Body.Bytes(), &me)
+	response = request(http.MethodPost, "/api/v1/organisations/"+rivalOrg+"/members", map[string]string{"userId": me.Data.Data.Id.Hex()})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Add member: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodPost, "/api/v1/organisations/"+rivalOrg+"/members", map[string]string{"userId": me.Data.Data.Id.Hex()}); response.Code != http.StatusConflict {
+		t.Errorf("Add member twice: response: %v", response.Code)
+	}
+
+	spirit := createdId(request(http.MethodPost, "/api/v1/spirits", map[string]interface{}{"name": "Ours", "volume": 200, "initialABV": 63.5}))
+	batch := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+
+	if response := requestAs(rival, http.MethodGet, "/api/v1/spirits/"+spirit, nil); response.Code != http.StatusNotFound {
+		t.Errorf("Read other organisation's spirit: response: %v", response.Code)
+	}
+	if response := requestAs(rival, http.MethodPut, "/api/v1/spirits/"+spirit, map[string]interface{}{"name": "Theirs", "volume": 1, "initialABV": 40}); response.Code != http.StatusNotFound {
+		t.Errorf("Update other organisation's spirit: response: %v", response.Code)
+	}
+	if response := requestAs(rival, http.MethodDelete, "/api/v1/spirits/"+spirit, nil); response.Code != http.StatusNotFound {
+		t.Errorf("Delete other organisation's spirit: response: %v", response.Code)
+	}
+	if response := requestAs(rival, http.MethodGet, "/api/v1/batches/"+batch+"/timeline", nil); response.Code != http.StatusNotFound {
+		t.Errorf("Read other organisation's timeline: response: %v", response.Code)
+	}
+	response = requestAs(rival, http.MethodPost, "/api/v1/spirits", map[string]interface{}{"name": "Theirs", "volume": 100, "initialABV": 40, "batchIds": []string{batch}})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Reference other organisation's batch: response: %v", response.Code)
+	}
+
+	response = requestAs(rival, http.MethodPost, "/api/v1/spirits", map[string]interface{}{"name": "Theirs", "volume": 100, "initialABV": 40, "organisationId": testOrganisation.Id.Hex()})
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Create spirit: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodGet, "/api/v1/spirits/"+createdId(response), nil); response.Code != http.StatusNotFound {
+		t.Errorf("Spirit created claiming another organisation: response: %v", response.Code)
+	}
+	if response := requestAs(rival, http.MethodGet, "/api/v1/spirits", nil); strings.Contains(response.Body.String(), spirit) {
+		t.Errorf("List spirits leaks other organisation's: body: %v", response.Body.String())
+	}
+
+	if response := requestIn(rival, testOrganisation.Id.Hex(), http.MethodGet, "/api/v1/spirits", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Pick an organisation one is not a member of: response: %v", response.Code)
+	}
+	if response := requestIn(adminToken, rivalOrg, http.MethodGet, "/api/v1/spirits", nil); response.Code != http.StatusOK {
+		t.Errorf("Admin picks any organisation: response: %v", response.Code)
+	}
+
+	response = requestAs(rival, http.MethodGet, "/api/v1/organisations", nil)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), rivalOrg) || strings.Contains(response.Body.String(), testOrganisation.Id.Hex()) {
+		t.Errorf("List own organisations: response: %v, body: %v", response.Code, response.Body.String())
+	}
+
+	if response := request(http.MethodDelete, "/api/v1/organisations/"+rivalOrg+"/members/"+me.Data.Data.Id.Hex(), nil); response.Code != http.StatusOK {
+		t.Errorf("Remove member: response: %v", response.Code)
+	}
+	if response := requestAs(rival, http.MethodGet, "/api/v1/spirits", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Read spirits after removal: response: %v", response.Code)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	batch := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	if response := request(http.MethodPut, "/api/v1/batches/"+batch, map[string]interface{}{"volume": 180}); response.Code != http.StatusOK {
+		t.Fatalf("Update batch: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodDelete, "/api/v1/batches/"+batch, nil); response.Code != http.StatusOK {
+		t.Fatalf("Delete batch: response: %v, body: %v", response.Code, response.Body.String())
+	}
+
+	var log struct {
+		Data struct {
+			Data []models.AuditEntry `json:"data"`
+		} `json:"data"`
+	}
+	response := request(http.MethodGet, "/api/v1/audit?entity=batch&id="+batch, nil)
+	json.Unmarshal(response.Body.Bytes(), &log)
+	entries := log.Data.Data
+	if response.Code != http.StatusOK || len(entries) != 3 {
+		t.Fatalf("Audit log: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	for i, operation := range []string{models.AuditCreate, models.AuditUpdate, models.AuditDelete} {
+		if entries[i].Operation != operation || entries[i].Entity != "batch" || entries[i].EntityId.Hex() != batch {
+			t.Errorf("Entry %d: got: %+v, want operation: %v", i, entries[i], operation)
+		}
+	}
+	volume := entries[1].Changes["volume"]
+	if string(volume.Before) != "200" || string(volume.After) != "180" {
+		t.Errorf("Update changes: got: %v", entries[1].Changes)
+	}
+	if _, ok := entries[2].Changes["deletedAt"]; !ok || len(entries[2].Changes) != 2 {
+		t.Errorf("Delete changes: got: %v", entries[2].Changes)
+	}
+
+	var me struct {
+		Data struct {
+			Data models.User `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/me", nil).Body.Bytes(), &me)
+	if entries[0].ActorId != me.Data.Data.Id || entries[0].OrganisationId != testOrganisation.Id {
+		t.Errorf("Actor: got: %v in %v, want: %v in %v", entries[0].ActorId, entries[0].OrganisationId, me.Data.Data.Id, testOrganisation.Id)
+	}
+
+	if response := request(http.MethodGet, "/api/v1/audit?entity=cask", nil); response.Code != http.StatusBadRequest {
+		t.Errorf("Unknown entity: response: %v", response.Code)
+	}
+	taster := tokenAs("auditor@test.test", models.RoleTaster, &testOrganisation.Id)
+	if response := requestAs(taster, http.MethodGet, "/api/v1/audit", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Taster reads audit log: response: %v", response.Code)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	before := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	batch := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	time.Sleep(5 * time.Millisecond)
+	created := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	if response := request(http.MethodPut, "/api/v1/batches/"+batch, map[string]interface{}{"volume": 180}); response.Code != http.StatusOK {
+		t.Fatalf("Update batch: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	time.Sleep(5 * time.Millisecond)
+	updated := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	if response := request(http.MethodDelete, "/api/v1/batches/"+batch, nil); response.Code != http.StatusOK {
+		t.Fatalf("Delete batch: response: %v, body: %v", response.Code, response.Body.String())
+	}
+
+	var history struct {
+		Data struct {
+			Data []models.Version `json:"data"`
+		} `json:"data"`
+	}
+	response := request(http.MethodGet, "/api/v1/batches/"+batch+"/history", nil)
+	json.Unmarshal(response.Body.Bytes(), &history)
+	versions := history.Data.Data
+	if response.Code != http.StatusOK || len(versions) != 3 {
+		t.Fatalf("History: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if !strings.Contains(string(versions[1].Document), `"volume":180`) || versions[2].Operation != models.AuditDelete || !strings.Contains(string(versions[2].Document), `"deletedAt"`) {
+		t.Errorf("History: versions: %+v", versions)
+	}
+
+	var found struct {
+		Data struct {
+			Data models.Batch `json:"data"`
+		} `json:"data"`
+	}
+	asOf := func(at time.Time) *httptest.ResponseRecorder {
+		return request(http.MethodGet, "/api/v1/batches/"+batch+"?asOf="+at.UTC().Format(time.RFC3339Nano), nil)
+	}
+	response = asOf(created)
+	json.Unmarshal(response.Body.Bytes(), &found)
+	if response.Code != http.StatusOK || found.Data.Data.Volume != 200 {
+		t.Errorf("As of creation: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	response = asOf(updated)
+	json.Unmarshal(response.Body.Bytes(), &found)
+	if response.Code != http.StatusOK || found.Data.Data.Volume != 180 {
+		t.Errorf("As of update: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := asOf(before); response.Code != http.StatusNotFound {
+		t.Errorf("As of before creation: response: %v", response.Code)
+	}
+	if response := asOf(time.Now()); response.Code != http.StatusNotFound {
+		t.Errorf("As of after deletion: response: %v", response.Code)
+	}
+	if response := request(http.MethodGet, "/api/v1/batches/"+batch+"?asOf=last-year", nil); response.Code != http.StatusBadRequest {
+		t.Errorf("Invalid asOf: response: %v", response.Code)
+	}
+
+	spirit := createdId(request(http.MethodPost, "/api/v1/spirits", map[string]interface{}{"name": "Late", "volume": 100, "initialABV": 60}))
+	response = request(http.MethodGet, "/api/v1/spirits?asOf="+updated.UTC().Format(time.RFC3339Nano), nil)
+	if response.Code != http.StatusOK || strings.Contains(response.Body.String(), spirit) {
+		t.Errorf("Spirits as of earlier: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	response = request(http.MethodGet, "/api/v1/spirits?asOf="+time.Now().UTC().Format("2006-01-02"), nil)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), spirit) {
+		t.Errorf("Spirits as of end of today: response: %v, body: %v", response.Code, response.Body.String())
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	vessel := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{"volume": 200, "material": "American Oak"}))
+	path := "/api/v1/vessels/" + vessel
+
+	if response := request(http.MethodPost, path+"/restore", nil); response.Code != http.StatusNotFound {
+		t.Errorf("Restore live vessel: response: %v, want: %v", response.Code, http.StatusNotFound)
+	}
+	if response := request(http.MethodDelete, path, nil); response.Code != http.StatusOK {
+		t.Fatalf("Delete vessel: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodGet, path, nil); response.Code != http.StatusNotFound {
+		t.Errorf("Get deleted vessel: response: %v, want: %v", response.Code, http.StatusNotFound)
+	}
+	if response := request(http.MethodGet, "/api/v1/vessels", nil); strings.Contains(response.Body.String(), vessel) {
+		t.Errorf("List vessels shows deleted vessel: body: %v", response.Body.String())
+	}
+	if response := request(http.MethodDelete, path, nil); response.Code != http.StatusNotFound {
+		t.Errorf("Delete vessel twice: response: %v, want: %v", response.Code, http.StatusNotFound)
+	}
+
+	var deleted struct {
+		Data struct {
+			Data models.Vessel `json:"data"`
+		} `json:"data"`
+	}
+	response := request(http.MethodGet, path+"?deleted=true", nil)
+	json.Unmarshal(response.Body.Bytes(), &deleted)
+	if response.Code != http.StatusOK || !deleted.Data.Data.Deleted() || deleted.Data.Data.DeletedBy == nil {
+		t.Errorf("Get deleted vessel with deleted=true: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodGet, "/api/v1/vessels?deleted=true", nil); !strings.Contains(response.Body.String(), vessel) {
+		t.Errorf("List deleted vessels: body: %v", response.Body.String())
+	}
+
+	response = request(http.MethodPost, path+"/restore", nil)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Restore vessel: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	response = request(http.MethodGet, path, nil)
+	if response.Code != http.StatusOK || strings.Contains(response.Body.String(), "deletedAt") {
+		t.Errorf("Get restored vessel: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodGet, "/api/v1/audit?entity=vessel&id="+vessel, nil); !strings.Contains(response.Body.String(), `"operation":"restore"`) {
+		t.Errorf("Audit log of restore: body: %v", response.Body.String())
+	}
+
+	taster := tokenAs("restorer@test.test", models.RoleTaster, &testOrganisation.Id)
+	request(http.MethodDelete, path, nil)
+	if response := requestAs(taster, http.MethodPost, path+"/restore", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Taster restores vessel: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+}
+
+func TestListings(t *testing.T) {
+	for _, volume := range []int{200, 500, 225} {
+		request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{"volume": volume, "material": "Stainless", "location": "Rickhouse 9"})
+	}
+
+	var listed struct {
+		Data struct {
+			Data       []models.Vessel `json:"data"`
+			Total      int             `json:"total"`
+			NextCursor string          `json:"nextCursor"`
+		} `json:"data"`
+	}
+	volumes := make([]float32, 0, 3)
+	path := "/api/v1/vessels?location=rickhouse%209&material=Stainless&sort=-volume&limit=2"
+	for next := path; next != ""; {
+		listed.Data.NextCursor = ""
+		response := request(http.MethodGet, next, nil)
+		json.Unmarshal(response.Body.Bytes(), &listed)
+		if response.Code != http.StatusOK || listed.Data.Total != 3 {
+			t.Fatalf("List vessels: response: %v, body: %v", response.Code, response.Body.String())
+		}
+		for _, vessel := range listed.Data.Data {
+			volumes = append(volumes, vessel.Volume)
+		}
+		next = ""
+		if listed.Data.NextCursor != "" {
+			next = path + "&cursor=" + listed.Data.NextCursor
+		}
+	}
+	if len(volumes) != 3 || volumes[0] != 500 || volumes[1] != 225 || volumes[2] != 200 {
+		t.Errorf("Vessel pages: volumes: %v", volumes)
+	}
+
+	batch := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 321}))
+	request(http.MethodPost, "/api/v1/measurements", map[string]interface{}{"batchId": batch, "abv": 61, "image": "hydrometer.jpg"})
+	response := request(http.MethodGet, "/api/v1/batches?volume=321", nil)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), batch) {
+		t.Errorf("List batches: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	response = request(http.MethodGet, "/api/v1/measurements?batchId="+batch, nil)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"total":1`) {
+		t.Errorf("List measurements: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	response = request(http.MethodGet, "/api/v1/spirits?createdAt[gte]="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339), nil)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"total":0`) {
+		t.Errorf("List future spirits: response: %v, body: %v", response.Code, response.Body.String())
+	}
+
+	for _, path := range []string{"/api/v1/batches?colour=amber", "/api/v1/measurements?sort=colour", "/api/v1/spirits?limit=none", "/api/v1/vessels?cursor=nonsense"} {
+		if response := request(http.MethodGet, path, nil); response.Code != http.StatusBadRequest {
+			t.Errorf("%v: response: %v, want: %v", path, response.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	batch := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	request(http.MethodPost, "/api/v1/spirits", map[string]interface{}{
+		"name": "Plantain Rum", "volume": 200, "initialABV": 62, "recipeName": "Jamaican Pot Still", "batchIds": []string{batch},
+	})
+	vessel := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{"volume": 200, "material": "French Oak"}))
+	reading := map[string]interface{}{
+		"batchId": batch, "vesselId": vessel, "abv": 60, "image": "hydrometer.jpg",
+		"date": "2025-06-01T00:00:00Z", "nose": "Overripe bananas and clove", "finish": "Long, dried fruit",
+	}
+	first := createdId(request(http.MethodPost, "/api/v1/measurements", reading))
+
+	var found struct {
+		Data struct {
+			Data search.Results `json:"data"`
+		} `json:"data"`
+	}
+	find := func(query url.Values) search.Results {
+		t.Helper()
+		found.Data.Data = search.Results{}
+		response := request(http.MethodGet, "/api/v1/search?"+query.Encode(), nil)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Search %q: response: %v, body: %v", query, response.Code, response.Body.String())
+		}
+		json.Unmarshal(response.Body.Bytes(), &found)
+		return found.Data.Data
+	}
+
+	results := find(url.Values{"q": {"nose:banan*"}, "from": {"2025-01-01"}, "to": {"2025-12-31"}})
+	if results.Total != 1 || results.Hits[0].Id.Hex() != first {
+		t.Fatalf("Banana on the nose: got: %+v", results)
+	}
+	facets := results.Facets
+	if len(facets.Spirits) != 1 || facets.Spirits[0].Value != "Plantain Rum" || len(facets.Materials) != 1 || facets.Materials[0].Value != "French Oak" || len(facets.Dates) != 1 || facets.Dates[0].Value != "2025-06" {
+		t.Errorf("Facets: got: %+v", facets)
+	}
+
+	reading["date"] = "2026-02-01T00:00:00Z"
+	reading["nose"] = "Banana bread"
+	second := createdId(request(http.MethodPost, "/api/v1/measurements", reading))
+	if results := find(url.Values{"q": {"banan*"}, "interval": {"year"}}); results.Total != 2 || len(results.Facets.Dates) != 2 || results.Facets.Dates[1].Value != "2026" {
+		t.Errorf("After a second reading: got: %+v", results)
+	}
+	if results := find(url.Values{"q": {`"dried fruit" jamaican`}, "spirit": {"plantain rum"}, "to": {"2025-12-31"}}); results.Total != 1 {
+		t.Errorf("Phrase and recipe: got: %+v", results)
+	}
+	if results := find(url.Values{"q": {`"fruit dried"`}}); results.Total != 0 {
+		t.Errorf("Phrase out of order: got: %+v", results)
+	}
+
+	request(http.MethodDelete, "/api/v1/measurements/"+second, nil)
+	if results := find(url.Values{"q": {"banan*"}}); results.Total != 1 {
+		t.Errorf("After deleting a reading: got: %+v", results)
+	}
+	request(http.MethodPut, "/api/v1/spirits/"+results.Facets.Spirits[0].Id, map[string]interface{}{
+		"name": "Banana Rum", "volume": 200, "initialABV": 62, "batchIds": []string{batch},
+	})
+	if results := find(url.Values{"q": {"spirit:banana"}}); results.Total != 1 {
+		t.Errorf("After renaming the spirit: got: %+v", results)
+	}
+
+	for _, query := range []string{"", "q=colour:amber", "q=banana&interval=week", "q=banana&from=yesterday"} {
+		if response := request(http.MethodGet, "/api/v1/search?"+query, nil); response.Code != http.StatusBadRequest {
+			t.Errorf("Search %q: response: %v, want: %v", query, response.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestFlavourWheel(t *testing.T) {
+	var wheel struct {
+		Data struct {
+			Data []models.Descriptor `json:"data"`
+		} `json:"data"`
+	}
+	response := request(http.MethodPost, "/api/v1/descriptors/wheel", nil)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Load wheel: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	json.Unmarshal(response.Body.Bytes(), &wheel)
+	var woody models.Descriptor
+	for _, category := range wheel.Data.Data {
+		if category.Name == "Woody" {
+			woody = category
+		}
+	}
+	if len(woody.Children) == 0 {
+		t.Fatalf("Woody category: got: %+v", wheel.Data.Data)
+	}
+	if response := request(http.MethodPost, "/api/v1/descriptors/wheel", nil); response.Code != http.StatusOK {
+		t.Errorf("Reload wheel: response: %v", response.Code)
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/descriptors", nil).Body.Bytes(), &wheel)
+	if len(wheel.Data.Data) != 9 {
+		t.Errorf("Categories after reloading: got: %v", len(wheel.Data.Data))
+	}
+
+	if response := request(http.MethodPost, "/api/v1/descriptors", map[string]interface{}{"name": "Pencil Shavings", "synonyms": []string{"vanillin"}}); response.Code != http.StatusConflict {
+		t.Errorf("Synonym in use: response: %v, want: %v", response.Code, http.StatusConflict)
+	}
+	cedar := createdId(request(http.MethodPost, "/api/v1/descriptors", map[string]interface{}{"name": "Cedar", "parentId": woody.Id.Hex()}))
+	if response := request(http.MethodPut, "/api/v1/descriptors/"+woody.Id.Hex(), map[string]interface{}{"name": "Woody", "parentId": cedar}); response.Code != http.StatusBadRequest {
+		t.Errorf("Category under its own descriptor: response: %v, want: %v", response.Code, http.StatusBadRequest)
+	}
+	taster := tokenAs("flavour-taster@test.test", models.RoleTaster, &testOrganisation.Id)
+	if response := requestAs(taster, http.MethodPost, "/api/v1/descriptors", map[string]interface{}{"name": "Marzipan"}); response.Code != http.StatusForbidden {
+		t.Errorf("Taster adding a descriptor: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+
+	batch := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	tasting := func(date string, tags ...map[string]interface{}) *httptest.ResponseRecorder {
+		return requestAs(taster, http.MethodPost, "/api/v1/measurements", map[string]interface{}{
+			"batchId": batch, "abv": 60, "image": "glass.jpg", "date": date, "descriptors": tags,
+		})
+	}
+	first := tasting("2025-01-10T00:00:00Z", map[string]interface{}{"name": "VANILLIN", "intensity": 2}, map[string]interface{}{"descriptorId": cedar, "intensity": 4})
+	if first.Code != http.StatusCreated {
+		t.Fatalf("Tagged tasting: response: %v, body: %v", first.Code, first.Body.String())
+	}
+	var measurement struct {
+		Data struct {
+			Data models.Measurement `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/measurements/"+createdId(first), nil).Body.Bytes(), &measurement)
+	if tags := measurement.Data.Data.Descriptors; len(tags) != 2 || tags[0].Name != "Vanilla" || tags[1].Name != "Cedar" {
+		t.Errorf("Resolved tags: got: %+v", tags)
+	}
+	tasting("2025-01-20T00:00:00Z", map[string]interface{}{"name": "vanilla", "intensity": 4})
+	tasting("2025-03-01T00:00:00Z", map[string]interface{}{"name": "Sherry", "intensity": 5})
+	for _, tag := range []map[string]interface{}{{"name": "Wet Dog", "intensity": 3}, {"name": "Vanilla", "intensity": 9}, {"intensity": 2}} {
+		if response := tasting("2025-03-02T00:00:00Z", tag); response.Code != http.StatusBadRequest {
+			t.Errorf("Tag %v: response: %v, want: %v", tag, response.Code, http.StatusBadRequest)
+		}
+	}
+
+	var flavour struct {
+		Data struct {
+			Data struct {
+				Periods []struct {
+					Period      string `json:"period"`
+					Tastings    int    `json:"tastings"`
+					Descriptors []struct {
+						Name      string  `json:"name"`
+						Intensity float64 `json:"intensity"`
+						Count     int     `json:"count"`
+					} `json:"descriptors"`
+					Categories []struct {
+						Name      string  `json:"name"`
+						Intensity float64 `json:"intensity"`
+					} `json:"categories"`
+				} `json:"periods"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	response = request(http.MethodGet, "/api/v1/batches/"+batch+"/flavour?period=month", nil)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Flavour: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	json.Unmarshal(response.Body.Bytes(), &flavour)
+	periods := flavour.Data.Data.Periods
+	if len(periods) != 2 || periods[0].Period != "2025-01" || periods[0].Tastings != 2 || periods[1].Period != "2025-03" {
+		t.Fatalf("Periods: got: %+v", periods)
+	}
+	january := periods[0]
+	if january.Descriptors[0].Name != "Vanilla" || january.Descriptors[0].Intensity != 3 || january.Descriptors[0].Count != 2 {
+		t.Errorf("Vanilla in January: got: %+v", january.Descriptors)
+	}
+	if len(january.Categories) != 1 || january.Categories[0].Name != "Woody" || january.Categories[0].Intensity != 4 {
+		t.Errorf("Woody in January: got: %+v", january.Categories)
+	}
+	if response := request(http.MethodGet, "/api/v1/batches/"+batch+"/flavour?period=week", nil); response.Code != http.StatusBadRequest {
+		t.Errorf("Flavour by week: response: %v, want: %v", response.Code, http.StatusBadRequest)
+	}
+
+	if response := request(http.MethodDelete, "/api/v1/descriptors/"+cedar, nil); response.Code != http.StatusConflict {
+		t.Errorf("Delete descriptor in use: response: %v, want: %v", response.Code, http.StatusConflict)
+	}
+	if response := request(http.MethodDelete, "/api/v1/descriptors/"+woody.Id.Hex(), nil); response.Code != http.StatusConflict {
+		t.Errorf("Delete category with descriptors: response: %v, want: %v", response.Code, http.StatusConflict)
+	}
+
+	if response := request(http.MethodPut, "/api/v1/descriptors/"+cedar, map[string]interface{}{"name": "Cedarwood", "parentId": woody.Id.Hex()}); response.Code != http.StatusOK {
+		t.Fatalf("Rename descriptor: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/measurements/"+createdId(first), nil).Body.Bytes(), &measurement)
+	if tags := measurement.Data.Data.Descriptors; len(tags) != 2 || tags[1].Name != "Cedarwood" {
+		t.Errorf("Tags after a rename: got: %+v", tags)
+	}
+	stored, _ := testStore.Measurements.FindById(context.Background(), measurement.Data.Data.Id)
+	if tags := stored.Descriptors; len(tags) != 2 || tags[0].Name != "" || tags[1].Name != "" {
+		t.Errorf("Stored tags: got: %+v", tags)
+	}
+
+	sawdust := createdId(request(http.MethodPost, "/api/v1/descriptors", map[string]interface{}{"name": "Sawdust", "parentId": woody.Id.Hex()}))
+	binned := createdId(tasting("2025-04-01T00:00:00Z", map[string]interface{}{"descriptorId": sawdust, "intensity": 1}))
+	if response := request(http.MethodDelete, "/api/v1/measurements/"+binned, nil); response.Code != http.StatusOK {
+		t.Fatalf("Delete measurement: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodDelete, "/api/v1/descriptors/"+sawdust, nil); response.Code != http.StatusConflict {
+		t.Errorf("Delete descriptor of a deleted measurement: response: %v, want: %v", response.Code, http.StatusConflict)
+	}
+}
+
+func TestTastingPanel(t *testing.T) {
+	master := tokenAs("panel-master@test.test", models.RoleCellarMaster, &testOrganisation.Id)
+	panel := map[string]string{}
+	var panelIds []string
+	for _, name := range []string{"ann", "bob", "cat", "dan"} {
+		email := "panel-" + name + "@test.test"
+		panel[name] = tokenAs(email, models.RoleTaster, &testOrganisation.Id)
+		user, _ := testStore.Users.FindByEmail(context.Background(), email)
+		panelIds = append(panelIds, user.Id.Hex())
+	}
+	bystander := tokenAs("panel-bystander@test.test", models.RoleTaster, &testOrganisation.Id)
+	outsider := tokenAs("panel-outsider@test.test", models.RoleTaster, nil)
+	outsiderUser, _ := testStore.Users.FindByEmail(context.Background(), "panel-outsider@test.test")
+
+	request(http.MethodPost, "/api/v1/descriptors/wheel", nil)
+	sherry := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	bourbon := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	session := map[string]interface{}{
+		"name": "Spring panel", "date": "2025-04-01T00:00:00Z", "panelIds": panelIds,
+		"samples": []map[string]interface{}{{"batchId": sherry}, {"batchId": bourbon}},
+	}
+	if response := requestAs(panel["ann"], http.MethodPost, "/api/v1/tastings", session); response.Code != http.StatusForbidden {
+		t.Errorf("Taster creating a session: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+	session["panelIds"] = append(append([]string{}, panelIds...), outsiderUser.Id.Hex())
+	if response := requestAs(master, http.MethodPost, "/api/v1/tastings", session); response.Code != http.StatusBadRequest {
+		t.Errorf("Panellist from outside: response: %v, want: %v", response.Code, http.StatusBadRequest)
+	}
+	session["panelIds"] = panelIds
+	id := createdId(requestAs(master, http.MethodPost, "/api/v1/tastings", session))
+
+	var found struct {
+		Data struct {
+			Data models.TastingSession `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(requestAs(master, http.MethodGet, "/api/v1/tastings/"+id, nil).Body.Bytes(), &found)
+	samples := found.Data.Data.Samples
+	if len(samples) != 2 || samples[0].Id.IsZero() {
+		t.Fatalf("Samples: got: %+v", samples)
+	}
+
+	scores := map[string][2]float64{"ann": {85, 80}, "bob": {86, 82}, "cat": {84, 78}, "dan": {60, 81}}
+	for name, score := range scores {
+		response := requestAs(panel[name], http.MethodPost, "/api/v1/tastings/"+id+"/scores", map[string]interface{}{"scores": []map[string]interface{}{
+			{"sampleId": samples[0].Id.Hex(), "score": score[0], "notes": "Raisins", "descriptors": []map[string]interface{}{{"name": "sherried", "intensity": 3}}},
+			{"sampleId": samples[1].Id.Hex(), "score": score[1]},
+		}})
+		if response.Code != http.StatusOK {
+			t.Fatalf("Scores of %v: response: %v, body: %v", name, response.Code, response.Body.String())
+		}
+	}
+	requestAs(panel["dan"], http.MethodPost, "/api/v1/tastings/"+id+"/scores", map[string]interface{}{"scores": []map[string]interface{}{
+		{"sampleId": samples[1].Id.Hex(), "score": 79},
+	}})
+	if response := requestAs(bystander, http.MethodPost, "/api/v1/tastings/"+id+"/scores", map[string]interface{}{"scores": []map[string]interface{}{
+		{"sampleId": samples[0].Id.Hex(), "score": 90},
+	}}); response.Code != http.StatusForbidden {
+		t.Errorf("Scores from off the panel: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+	if response := requestAs(panel["ann"], http.MethodPost, "/api/v1/tastings/"+id+"/scores", map[string]interface{}{"scores": []map[string]interface{}{
+		{"sampleId": samples[0].Id.Hex(), "score": 101},
+	}}); response.Code != http.StatusBadRequest {
+		t.Errorf("Score over 100: response: %v, want: %v", response.Code, http.StatusBadRequest)
+	}
+
+	json.Unmarshal(requestAs(panel["ann"], http.MethodGet, "/api/v1/tastings/"+id, nil).Body.Bytes(), &found)
+	if own := found.Data.Data.Scores; len(own) != 2 || own[0].Descriptors[0].Name != "Sherried" {
+		t.Errorf("Taster's view of an open session: got: %+v", own)
+	}
+	if response := requestAs(panel["ann"], http.MethodGet, "/api/v1/tastings/"+id+"/results", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Results of an open session: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+
+	if response := requestAs(master, http.MethodPost, "/api/v1/tastings/"+id+"/close", nil); response.Code != http.StatusOK {
+		t.Fatalf("Close: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := requestAs(panel["ann"], http.MethodPost, "/api/v1/tastings/"+id+"/scores", map[string]interface{}{"scores": []map[string]interface{}{
+		{"sampleId": samples[0].Id.Hex(), "score": 70},
+	}}); response.Code != http.StatusConflict {
+		t.Errorf("Scores after closing: response: %v, want: %v", response.Code, http.StatusConflict)
+	}
+
+	var results struct {
+		Data struct {
+			Data struct {
+				Samples []struct {
+					BatchId   string  `json:"batchId"`
+					Consensus float64 `json:"consensus"`
+					Variance  float64 `json:"variance"`
+					Scores    []struct {
+						TasterId string  `json:"tasterId"`
+						Outlier  bool    `json:"outlier"`
+						Score    float64 `json:"score"`
+					} `json:"scores"`
+				} `json:"samples"`
+				Panellists []struct {
+					TasterId string  `json:"tasterId"`
+					Bias     float64 `json:"bias"`
+					Outliers int     `json:"outliers"`
+				} `json:"panellists"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	response := requestAs(panel["ann"], http.MethodGet, "/api/v1/tastings/"+id+"/results", nil)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Results: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	json.Unmarshal(response.Body.Bytes(), &results)
+	first := results.Data.Data.Samples[0]
+	if first.BatchId != sherry || first.Consensus != 85 || len(first.Scores) != 4 {
+		t.Errorf("Sherry sample: got: %+v", first)
+	}
+	for _, score := range first.Scores {
+		if score.Outlier != (score.TasterId == panelIds[3]) {
+			t.Errorf("Outlier flag of %v: got: %v", score.TasterId, score.Outlier)
+		}
+	}
+	if second := results.Data.Data.Samples[1]; second.Consensus != 79.75 {
+		t.Errorf("Bourbon sample after a rescore: got: %+v", second)
+	}
+	if len(results.Data.Data.Panellists) != 4 {
+		t.Errorf("Panellists: got: %+v", results.Data.Data.Panellists)
+	}
+
+	var history struct {
+		Data struct {
+			Data []struct {
+				SessionId string `json:"sessionId"`
+				Samples   []struct {
+					BatchId string `json:"batchId"`
+				} `json:"samples"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/batches/"+bourbon+"/tastings", nil).Body.Bytes(), &history)
+	if len(history.Data.Data) != 1 || history.Data.Data[0].SessionId != id || len(history.Data.Data[0].Samples) != 1 || history.Data.Data[0].Samples[0].BatchId != bourbon {
+		t.Errorf("Batch tastings: got: %+v", history.Data.Data)
+	}
+	if response := requestAs(outsider, http.MethodGet, "/api/v1/tastings/"+id, nil); response.Code != http.StatusForbidden {
+		t.Errorf("Outsider reading a session: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+}
+
+func TestBlindTasting(t *testing.T) {
+	request(http.MethodPost, "/api/v1/descriptors/wheel", nil)
+	owner := tokenAs("blind-owner@test.test", models.RoleCellarMaster, &testOrganisation.Id)
+	other := tokenAs("blind-other@test.test", models.RoleCellarMaster, &testOrganisation.Id)
+	tasters := map[string]string{}
+	var panelIds []string
+	for _, name := range []string{"eve", "fay", "gus"} {
+		email := "blind-" + name + "@test.test"
+		tasters[name] = tokenAs(email, models.RoleTaster, &testOrganisation.Id)
+		user, _ := testStore.Users.FindByEmail(context.Background(), email)
+		panelIds = append(panelIds, user.Id.Hex())
+	}
+	panellist := tokenAs("blind-hal@test.test", models.RoleCellarMaster, &testOrganisation.Id)
+	hal, _ := testStore.Users.FindByEmail(context.Background(), "blind-hal@test.test")
+	panelIds = append(panelIds, hal.Id.Hex())
+
+	batch := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	control := createdId(request(http.MethodPost, "/api/v1/batches", map[string]interface{}{"volume": 200}))
+	vessel := createdId(request(http.MethodPost, "/api/v1/vessels", map[string]interface{}{"volume": 200, "material": "American Oak"}))
+	id := createdId(requestAs(owner, http.MethodPost, "/api/v1/tastings", map[string]interface{}{
+		"name": "Blind flight", "date": "2025-05-01T00:00:00Z", "blind": true, "panelIds": panelIds,
+		"samples": []map[string]interface{}{{"batchId": batch, "vesselId": vessel}, {"batchId": control}},
+	}))
+
+	var found struct {
+		Data struct {
+			Data models.TastingSession `json:"data"`
+		} `json:"data"`
+	}
+	view := func(token string, hidden bool) models.TastingSession {
+		t.Helper()
+		found.Data.Data = models.TastingSession{}
+		response := requestAs(token, http.MethodGet, "/api/v1/tastings/"+id, nil)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Session: response: %v, body: %v", response.Code, response.Body.String())
+		}
+		if hidden && strings.Contains(response.Body.String(), batch) {
+			t.Errorf("Batch id in the taster view: %v", response.Body.String())
+		}
+		json.Unmarshal(response.Body.Bytes(), &found)
+		return found.Data.Data
+	}
+	owned := view(owner, false)
+	if owned.Samples[0].BatchId == nil || owned.Samples[0].BatchId.Hex() != batch || len(owned.Samples[0].Code) != 3 || owned.Samples[0].Code == owned.Samples[1].Code {
+		t.Fatalf("Owner's view: got: %+v", owned.Samples)
+	}
+	codes := map[string]string{batch: owned.Samples[0].Code, control: owned.Samples[1].Code}
+	swapped := map[string]interface{}{
+		"name": "Blind flight", "date": "2025-05-01T00:00:00Z", "blind": true, "panelIds": panelIds,
+		"samples": []map[string]interface{}{{"batchId": control}, {"batchId": batch, "vesselId": vessel}},
+	}
+	if response := requestAs(panellist, http.MethodPut, "/api/v1/tastings/"+id, swapped); response.Code != http.StatusForbidden {
+		t.Errorf("Panellist changing the samples: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+	for _, path := range []string{"/close", ""} {
+		method := map[string]string{"/close": http.MethodPost, "": http.MethodDelete}[path]
+		if response := requestAs(panellist, method, "/api/v1/tastings/"+id+path, nil); response.Code != http.StatusForbidden {
+			t.Errorf("Panellist %v %v: response: %v, want: %v", method, path, response.Code, http.StatusForbidden)
+		}
+	}
+	swapped["name"] = "Blind flight, second pour"
+	swapped["samples"] = []map[string]interface{}{
+		{"id": owned.Samples[0].Id.Hex(), "batchId": batch, "vesselId": vessel},
+		{"id": owned.Samples[1].Id.Hex(), "batchId": control},
+	}
+	if response := requestAs(owner, http.MethodPut, "/api/v1/tastings/"+id, swapped); response.Code != http.StatusOK || !strings.Contains(response.Body.String(), batch) {
+		t.Errorf("Owner's update: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	blind := view(tasters["eve"], true)
+	for _, sample := range blind.Samples {
+		if sample.BatchId != nil || sample.VesselId != nil || sample.Code == "" {
+			t.Errorf("Taster's view of a sample: got: %+v", sample)
+		}
+	}
+
+	toffee := map[string]int{"eve": 3, "fay": 4, "gus": 4}
+	for name, score := range map[string]float64{"eve": 88, "fay": 90, "gus": 86} {
+		response := requestAs(tasters[name], http.MethodPost, "/api/v1/tastings/"+id+"/scores", map[string]interface{}{"scores": []map[string]interface{}{
+			{"code": codes[batch], "score": score, "notes": name + " found toffee", "descriptors": []map[string]interface{}{{"name": "Toffee", "intensity": toffee[name]}}},
+			{"code": codes[control], "score": 70},
+		}})
+		if response.Code != http.StatusOK {
+			t.Fatalf("Scores by code: response: %v, body: %v", response.Code, response.Body.String())
+		}
+	}
+	if response := requestAs(tasters["eve"], http.MethodPost, "/api/v1/tastings/"+id+"/scores", map[string]interface{}{"scores": []map[string]interface{}{
+		{"code": "000", "score": 50},
+	}}); response.Code != http.StatusBadRequest {
+		t.Errorf("Unknown code: response: %v, want: %v", response.Code, http.StatusBadRequest)
+	}
+
+	audited := func(token string) string {
+		t.Helper()
+		response := requestAs(token, http.MethodGet, "/api/v1/audit?entity=tasting&id="+id, nil)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Audit log: response: %v, body: %v", response.Code, response.Body.String())
+		}
+		return response.Body.String()
+	}
+	if body := audited(panellist); strings.Contains(body, batch) || strings.Contains(body, vessel) || strings.Contains(body, "found toffee") || !strings.Contains(body, codes[batch]) {
+		t.Errorf("Panellist's audit log of a blind session: %v", body)
+	}
+	if body := audited(owner); !strings.Contains(body, batch) || !strings.Contains(body, "found toffee") {
+		t.Errorf("Owner's audit log of a blind session: %v", body)
+	}
+
+	requestAs(owner, http.MethodPost, "/api/v1/tastings/"+id+"/close", nil)
+	response := requestAs(tasters["fay"], http.MethodGet, "/api/v1/tastings/"+id+"/results", nil)
+	if response.Code != http.StatusOK || strings.Contains(response.Body.String(), batch) {
+		t.Errorf("Results before the reveal: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := requestAs(other, http.MethodPost, "/api/v1/tastings/"+id+"/reveal", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Reveal by someone else: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+	if response := requestAs(tasters["eve"], http.MethodPost, "/api/v1/tastings/"+id+"/reveal", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Reveal by a taster: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+	sessionId, _ := primitive.ObjectIDFromHex(id)
+	interrupted, _ := testStore.Tastings.FindById(context.Background(), sessionId)
+	setAside := primitive.NewObjectID()
+	// The control's measurement was recorded by an earlier attempt and has
+	// been deleted since.
+	discarded := createdId(request(http.MethodPost, "/api/v1/measurements", map[string]interface{}{"batchId": control, "abv": 60, "image": "panel.jpg"}))
+	if response := request(http.MethodDelete, "/api/v1/measurements/"+discarded, nil); response.Code != http.StatusOK {
+		t.Fatalf("Delete Measurement: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	discardedId, _ := primitive.ObjectIDFromHex(discarded)
+	for i, sample := range interrupted.Samples {
+		switch sample.Code {
+		case codes[batch]:
+			interrupted.Samples[i].MeasurementId = &setAside
+		case codes[control]:
+			interrupted.Samples[i].MeasurementId = &discardedId
+		}
+	}
+	testStore.Tastings.Update(context.Background(), &interrupted)
+	if response := requestAs(owner, http.MethodPost, "/api/v1/tastings/"+id+"/reveal", nil); response.Code != http.StatusOK {
+		t.Fatalf("Reveal: response: %v, body: %v", response.Code, response.Body.String())
+	}
+	if response := request(http.MethodGet, "/api/v1/measurements/"+discarded, nil); response.Code != http.StatusNotFound {
+		t.Errorf("Deleted panel measurement after the reveal: response: %v", response.Code)
+	}
+	if response := requestAs(owner, http.MethodPost, "/api/v1/tastings/"+id+"/reveal", nil); response.Code != http.StatusConflict {
+		t.Errorf("Reveal twice: response: %v, want: %v", response.Code, http.StatusConflict)
+	}
+
+	if body := audited(panellist); !strings.Contains(body, batch) || !strings.Contains(body, "found toffee") {
+		t.Errorf("Panellist's audit log after the reveal: %v", body)
+	}
+
+	revealed := view(tasters["eve"], false)
+	var sample models.TastingSample
+	for _, s := range revealed.Samples {
+		if s.Code == codes[batch] {
+			sample = s
+		}
+	}
+	if sample.BatchId == nil || sample.BatchId.Hex() != batch || sample.VesselId == nil || sample.MeasurementId == nil || *sample.MeasurementId != setAside {
+		t.Fatalf("Revealed sample: got: %+v", sample)
+	}
+
+	var measurement struct {
+		Data struct {
+			Data models.Measurement `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/measurements/"+sample.MeasurementId.Hex(), nil).Body.Bytes(), &measurement)
+	recorded := measurement.Data.Data
+	if recorded.TastingId == nil || recorded.TastingId.Hex() != id || recorded.Score == nil || *recorded.Score != 88 || recorded.VesselId.Hex() != vessel || !strings.Contains(recorded.Notes, "fay found toffee") {
+		t.Errorf("Panel measurement: got: %+v", recorded)
+	}
+	if len(recorded.Descriptors) != 1 || recorded.Descriptors[0].Name != "Toffee" || recorded.Descriptors[0].Intensity != 4 {
+		t.Errorf("Panel descriptors: got: %+v", recorded.Descriptors)
+	}
+
+	var linked struct {
+		Data struct {
+			Data models.Batch `json:"data"`
+		} `json:"data"`
+	}
+	json.Unmarshal(request(http.MethodGet, "/api/v1/batches/"+batch, nil).Body.Bytes(), &linked)
+	if !containsHex(linked.Data.Data.MeasurementIds, sample.MeasurementId.Hex()) {
+		t.Errorf("Batch measurements: got: %v", linked.Data.Data.MeasurementIds)
+	}
+
+	// An owner who puts themselves on the panel tastes blind with it.
+	seated, _ := testStore.Users.FindByEmail(context.Background(), "blind-other@test.test")
+	id = createdId(requestAs(other, http.MethodPost, "/api/v1/tastings", map[string]interface{}{
+		"name": "Blind flight, own panel", "date": "2025-05-02T00:00:00Z", "blind": true, "panelIds": []string{seated.Id.Hex()},
+		"samples": []map[string]interface{}{{"batchId": batch, "vesselId": vessel}, {"batchId": control}},
+	}))
+	for _, sample := range view(other, true).Samples {
+		if sample.BatchId != nil || sample.VesselId != nil {
+			t.Errorf("Seated owner's view of a sample: got: %+v", sample)
+		}
+	}
+	if response := requestAs(other, http.MethodPost, "/api/v1/tastings/"+id+"/close", nil); response.Code != http.StatusForbidden {
+		t.Errorf("Seated owner closing: response: %v, want: %v", response.Code, http.StatusForbidden)
+	}
+}
+
+func containsHex(ids []primitive.ObjectID, hex string) bool {
+	for _, id := range ids {
+		if id.Hex() == hex {
+			return true
+		}
 	}
+	return false
 }
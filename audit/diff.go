@@ -0,0 +1,47 @@
+// Package audit works out what a write changed for the audit log.
+package audit
+
+import (
+	"aging-api/models"
+	"bytes"
+	"encoding/json"
+)
+
+// Diff compares the JSON form of two versions of a document field by field.
+// Either may be nil, for a document being created or deleted; fields that
+// are the same in both are left out.
+func Diff(before interface{}, after interface{}) (map[string]models.Change, error) {
+	previous, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	current, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]models.Change)
+	for name, value := range previous {
+		if !bytes.Equal(value, current[name]) {
+			changes[name] = models.Change{Before: value, After: current[name]}
+		}
+	}
+	for name, value := range current {
+		if _, seen := previous[name]; !seen {
+			changes[name] = models.Change{After: value}
+		}
+	}
+	return changes, nil
+}
+
+func fields(document interface{}) (map[string]json.RawMessage, error) {
+	if document == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	return fields, json.Unmarshal(data, &fields)
+}
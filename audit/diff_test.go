@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"aging-api/models"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before := models.Batch{Volume: 200}
+	after := models.Batch{Volume: 180}
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || string(changes["volume"].Before) != "200" || string(changes["volume"].After) != "180" {
+		t.Errorf("Update: got: %v", changes)
+	}
+
+	changes, err = Diff(nil, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change, ok := changes["volume"]; !ok || change.Before != nil || string(change.After) != "180" {
+		t.Errorf("Create: got: %v", changes)
+	}
+
+	changes, err = Diff(before, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change, ok := changes["volume"]; !ok || string(change.Before) != "200" || change.After != nil {
+		t.Errorf("Delete: got: %v", changes)
+	}
+
+	if changes, _ := Diff(before, before); len(changes) != 0 {
+		t.Errorf("No change: got: %v", changes)
+	}
+}
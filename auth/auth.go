@@ -1,13 +1,15 @@
 package auth
 
 import (
-	"aging-api/api"
-	"net/http"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
-	"regexp"
 	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -22,10 +24,19 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func CreateJWT(userID string) (string, error) {
+// Access tokens are short-lived; a client keeps its session going by
+// exchanging its refresh token for a new pair before the session expires.
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// CreateJWT issues an access token for a user's session.
+func CreateJWT(userID string, sessionID string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
-		"exp":    time.Now().Add(time.Hour * 24 * 7).Unix(),
+		"sid":    sessionID,
+		"exp":    time.Now().Add(AccessTokenTTL).Unix(),
 	})
 
 	tokenString, err := token.SignedString([]byte(os.Getenv("SESSION_SECRET")))
@@ -36,41 +47,61 @@ func CreateJWT(userID string) (string, error) {
 	return tokenString, nil
 }
 
-func DecodeJwt(tokenString string) (string, error) {
+// DecodeJwt returns the user and session IDs of a token signed by
+// CreateJWT. Tokens that are expired, have no expiry or session, or were
+// signed some other way are rejected.
+func DecodeJwt(tokenString string) (string, string, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
 		return []byte(os.Getenv("SESSION_SECRET")), nil
 	})
-
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims["userID"].(string), nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return "", "", errors.New("token is invalid or expired")
 	}
-
-	return "", nil
+	userID, ok := claims["userID"].(string)
+	if !ok {
+		return "", "", errors.New("token has no user")
+	}
+	sessionID, ok := claims["sid"].(string)
+	if !ok {
+		return "", "", errors.New("token has no session")
+	}
+	return userID, sessionID, nil
 }
 
-func Authenticate(c *gin.Context) bool {
-	authHeader := c.Request.Header["Authorization"]
-	if authHeader == nil {
-		api.Respond(c,
-			http.StatusUnauthorized,
-			"Error: No JWT header present",
-			"Error: No JWT header present",
-		)
-		return false
+// NewToken returns a random opaque token to hand to the client, e.g. a
+// refresh token or one mailed to the user.
+func NewToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
 	}
-	r := regexp.MustCompile("Bearer (.+)")
-	jwt := r.FindStringSubmatch(authHeader[0])
-	_, err := DecodeJwt(jwt[1])
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// ApiKeyPrefix marks a bearer credential as an API key rather than a JWT.
+const ApiKeyPrefix = "ak_"
+
+// NewApiKey returns a random API key and the start of it that is kept to
+// identify the key.
+func NewApiKey() (string, string, error) {
+	secret, err := NewToken()
 	if err != nil {
-		api.Respond(c,
-			http.StatusUnauthorized,
-			"Error: JWT not valid",
-			"Error: JWT not valid",
-		)
+		return "", "", err
 	}
-	return true
+	key := ApiKeyPrefix + secret
+	return key, key[:len(ApiKeyPrefix)+8], nil
+}
+
+// HashToken is what is stored in place of a refresh token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
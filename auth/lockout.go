@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"aging-api/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Failures further apart than FailureWindow start the count again.
+	FailureWindow = 15 * time.Minute
+	// The first lock lasts BaseLockout and each one after it twice as long
+	// as the last, up to MaxLockout. A key that has had no failures for
+	// MaxLockout starts again from BaseLockout.
+	BaseLockout = time.Minute
+	MaxLockout  = 24 * time.Hour
+
+	AccountFailureLimit = 5
+	AddressFailureLimit = 20
+)
+
+// RecordFailure counts a failed login against l and locks it once limit
+// failures have been made within the window. It reports whether l is now
+// locked.
+func RecordFailure(l *models.Lockout, limit int, now time.Time) bool {
+	if l.LastFailureAt != 0 {
+		since := now.Sub(l.LastFailureAt.Time())
+		if since > FailureWindow {
+			l.Failures = 0
+		}
+		if since > MaxLockout {
+			l.Lockouts = 0
+		}
+	}
+
+	l.Failures++
+	l.LastFailureAt = primitive.NewDateTimeFromTime(now)
+	if l.Failures < limit {
+		return false
+	}
+
+	l.Failures = 0
+	l.Lockouts++
+	l.LockedAt = primitive.NewDateTimeFromTime(now)
+	l.LockedUntil = primitive.NewDateTimeFromTime(now.Add(LockoutDuration(l.Lockouts)))
+	return true
+}
+
+// Forgotten reports whether l says nothing RecordFailure would not forget
+// at the next failure: it is not locked and its last failure is more than
+// MaxLockout ago. Such a lockout can be removed.
+func Forgotten(l models.Lockout, now time.Time) bool {
+	return !l.Locked(now) && now.Sub(l.LastFailureAt.Time()) > MaxLockout
+}
+
+// LockoutDuration is how long the nth lock of a key lasts.
+func LockoutDuration(n int) time.Duration {
+	duration := BaseLockout
+	for i := 1; i < n && duration < MaxLockout; i++ {
+		duration *= 2
+	}
+	if duration > MaxLockout {
+		return MaxLockout
+	}
+	return duration
+}
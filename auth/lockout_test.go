@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"aging-api/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRecordFailure(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	var lockout models.Lockout
+
+	for i := 1; i < AccountFailureLimit; i++ {
+		if RecordFailure(&lockout, AccountFailureLimit, now) {
+			t.Fatalf("Locked after %d failures", i)
+		}
+	}
+	if !RecordFailure(&lockout, AccountFailureLimit, now) || !lockout.Locked(now) {
+		t.Fatalf("Not locked after %d failures: %+v", AccountFailureLimit, lockout)
+	}
+	if lockout.Locked(now.Add(BaseLockout)) {
+		t.Errorf("Still locked after %v", BaseLockout)
+	}
+
+	later := now.Add(2 * BaseLockout)
+	for i := 0; i < AccountFailureLimit; i++ {
+		RecordFailure(&lockout, AccountFailureLimit, later)
+	}
+	if got := lockout.LockedUntil.Time().Sub(later); got != 2*BaseLockout {
+		t.Errorf("Second lock: got %v, want %v", got, 2*BaseLockout)
+	}
+
+	RecordFailure(&lockout, AccountFailureLimit, later.Add(MaxLockout+time.Minute))
+	if lockout.Failures != 1 || lockout.Lockouts != 0 {
+		t.Errorf("After a quiet day: got %+v", lockout)
+	}
+}
+
+func TestForgotten(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	var lockout models.Lockout
+	RecordFailure(&lockout, AccountFailureLimit, now)
+	if Forgotten(lockout, now.Add(MaxLockout)) {
+		t.Errorf("Forgotten within %v of a failure", MaxLockout)
+	}
+	if !Forgotten(lockout, now.Add(MaxLockout+time.Minute)) {
+		t.Errorf("Not forgotten after a quiet day: %+v", lockout)
+	}
+
+	lockout.LockedUntil = primitive.NewDateTimeFromTime(now.Add(2 * MaxLockout))
+	if Forgotten(lockout, now.Add(MaxLockout+time.Minute)) {
+		t.Errorf("Forgotten while locked: %+v", lockout)
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, BaseLockout},
+		{3, 4 * BaseLockout},
+		{50, MaxLockout},
+	}
+	for _, test := range tests {
+		if got := LockoutDuration(test.n); got != test.want {
+			t.Errorf("LockoutDuration(%d): got %v, want %v", test.n, got, test.want)
+		}
+	}
+}
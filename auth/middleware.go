@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"aging-api/api"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	userKey         = "user"
+	sessionKey      = "session"
+	apiKeyKey       = "apiKey"
+	organisationKey = "organisation"
+)
+
+// OrganisationHeader picks which organisation a request is for when the
+// user belongs to more than one.
+const OrganisationHeader = "X-Organisation-Id"
+
+// errUnauthenticated is any problem with the credentials themselves, as
+// opposed to a failure looking them up.
+var errUnauthenticated = errors.New("invalid or expired credentials")
+
+// Authenticate accepts either an access token for a session that is still
+// active or an API key, sent as "Authorization: Bearer ..." or, for keys,
+// "X-API-Key: ...". It puts the user on the context for CurrentUser, along
+// with the session or key for CurrentSession and CurrentApiKey.
+func Authenticate(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		credential := c.GetHeader("X-API-Key")
+		if credential == "" {
+			header := c.GetHeader("Authorization")
+			if !strings.HasPrefix(header, "Bearer ") {
+				unauthorized(c, "missing bearer token")
+				return
+			}
+			credential = strings.TrimPrefix(header, "Bearer ")
+		}
+
+		var err error
+		if strings.HasPrefix(credential, ApiKeyPrefix) {
+			err = authenticateApiKey(ctx, c, s, credential)
+		} else {
+			err = authenticateToken(ctx, c, s, credential)
+		}
+		if err == errUnauthenticated {
+			unauthorized(c, err.Error())
+			return
+		}
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func authenticateToken(ctx context.Context, c *gin.Context, s *store.Store, token string) error {
+	userId, sessionId, err := DecodeJwt(token)
+	if err != nil {
+		return errUnauthenticated
+	}
+	userObjId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return errUnauthenticated
+	}
+	sessionObjId, err := primitive.ObjectIDFromHex(sessionId)
+	if err != nil {
+		return errUnauthenticated
+	}
+
+	session, err := s.Sessions.FindById(ctx, sessionObjId)
+	if err != nil {
+		return notFoundAsUnauthenticated(err)
+	}
+	if session.UserId != userObjId || !session.Active(time.Now()) {
+		return errUnauthenticated
+	}
+
+	user, err := s.Users.FindById(ctx, userObjId)
+	if err != nil {
+		return notFoundAsUnauthenticated(err)
+	}
+
+	c.Set(userKey, user)
+	c.Set(sessionKey, session)
+	return nil
+}
+
+func authenticateApiKey(ctx context.Context, c *gin.Context, s *store.Store, key string) error {
+	apiKey, err := s.ApiKeys.FindByKeyHash(ctx, HashToken(key))
+	if err != nil {
+		return notFoundAsUnauthenticated(err)
+	}
+	if !apiKey.Active(time.Now()) {
+		return errUnauthenticated
+	}
+
+	user, err := s.Users.FindById(ctx, apiKey.UserId)
+	if err != nil {
+		return notFoundAsUnauthenticated(err)
+	}
+
+	c.Set(userKey, user)
+	c.Set(apiKeyKey, apiKey)
+	return nil
+}
+
+func notFoundAsUnauthenticated(err error) error {
+	if err == store.ErrNotFound {
+		return errUnauthenticated
+	}
+	return err
+}
+
+// Require lets the request through only if the authenticated user's role
+// grants permission and, for API keys, the key is scoped to it. It must run
+// after Authenticate.
+func Require(permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			unauthorized(c, "not authenticated")
+			return
+		}
+
+		if !Can(user.CurrentRole(), permission) {
+			forbidden(c, fmt.Sprintf("role %s does not have permission %s", user.CurrentRole(), permission))
+			return
+		}
+
+		if apiKey, ok := CurrentApiKey(c); ok && !apiKey.HasScope(string(permission)) {
+			forbidden(c, fmt.Sprintf("API key is not scoped to %s", permission))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Allowed reports whether the request may do permission, as Require would,
+// for handlers that show some users more than others.
+func Allowed(c *gin.Context, permission Permission) bool {
+	user, ok := CurrentUser(c)
+	if !ok || !Can(user.CurrentRole(), permission) {
+		return false
+	}
+	apiKey, ok := CurrentApiKey(c)
+	return !ok || apiKey.HasScope(string(permission))
+}
+
+// RequireOrganisation settles which organisation the request acts on: the
+// one named in the X-Organisation-Id header, or else the user's only one.
+// Users must be members of it, except admins, who may act on any. It must
+// run after Authenticate.
+func RequireOrganisation(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := CurrentUser(c)
+		if !ok {
+			unauthorized(c, "not authenticated")
+			return
+		}
+
+		memberships, err := s.Memberships.FindByUser(ctx, user.Id)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			c.Abort()
+			return
+		}
+
+		header := c.GetHeader(OrganisationHeader)
+		if header == "" {
+			switch len(memberships) {
+			case 0:
+				forbidden(c, "not a member of any organisation")
+			case 1:
+				c.Set(organisationKey, memberships[0].OrganisationId)
+				c.Next()
+			default:
+				api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("%s is required for members of several organisations", OrganisationHeader))
+				c.Abort()
+			}
+			return
+		}
+
+		organisationId, err := primitive.ObjectIDFromHex(header)
+		if err != nil {
+			forbidden(c, "not a member of that organisation")
+			return
+		}
+		member := false
+		for _, membership := range memberships {
+			member = member || membership.OrganisationId == organisationId
+		}
+		if !member && user.CurrentRole() == models.RoleAdmin {
+			_, err := s.Organisations.FindById(ctx, organisationId)
+			if err != nil && err != store.ErrNotFound {
+				api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+				c.Abort()
+				return
+			}
+			member = err == nil
+		}
+		if !member {
+			forbidden(c, "not a member of that organisation")
+			return
+		}
+
+		c.Set(organisationKey, organisationId)
+		c.Next()
+	}
+}
+
+// CurrentUser is the user Authenticate found for the request.
+func CurrentUser(c *gin.Context) (models.User, bool) {
+	value, ok := c.Get(userKey)
+	if !ok {
+		return models.User{}, false
+	}
+	user, ok := value.(models.User)
+	return user, ok
+}
+
+// CurrentSession is the session the request's access token belongs to. It
+// is not set for requests made with an API key.
+func CurrentSession(c *gin.Context) (models.Session, bool) {
+	value, ok := c.Get(sessionKey)
+	if !ok {
+		return models.Session{}, false
+	}
+	session, ok := value.(models.Session)
+	return session, ok
+}
+
+// CurrentApiKey is the API key the request was made with, if any.
+func CurrentApiKey(c *gin.Context) (models.ApiKey, bool) {
+	value, ok := c.Get(apiKeyKey)
+	if !ok {
+		return models.ApiKey{}, false
+	}
+	apiKey, ok := value.(models.ApiKey)
+	return apiKey, ok
+}
+
+// CurrentOrganisation is the organisation RequireOrganisation settled on.
+func CurrentOrganisation(c *gin.Context) (primitive.ObjectID, bool) {
+	value, ok := c.Get(organisationKey)
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+	organisationId, ok := value.(primitive.ObjectID)
+	return organisationId, ok
+}
+
+func forbidden(c *gin.Context, message string) {
+	api.Respond(c, http.StatusForbidden, "error", message)
+	c.Abort()
+}
+
+func unauthorized(c *gin.Context, message string) {
+	api.Respond(c, http.StatusUnauthorized, "error", message)
+	c.Abort()
+}
@@ -0,0 +1,62 @@
+package auth
+
+import "aging-api/models"
+
+// Permission is an action on a kind of resource, written resource:action.
+type Permission string
+
+const (
+	ReadSpirits       Permission = "spirits:read"
+	WriteSpirits      Permission = "spirits:write"
+	ReadBatches       Permission = "batches:read"
+	WriteBatches      Permission = "batches:write"
+	ReadVessels       Permission = "vessels:read"
+	WriteVessels      Permission = "vessels:write"
+	ReadMeasurements  Permission = "measurements:read"
+	WriteMeasurements Permission = "measurements:write"
+	ReadReports       Permission = "reports:read"
+	ReadAudit         Permission = "audit:read"
+	ManageDescriptors Permission = "descriptors:manage"
+	ManageTastings    Permission = "tastings:manage"
+	ManageUsers       Permission = "users:manage"
+)
+
+var permissions = []Permission{
+	ReadSpirits, WriteSpirits, ReadBatches, WriteBatches, ReadVessels, WriteVessels,
+	ReadMeasurements, WriteMeasurements, ReadReports, ReadAudit, ManageDescriptors, ManageTastings, ManageUsers,
+}
+
+func IsPermission(permission string) bool {
+	return hasPermission(permissions, Permission(permission))
+}
+
+var readPermissions = []Permission{ReadSpirits, ReadBatches, ReadVessels, ReadMeasurements, ReadReports}
+
+// rolePermissions lists what each role may do besides reading. Admins may
+// do everything.
+var rolePermissions = map[string][]Permission{
+	models.RoleCellarMaster: {WriteSpirits, WriteBatches, WriteVessels, WriteMeasurements, ReadAudit, ManageDescriptors, ManageTastings},
+	models.RoleTaster:       {WriteMeasurements},
+	models.RoleReadOnly:     {},
+}
+
+// Can reports whether a user with role may do permission.
+func Can(role string, permission Permission) bool {
+	if role == models.RoleAdmin {
+		return true
+	}
+	granted, ok := rolePermissions[role]
+	if !ok {
+		return false
+	}
+	return hasPermission(readPermissions, permission) || hasPermission(granted, permission)
+}
+
+func hasPermission(permissions []Permission, permission Permission) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
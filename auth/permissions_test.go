@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"aging-api/models"
+	"testing"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission Permission
+		want       bool
+	}{
+		{models.RoleAdmin, ManageUsers, true},
+		{models.RoleCellarMaster, WriteVessels, true},
+		{models.RoleCellarMaster, ManageUsers, false},
+		{models.RoleTaster, WriteMeasurements, true},
+		{models.RoleTaster, WriteBatches, false},
+		{models.RoleTaster, ReadReports, true},
+		{models.RoleCellarMaster, ReadAudit, true},
+		{models.RoleTaster, ReadAudit, false},
+		{models.RoleCellarMaster, ManageDescriptors, true},
+		{models.RoleCellarMaster, ManageTastings, true},
+		{models.RoleTaster, ManageTastings, false},
+		{models.RoleReadOnly, ReadSpirits, true},
+		{models.RoleReadOnly, WriteMeasurements, false},
+		{"", ReadSpirits, false},
+		{"owner", ReadSpirits, false},
+	}
+	for _, test := range tests {
+		if got := Can(test.role, test.permission); got != test.want {
+			t.Errorf("Can(%q, %q): got %v, want %v", test.role, test.permission, got, test.want)
+		}
+	}
+}
@@ -2,16 +2,93 @@ package configs
 
 import (
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/joho/godotenv"
 )
 
-func EnvMongoURI() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+var loadEnvOnce sync.Once
+
+func loadEnv() {
+	loadEnvOnce.Do(func() {
+		err := godotenv.Load()
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal("Error loading .env file")
+		}
+	})
+}
+
+// EnvDatabaseDriver defaults to Mongo, as the API always has. With neither
+// DATABASE_DRIVER nor DATABASE_URI set it fails rather than guess, so that a
+// deployment that has lost its settings does not start on an empty database.
+func EnvDatabaseDriver() string {
+	loadEnv()
+	if driver := os.Getenv("DATABASE_DRIVER"); driver != "" {
+		return driver
+	}
+	if os.Getenv("DATABASE_URI") == "" {
+		log.Fatal("Set DATABASE_URI to a Mongo connection string, or DATABASE_DRIVER to sqlite, postgres or memory")
+	}
+	return "mongo"
+}
+
+func EnvDatabaseURI() string {
+	loadEnv()
+	if uri := os.Getenv("DATABASE_URI"); uri != "" {
+		return uri
+	}
+	if EnvDatabaseDriver() == "sqlite" {
+		return "aging.db"
+	}
+	return ""
+}
+
+func EnvAutoMigrate() bool {
+	loadEnv()
+	return os.Getenv("DATABASE_AUTO_MIGRATE") != "false"
+}
+
+// EnvTrustedProxies lists the addresses or CIDR ranges of the proxies in
+// front of the API, from the comma-separated TRUSTED_PROXIES. Only their
+// X-Forwarded-For is believed when working out a client's address; by
+// default no proxy is trusted and the address is the connection's own.
+func EnvTrustedProxies() []string {
+	loadEnv()
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			log.Fatalf("TRUSTED_PROXIES must list addresses or CIDR ranges, got %q", proxy)
+		}
+		proxies = append(proxies, proxy)
 	}
+	return proxies
+}
 
-	return os.Getenv("DATABASE_URI")
+// EnvMailFile is where development mail is written; when unset it is
+// logged instead.
+func EnvMailFile() string {
+	loadEnv()
+	return os.Getenv("MAIL_FILE")
+}
+
+// EnvRetentionDays is how long deleted records can be restored before they
+// are purged; 0, the default, keeps them forever.
+func EnvRetentionDays() int {
+	loadEnv()
+	value := os.Getenv("RETENTION_DAYS")
+	if value == "" {
+		return 0
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		log.Fatalf("RETENTION_DAYS must be a whole number of days, got %q", value)
+	}
+	return days
 }
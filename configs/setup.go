@@ -1,7 +1,13 @@
 package configs
 
 import (
+	"aging-api/mail"
+	"aging-api/store"
+	"aging-api/store/memstore"
+	"aging-api/store/mongostore"
+	"aging-api/store/sqlstore"
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"time"
@@ -11,12 +17,13 @@ import (
 )
 
 func ConnectDB() *mongo.Client {
-	client, err := mongo.NewClient(options.Client().ApplyURI(EnvMongoURI()))
+	client, err := mongo.NewClient(options.Client().ApplyURI(EnvDatabaseURI()))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 	err = client.Connect(ctx)
 	if err != nil {
 		log.Fatal(err)
@@ -30,9 +37,60 @@ func ConnectDB() *mongo.Client {
 	return client
 }
 
-var DB *mongo.Client = ConnectDB()
+func ConnectStore() *store.Store {
+	switch driver := EnvDatabaseDriver(); driver {
+	case "memory":
+		fmt.Println("Using in-memory store")
+		return memstore.New()
+	case "mongo":
+		return connectMongoStore()
+	case "sqlite", "postgres":
+		db := ConnectSQL()
+		if EnvAutoMigrate() {
+			MigrateSQL(db)
+		}
+		return sqlstore.New(db)
+	default:
+		log.Fatalf("Unknown DATABASE_DRIVER %q", driver)
+		return nil
+	}
+}
+
+func connectMongoStore() *store.Store {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := mongostore.New(ctx, ConnectDB(), "main")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return s
+}
+
+func ConnectSQL() *sql.DB {
+	driver := EnvDatabaseDriver()
+	db, err := sqlstore.Open(driver, EnvDatabaseURI())
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Connected to %s\n", driver)
+	return db
+}
+
+func MigrateSQL(db *sql.DB) {
+	applied, err := sqlstore.Migrate(context.Background(), db)
+	for _, name := range applied {
+		fmt.Printf("Applied migration %s\n", name)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-func GetCollection(client *mongo.Client, collectionName string) *mongo.Collection {
-	collection := client.Database("main").Collection(collectionName)
-	return collection
+func MailSender() mail.Sender {
+	if path := EnvMailFile(); path != "" {
+		fmt.Printf("Writing mail to %s\n", path)
+		return &mail.FileSender{Path: path}
+	}
+	return mail.LogSender{}
 }
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/mail"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var userTokenTTL = map[string]time.Duration{
+	models.TokenVerifyEmail:   48 * time.Hour,
+	models.TokenResetPassword: time.Hour,
+}
+
+// accountMailSent is the reply whether or not the address has an account,
+// so these endpoints cannot be used to find out who has one.
+const accountMailSent = "if that address has an account, an email is on its way"
+
+var errInvalidUserToken = invalidQueryError{errors.New("token is invalid or has expired")}
+
+type emailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type verifyRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type resetRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// sendUserToken mails the user a single-use token for purpose.
+func sendUserToken(ctx context.Context, s *store.Store, sender mail.Sender, user models.User, purpose string) error {
+	token, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	userToken := models.UserToken{
+		Id:        primitive.NewObjectID(),
+		CreatedAt: primitive.NewDateTimeFromTime(now),
+		UserId:    user.Id,
+		Purpose:   purpose,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: primitive.NewDateTimeFromTime(now.Add(userTokenTTL[purpose])),
+	}
+	if err := s.UserTokens.Create(ctx, &userToken); err != nil {
+		return err
+	}
+
+	message := mail.Message{To: user.Email}
+	switch purpose {
+	case models.TokenVerifyEmail:
+		message.Subject = "Verify your email address"
+		message.Body = fmt.Sprintf("To finish signing up, send this token to POST /api/v1/email/verify within %v:\n\n%s", userTokenTTL[purpose], token)
+	case models.TokenResetPassword:
+		message.Subject = "Reset your password"
+		message.Body = fmt.Sprintf("To choose a new password, send this token with it to POST /api/v1/password/reset within %v:\n\n%s\n\nIf you did not ask for this, ignore this email.", userTokenTTL[purpose], token)
+	}
+	return sender.Send(ctx, message)
+}
+
+// useUserToken marks a mailed token used and returns it, or fails if it is
+// unknown, expired, already used or for something else. Marking it used
+// succeeds only for the first of two requests racing with the same token.
+func useUserToken(ctx context.Context, s *store.Store, token string, purpose string) (models.UserToken, error) {
+	userToken, err := s.UserTokens.FindByTokenHash(ctx, auth.HashToken(token))
+	if err == store.ErrNotFound {
+		return userToken, errInvalidUserToken
+	}
+	if err != nil {
+		return userToken, err
+	}
+	if !userToken.Usable(purpose, time.Now()) {
+		return userToken, errInvalidUserToken
+	}
+
+	userToken.UsedAt = primitive.NewDateTimeFromTime(time.Now())
+	err = s.UserTokens.MarkUsed(ctx, userToken.Id, userToken.UsedAt)
+	if err == store.ErrNotFound {
+		return userToken, errInvalidUserToken
+	}
+	return userToken, err
+}
+
+func VerifyEmail(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request verifyRequest
+		defer cancel()
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		userToken, err := useUserToken(ctx, s, request.Token, models.TokenVerifyEmail)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		user, err := s.Users.FindById(ctx, userToken.UserId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		user.EmailVerified = true
+		if err := s.Users.Update(ctx, &user); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", "email verified")
+	}
+}
+
+func ResendVerification(s *store.Store, sender mail.Sender) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request emailRequest
+		defer cancel()
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		user, err := s.Users.FindByEmail(ctx, request.Email)
+		if err == nil && !user.EmailVerified {
+			err = sendUserToken(ctx, s, sender, user, models.TokenVerifyEmail)
+		}
+		if err != nil && err != store.ErrNotFound {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", accountMailSent)
+	}
+}
+
+func ForgotPassword(s *store.Store, sender mail.Sender) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request emailRequest
+		defer cancel()
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		user, err := s.Users.FindByEmail(ctx, request.Email)
+		if err == nil {
+			err = sendUserToken(ctx, s, sender, user, models.TokenResetPassword)
+		}
+		if err != nil && err != store.ErrNotFound {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", accountMailSent)
+	}
+}
+
+// ResetPassword sets a new password with a mailed token and signs the user
+// out everywhere. Receiving the mail also proves the address is theirs.
+func ResetPassword(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request resetRequest
+		defer cancel()
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		passHash, err := auth.HashPassword(request.Password)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		userToken, err := useUserToken(ctx, s, request.Token, models.TokenResetPassword)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		user, err := s.Users.FindById(ctx, userToken.UserId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		user.Password = passHash
+		user.EmailVerified = true
+		if err := s.Users.Update(ctx, &user); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if _, err := revokeSessions(ctx, s, user.Id); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", "password reset")
+	}
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"aging-api/models"
+	"aging-api/store"
+	"aging-api/units"
+	"context"
+	"math"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const latest = primitive.DateTime(math.MaxInt64)
+
+// alcoholContent fills in the Alcohol field of responses in the unit asked
+// for with ?units=. Volumes are stored in litres.
+type alcoholContent struct {
+	unit units.Unit
+	abv  strengths
+}
+
+func newAlcoholContent(ctx context.Context, c *gin.Context, s *store.Store) (*alcoholContent, error) {
+	unit, err := units.Parse(c.Query("units"))
+	if err != nil {
+		return nil, invalidQueryError{err}
+	}
+	measurements, err := s.Measurements.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	abv, err := loadStrengths(ctx, s, measurements)
+	if err != nil {
+		return nil, err
+	}
+	return &alcoholContent{unit: unit, abv: abv}, nil
+}
+
+func (a *alcoholContent) content(litres float32, abv float64) *units.Content {
+	content := units.NewContent(float64(litres), abv, a.unit)
+	return &content
+}
+
+func (a *alcoholContent) spirit(spirit *models.Spirit) {
+	abv := float64(spirit.InitialABV)
+	var date primitive.DateTime
+	for _, batchId := range spirit.BatchIds {
+		readings := a.abv.readings[batchId]
+		if len(readings) > 0 && measurementDate(readings[len(readings)-1]) >= date {
+			date = measurementDate(readings[len(readings)-1])
+			abv = float64(readings[len(readings)-1].ABV)
+		}
+	}
+	spirit.Alcohol = a.content(spirit.Volume, abv)
+}
+
+func (a *alcoholContent) batch(batch *models.Batch) {
+	batch.Alcohol = a.content(batch.Volume, a.abv.at(batch.Id, latest))
+}
+
+// vessel uses the latest reading taken in the vessel, falling back to the
+// strength of the batch most recently put into it.
+func (a *alcoholContent) vessel(vessel *models.Vessel) {
+	var abv float64
+	if readings := a.abv.vessels[vessel.Id]; len(readings) > 0 {
+		abv = float64(readings[len(readings)-1].ABV)
+	} else if len(vessel.BatchIds) > 0 {
+		abv = a.abv.at(vessel.BatchIds[len(vessel.BatchIds)-1], latest)
+	}
+	vessel.Alcohol = a.content(vessel.FillLevel, abv)
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type createdApiKey struct {
+	// Key is only ever returned here; it cannot be recovered later.
+	Key    string        `json:"key"`
+	ApiKey models.ApiKey `json:"apiKey"`
+}
+
+// sessionUser is the user behind a request made by logging in. Keys are
+// managed by people, so requests made with an API key are refused.
+func sessionUser(c *gin.Context) (models.User, bool) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		api.Respond(c, http.StatusUnauthorized, "error", "not authenticated")
+		return user, false
+	}
+	if _, usingKey := auth.CurrentApiKey(c); usingKey {
+		api.Respond(c, http.StatusForbidden, "error", "API keys cannot manage API keys")
+		return user, false
+	}
+	return user, true
+}
+
+func CreateApiKey(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request models.ApiKey
+		defer cancel()
+
+		user, ok := sessionUser(c)
+		if !ok {
+			return
+		}
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		for _, scope := range request.Scopes {
+			if !auth.IsPermission(scope) {
+				api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("unknown scope %q", scope))
+				return
+			}
+			if !auth.Can(user.CurrentRole(), auth.Permission(scope)) {
+				api.Respond(c, http.StatusForbidden, "error", fmt.Sprintf("role %s cannot grant %s", user.CurrentRole(), scope))
+				return
+			}
+		}
+
+		if request.ExpiresAt != 0 && !request.ExpiresAt.Time().After(time.Now()) {
+			api.Respond(c, http.StatusBadRequest, "error", "expiresAt must be in the future")
+			return
+		}
+
+		key, prefix, err := auth.NewApiKey()
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		newApiKey := models.ApiKey{
+			Id:        primitive.NewObjectID(),
+			CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+			UserId:    user.Id,
+			Label:     request.Label,
+			Prefix:    prefix,
+			KeyHash:   auth.HashToken(key),
+			Scopes:    unique(request.Scopes),
+			ExpiresAt: request.ExpiresAt,
+		}
+
+		if err := s.ApiKeys.Create(ctx, &newApiKey); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusCreated, "success", createdApiKey{Key: key, ApiKey: newApiKey})
+	}
+}
+
+func GetApiKeys(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := sessionUser(c)
+		if !ok {
+			return
+		}
+
+		keys, err := s.ApiKeys.FindByUser(ctx, user.Id)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", keys)
+	}
+}
+
+// revokeApiKeys revokes every active API key of a user and returns how
+// many it revoked.
+func revokeApiKeys(ctx context.Context, s *store.Store, userId primitive.ObjectID) (int, error) {
+	keys, err := s.ApiKeys.FindByUser(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	revoked := 0
+	for _, key := range keys {
+		if !key.Active(now) {
+			continue
+		}
+		key.RevokedAt = primitive.NewDateTimeFromTime(now)
+		if err := s.ApiKeys.Update(ctx, &key); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+func RevokeApiKey(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := sessionUser(c)
+		if !ok {
+			return
+		}
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		apiKey, err := s.ApiKeys.FindById(ctx, objId)
+		if err == nil && apiKey.UserId != user.Id {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if apiKey.RevokedAt == 0 {
+			apiKey.RevokedAt = primitive.NewDateTimeFromTime(time.Now())
+			if err := s.ApiKeys.Update(ctx, &apiKey); err != nil {
+				api.Respond(c, statusFor(err), "error", err.Error())
+				return
+			}
+		}
+
+		api.Respond(c, http.StatusOK, "success", apiKey)
+	}
+}
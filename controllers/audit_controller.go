@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/store"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetAuditLog lists the writes made to the organisation's records, oldest
+// first. ?entity=batch narrows it to one kind of record and &id= to one
+// record. Entries for tasting sessions hide what the session would hide
+// from the reader.
+func GetAuditLog(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		entity := c.Query("entity")
+		if entity != "" && !store.IsEntity(entity) {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("unknown entity %q", entity))
+			return
+		}
+
+		var entityId *primitive.ObjectID
+		if hex := c.Query("id"); hex != "" {
+			if entity == "" {
+				api.Respond(c, http.StatusBadRequest, "error", "id needs an entity")
+				return
+			}
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("invalid id %q", hex))
+				return
+			}
+			entityId = &id
+		}
+
+		organisationId, _ := auth.CurrentOrganisation(c)
+		entries, err := s.Audit.Find(ctx, organisationId, entity, entityId)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		if entries, err = redactTastings(ctx, c, scoped(c, s), entries); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", entries)
+	}
+}
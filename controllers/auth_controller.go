@@ -4,19 +4,43 @@ import (
 	"aging-api/api"
 	"aging-api/auth"
 	"aging-api/models"
+	"aging-api/store"
 	"context"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func Login() gin.HandlerFunc {
+// loginFailed is the reply to any wrong email or password, so a login
+// attempt does not reveal whether an account exists.
+const loginFailed = "invalid email or password"
+
+// dummyHash is checked against when there is no such account so that a
+// failed login takes as long either way.
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+func passwordHashFor(user models.User, exists bool) string {
+	if exists {
+		return user.Password
+	}
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = auth.HashPassword("not a password")
+	})
+	return dummyHash
+}
+
+func Login(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		var requestBody models.User
-		var fetchedUser models.User
 		defer cancel()
 
 		if err := c.BindJSON(&requestBody); err != nil {
@@ -29,29 +53,45 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
-		if err := userCollection.FindOne(ctx, bson.M{"email": requestBody.Email}).Decode(&fetchedUser); err != nil {
-			api.Respond(
-				c,
-				http.StatusNotFound,
-				"Account not found",
-				err.Error(),
-			)
+		keys := loginKeys(requestBody.Email, c.ClientIP())
+		retryAfter, err := lockedFor(ctx, s, keys, time.Now())
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		if retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			api.Respond(c, http.StatusTooManyRequests, "Not authorized", "too many failed logins; try again later")
 			return
 		}
 
-		if authorized := auth.CheckPasswordHash(requestBody.Password, fetchedUser.Password); authorized == false {
-			api.Respond(
-				c,
-				http.StatusUnauthorized,
-				"Not authorized",
-				"Incorrect password",
-			)
+		fetchedUser, err := s.Users.FindByEmail(ctx, requestBody.Email)
+		if err != nil && err != store.ErrNotFound {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		exists := err == nil
+
+		if authorized := auth.CheckPasswordHash(requestBody.Password, passwordHashFor(fetchedUser, exists)); !authorized || !exists {
+			if err := recordLoginFailure(ctx, s, keys, time.Now()); err != nil {
+				api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+				return
+			}
+			api.Respond(c, http.StatusUnauthorized, "Not authorized", loginFailed)
+			return
+		}
+
+		if err := clearLoginFailures(ctx, s, keys.account); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
 			return
 		}
 
-		// create JWT token
-		token, err := auth.CreateJWT(fetchedUser.Id.Hex())
+		if !fetchedUser.EmailVerified {
+			api.Respond(c, http.StatusForbidden, "Not authorized", "email address has not been verified")
+			return
+		}
 
+		_, tokens, err := startSession(ctx, s, fetchedUser.Id)
 		if err != nil {
 			api.Respond(
 				c,
@@ -62,8 +102,194 @@ func Login() gin.HandlerFunc {
 			return
 		}
 		api.Respond(
-			c, http.StatusOK, "success", token,
+			c, http.StatusOK, "success", tokens,
 		)
 		return
 	}
 }
+
+// refreshMu stops two requests exchanging the same refresh token at once.
+var refreshMu sync.Mutex
+
+type tokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+func startSession(ctx context.Context, s *store.Store, userId primitive.ObjectID) (models.Session, tokenResponse, error) {
+	refreshToken, err := auth.NewToken()
+	if err != nil {
+		return models.Session{}, tokenResponse{}, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		Id:        primitive.NewObjectID(),
+		CreatedAt: primitive.NewDateTimeFromTime(now),
+		UserId:    userId,
+		TokenHash: auth.HashToken(refreshToken),
+		ExpiresAt: primitive.NewDateTimeFromTime(now.Add(auth.RefreshTokenTTL)),
+	}
+	if err := s.Sessions.Create(ctx, &session); err != nil {
+		return session, tokenResponse{}, err
+	}
+
+	accessToken, err := auth.CreateJWT(userId.Hex(), session.Id.Hex())
+	if err != nil {
+		return session, tokenResponse{}, err
+	}
+	return session, tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeSessions ends every active session of a user and returns how many
+// there were.
+func revokeSessions(ctx context.Context, s *store.Store, userId primitive.ObjectID) (int, error) {
+	sessions, err := s.Sessions.FindByUser(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	revoked := 0
+	for _, session := range sessions {
+		if !session.Active(now) {
+			continue
+		}
+		session.RevokedAt = primitive.NewDateTimeFromTime(now)
+		if err := s.Sessions.Update(ctx, &session); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh
+// token. Each refresh token works once; presenting one that has already
+// been exchanged is taken as a sign it was stolen and ends all of the
+// user's sessions.
+func RefreshToken(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request refreshRequest
+		defer cancel()
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		refreshMu.Lock()
+		defer refreshMu.Unlock()
+
+		session, err := s.Sessions.FindByTokenHash(ctx, auth.HashToken(request.RefreshToken))
+		if err == store.ErrNotFound {
+			api.Respond(c, http.StatusUnauthorized, "error", "invalid refresh token")
+			return
+		}
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		if session.ReplacedBy != nil {
+			if _, err := revokeSessions(ctx, s, session.UserId); err != nil {
+				api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+				return
+			}
+			api.Respond(c, http.StatusUnauthorized, "error", "refresh token has already been used")
+			return
+		}
+		if !session.Active(time.Now()) {
+			api.Respond(c, http.StatusUnauthorized, "error", "session has ended")
+			return
+		}
+
+		if _, err := s.Users.FindById(ctx, session.UserId); err != nil {
+			api.Respond(c, http.StatusUnauthorized, "error", "session has ended")
+			return
+		}
+
+		next, tokens, err := startSession(ctx, s, session.UserId)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		session.RevokedAt = primitive.NewDateTimeFromTime(time.Now())
+		session.ReplacedBy = &next.Id
+		if err := s.Sessions.Update(ctx, &session); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", tokens)
+	}
+}
+
+// Logout ends the session the request's access token belongs to.
+func Logout(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		session, ok := auth.CurrentSession(c)
+		if !ok {
+			api.Respond(c, http.StatusUnauthorized, "error", "not authenticated")
+			return
+		}
+
+		session.RevokedAt = primitive.NewDateTimeFromTime(time.Now())
+		if err := s.Sessions.Update(ctx, &session); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", "logged out")
+	}
+}
+
+// RevokeUserSessions lets an admin sign a user out everywhere, e.g. when
+// they leave: it ends their sessions and revokes their API keys.
+func RevokeUserSessions(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if _, err := s.Users.FindById(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		revoked, err := revokeSessions(ctx, s, objId)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		revokedKeys, err := revokeApiKeys(ctx, s, objId)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", map[string]int{"revoked": revoked, "revokedApiKeys": revokedKeys})
+	}
+}
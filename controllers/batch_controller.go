@@ -2,25 +2,27 @@ package controllers
 
 import (
 	"aging-api/api"
-	"aging-api/configs"
 	"aging-api/models"
 	"aging-api/responses"
+	"aging-api/store"
 	"context"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var batchCollection *mongo.Collection = configs.GetCollection(configs.DB, "batches")
 var validateBatch = validator.New()
 
-func CreateBatch() gin.HandlerFunc {
+// movedVessels turns away a request that sets a batch's vessels directly.
+const movedVessels = "a batch's vessels change only through /fill, /transfer and /dump"
+
+// CreateBatch adds a batch with no vessels; it goes into them by /fill.
+func CreateBatch(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		var batch models.Batch
 		defer cancel()
@@ -35,47 +37,120 @@ func CreateBatch() gin.HandlerFunc {
 			return
 		}
 
+		if len(batch.VesselIds) > 0 {
+			api.Respond(c, http.StatusBadRequest, "error", movedVessels)
+			return
+		}
+
 		newBatch := models.Batch{
-			Id:           primitive.NewObjectID(),
-			Vessels:      batch.Vessels,
-			Measurements: batch.Measurements,
-			CreatedAt:    primitive.NewDateTimeFromTime(time.Now()),
-			Volume:       batch.Volume,
+			Id:             primitive.NewObjectID(),
+			MeasurementIds: unique(batch.MeasurementIds),
+			CreatedAt:      primitive.NewDateTimeFromTime(time.Now()),
+			Volume:         batch.Volume,
 		}
 
-		result, err := batchCollection.InsertOne(ctx, newBatch)
-		if err != nil {
+		if err := checkBatchReferences(ctx, s, &newBatch); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if err := s.Batches.Create(ctx, &newBatch); err != nil {
 			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
 			return
 		}
 
-		api.Respond(c, http.StatusCreated, "success", result.InsertedID)
+		api.Respond(c, http.StatusCreated, "success", newBatch.Id)
 		return
 	}
 }
 
-func GetBatch() gin.HandlerFunc {
+// ListBatches lists batches a page at a time, filtered and sorted on any of
+// their fields.
+func ListBatches(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		s, err := pointInTime(c, s)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		batches, err := s.Batches.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		found, err := page(c, batches)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		alcohol, err := newAlcoholContent(ctx, c, s)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		expand := expansions(c)
+		for i := range found.Items {
+			if err := expandBatch(ctx, s, &found.Items[i], expand); err != nil {
+				api.Respond(c, statusFor(err), "error", err.Error())
+				return
+			}
+			alcohol.batch(&found.Items[i])
+		}
+
+		api.RespondPage(c, found.Items, found.Total, found.NextCursor)
+	}
+}
+
+func GetBatch(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
+		s, err := pointInTime(c, s)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		batchId := c.Param("id")
-		var batch models.Batch
 		defer cancel()
 
 		objId, _ := primitive.ObjectIDFromHex(batchId)
 
-		err := batchCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&batch)
+		batch, err := s.Batches.FindById(ctx, objId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
+		if err := expandBatch(ctx, s, &batch, expansions(c)); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		alcohol, err := newAlcoholContent(ctx, c, s)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+		alcohol.batch(&batch)
+
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": batch}})
 		return
 	}
 }
 
-func UpdateBatch() gin.HandlerFunc {
+// UpdateBatch changes a batch's volume and measurements. Its vessels follow
+// its fills, transfers and dumps, so vesselIds may only be sent back as they
+// are.
+func UpdateBatch(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		batchId := c.Param("id")
 		var batch models.Batch
@@ -93,28 +168,28 @@ func UpdateBatch() gin.HandlerFunc {
 			return
 		}
 
-		update := bson.M{
-			"Vessels":      batch.Vessels,
-			"Measurements": batch.Measurements,
-			"Volume":       batch.Volume,
+		updatedBatch, err := s.Batches.FindById(ctx, objId)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
 		}
 
-		result, err := batchCollection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": update})
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+		if batch.VesselIds != nil && !sameIds(batch.VesselIds, updatedBatch.VesselIds) {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"data": movedVessels}})
 			return
 		}
 
-		var updatedBatch models.Batch
+		updatedBatch.MeasurementIds = unique(batch.MeasurementIds)
+		updatedBatch.Volume = batch.Volume
 
-		if result.MatchedCount == 1 {
-			err := batchCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&updatedBatch)
+		if err := checkBatchReferences(ctx, s, &updatedBatch); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
 
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
-				return
-			}
+		if err := s.Batches.Update(ctx, &updatedBatch); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
 		}
 
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": updatedBatch}})
@@ -123,23 +198,24 @@ func UpdateBatch() gin.HandlerFunc {
 	}
 }
 
-func DeleteBatch() gin.HandlerFunc {
+func DeleteBatch(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		batchId := c.Param("id")
 		defer cancel()
 
 		objId, _ := primitive.ObjectIDFromHex(batchId)
 
-		result, err := batchCollection.DeleteOne(ctx, bson.M{"_id": objId})
+		err := softDelete[models.Batch](ctx, c, s.Batches, objId)
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "batch not found"}})
 			return
 		}
 
-		if result.DeletedCount < 1 {
-			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "batch not found"}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
@@ -149,3 +225,10 @@ func DeleteBatch() gin.HandlerFunc {
 		return
 	}
 }
+
+func checkBatchReferences(ctx context.Context, s *store.Store, batch *models.Batch) error {
+	if err := checkReferences[models.Vessel](ctx, "vessel", s.Vessels, batch.VesselIds); err != nil {
+		return err
+	}
+	return checkReferences[models.Measurement](ctx, "measurement", s.Measurements, batch.MeasurementIds)
+}
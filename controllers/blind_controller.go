@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sampleCode draws a three-digit code no other sample of the session has,
+// so that codes say nothing of what was poured or in what order.
+func sampleCode(samples []models.TastingSample) (string, error) {
+	for {
+		n, err := rand.Int(rand.Reader, big.NewInt(900))
+		if err != nil {
+			return "", err
+		}
+		code := strconv.FormatInt(n.Int64()+100, 10)
+		taken := false
+		for _, sample := range samples {
+			taken = taken || sample.Code == code
+		}
+		if !taken {
+			return code, nil
+		}
+	}
+}
+
+// notOrganiser refuses a change to a session from someone tasting at it.
+const notOrganiser = "only those running a tasting session, and not on its panel, can change it"
+
+// organises reports whether the request is from someone running the
+// session rather than tasting at it: anyone not on its panel who owns it or
+// may manage tastings. An owner who sits on their own panel tastes blind
+// like everyone else on it.
+func organises(c *gin.Context, session models.TastingSession) bool {
+	user, _ := auth.CurrentUser(c)
+	if containsId(session.PanelIds, user.Id) {
+		return false
+	}
+	return user.Id == session.OwnerId || auth.Allowed(c, auth.ManageTastings)
+}
+
+// identifies reports whether the request may know which batch and vessel
+// each sample came from.
+func identifies(c *gin.Context, session models.TastingSession) bool {
+	return !session.Blind || session.Revealed() || organises(c, session)
+}
+
+// tasterView is a session as the panel sees it. Until the session is
+// closed a panellist sees only their own scores, and until a blind session
+// is revealed its samples are known only by their codes, in code order.
+func tasterView(c *gin.Context, session models.TastingSession) models.TastingSession {
+	if !session.Closed() && !organises(c, session) {
+		user, _ := auth.CurrentUser(c)
+		own := make([]models.TastingScore, 0)
+		for _, score := range session.Scores {
+			if score.TasterId == user.Id {
+				own = append(own, score)
+			}
+		}
+		session.Scores = own
+	}
+	if !identifies(c, session) {
+		samples := make([]models.TastingSample, len(session.Samples))
+		for i, sample := range session.Samples {
+			samples[i] = models.TastingSample{Id: sample.Id, Code: sample.Code}
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i].Code < samples[j].Code })
+		session.Samples = samples
+	}
+	return session
+}
+
+// resultsFor is panelResults with the samples of a blind session hidden in
+// the same way as tasterView hides them.
+func resultsFor(c *gin.Context, session models.TastingSession) tastingResults {
+	results := panelResults(session)
+	if !identifies(c, session) {
+		for i := range results.Samples {
+			results.Samples[i].BatchId, results.Samples[i].VesselId = nil, nil
+		}
+		sort.Slice(results.Samples, func(i, j int) bool { return results.Samples[i].Code < results.Samples[j].Code })
+	}
+	return results
+}
+
+// redactTastings hides from the audit log what the session itself would hide
+// from the reader: the scores of a session still open, and which batch and
+// vessel each sample of a blind session came from until it is revealed. A
+// session since deleted is hidden from everyone, as there is no longer any
+// telling who ran it.
+func redactTastings(ctx context.Context, c *gin.Context, s *store.Store, entries []models.AuditEntry) ([]models.AuditEntry, error) {
+	sessions := make(map[primitive.ObjectID]*models.TastingSession)
+	for i, entry := range entries {
+		if entry.Entity != "tasting" {
+			continue
+		}
+		session, seen := sessions[entry.EntityId]
+		if !seen {
+			found, err := s.Tastings.FindById(ctx, entry.EntityId)
+			if err != nil && err != store.ErrNotFound {
+				return nil, err
+			}
+			if err == nil {
+				session = &found
+			}
+			sessions[entry.EntityId] = session
+		}
+
+		hideScores := session == nil || (!session.Closed() && !organises(c, *session))
+		hideSamples := session == nil || !identifies(c, *session)
+		if !hideScores && !hideSamples {
+			continue
+		}
+		changes := make(map[string]models.Change, len(entry.Changes))
+		for field, change := range entry.Changes {
+			switch {
+			case field == "scores" && hideScores:
+				continue
+			case field == "samples" && hideSamples:
+				var err error
+				if change.Before, err = codesOnly(change.Before); err != nil {
+					return nil, err
+				}
+				if change.After, err = codesOnly(change.After); err != nil {
+					return nil, err
+				}
+			}
+			changes[field] = change
+		}
+		entries[i].Changes = changes
+	}
+	return entries, nil
+}
+
+// codesOnly strips a JSON list of samples down to their ids and codes, in
+// code order, as tasterView does.
+func codesOnly(value json.RawMessage) (json.RawMessage, error) {
+	var samples []models.TastingSample
+	if len(value) == 0 || string(value) == "null" {
+		return value, nil
+	}
+	if err := json.Unmarshal(value, &samples); err != nil {
+		return nil, err
+	}
+	for i, sample := range samples {
+		samples[i] = models.TastingSample{Id: sample.Id, Code: sample.Code}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Code < samples[j].Code })
+	return json.Marshal(samples)
+}
+
+// panelMeasurement records the panel's verdict on a sample as a reading of
+// its batch: the consensus score, every panellist's notes, and each
+// descriptor the panel tagged at the mean intensity of those who tagged it.
+// It takes the id set aside for it on the sample.
+func panelMeasurement(session models.TastingSession, sample models.TastingSample, result sampleResult, now primitive.DateTime) models.Measurement {
+	tastingId, score := session.Id, float32(result.Consensus)
+	measurement := models.Measurement{
+		Id:        *sample.MeasurementId,
+		CreatedAt: now,
+		Date:      session.Date,
+		BatchId:   sample.BatchId,
+		VesselId:  sample.VesselId,
+		TastingId: &tastingId,
+		Score:     &score,
+	}
+
+	notes := []string{fmt.Sprintf("%s, sample %s: %g from a panel of %d.", session.Name, sample.Code, result.Consensus, len(result.Scores))}
+	sums := make(map[primitive.ObjectID]int)
+	counts := make(map[primitive.ObjectID]int)
+	for _, tasted := range session.Scores {
+		if tasted.SampleId != sample.Id {
+			continue
+		}
+		if note := strings.TrimSpace(tasted.Notes); note != "" {
+			notes = append(notes, note)
+		}
+		for _, tag := range tasted.Descriptors {
+			if counts[tag.DescriptorId] == 0 {
+				measurement.Descriptors = append(measurement.Descriptors, models.DescriptorTag{DescriptorId: tag.DescriptorId})
+			}
+			sums[tag.DescriptorId] += tag.Intensity
+			counts[tag.DescriptorId]++
+		}
+	}
+	for i, tag := range measurement.Descriptors {
+		measurement.Descriptors[i].Intensity = int(math.Round(float64(sums[tag.DescriptorId]) / float64(counts[tag.DescriptorId])))
+	}
+	measurement.Notes = strings.Join(notes, "\n")
+	return measurement
+}
+
+// RevealTasting ends a session, closing it if it is still open, tells the
+// panel what each sample was and records the panel's result on each sample
+// that was scored as a measurement of its batch. Only the session's owner,
+// or an admin, may reveal it. Each measurement's id is saved on its sample
+// before the measurement is written, so a reveal that fails part way can be
+// retried without recording any sample twice.
+func RevealTasting(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deleted := deletedIn(c, s)
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		session, err := s.Tastings.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		user, _ := auth.CurrentUser(c)
+		if user.Id != session.OwnerId && user.CurrentRole() != models.RoleAdmin {
+			api.Respond(c, http.StatusForbidden, "error", "only the owner of a tasting session can reveal it")
+			return
+		}
+		if session.Revealed() {
+			api.Respond(c, http.StatusConflict, "error", "tasting session is already revealed")
+			return
+		}
+
+		now := primitive.NewDateTimeFromTime(time.Now())
+		if !session.Closed() {
+			session.ClosedAt = now
+		}
+		results := panelResults(session)
+		for i := range session.Samples {
+			if len(results.Samples[i].Scores) == 0 {
+				continue
+			}
+			if session.Samples[i].MeasurementId == nil {
+				measurementId := primitive.NewObjectID()
+				session.Samples[i].MeasurementId = &measurementId
+				if err := s.Tastings.Update(ctx, &session); err != nil {
+					api.Respond(c, statusFor(err), "error", err.Error())
+					return
+				}
+			}
+			sample := session.Samples[i]
+			_, err := s.Measurements.FindById(ctx, *sample.MeasurementId)
+			if err == store.ErrNotFound {
+				// Someone may have deleted it since an earlier attempt
+				// recorded it; it stays deleted rather than recorded again.
+				_, err = deleted.Measurements.FindById(ctx, *sample.MeasurementId)
+			}
+			if err == store.ErrNotFound {
+				measurement := panelMeasurement(session, sample, results.Samples[i], now)
+				if err := s.Measurements.Create(ctx, &measurement); err != nil {
+					api.Respond(c, statusFor(err), "error", err.Error())
+					return
+				}
+			} else if err != nil {
+				api.Respond(c, statusFor(err), "error", err.Error())
+				return
+			}
+			if err := linkMeasurement(ctx, s, *sample.BatchId, *sample.MeasurementId); err != nil {
+				api.Respond(c, statusFor(err), "error", err.Error())
+				return
+			}
+		}
+
+		session.RevealedAt = now
+		if err := s.Tastings.Update(ctx, &session); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if err := nameScores(ctx, s, []models.TastingSession{session}); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", session)
+	}
+}
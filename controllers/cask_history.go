@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fillCycles replays a vessel's movements and groups the batches it held
+// into fills. A new fill starts whenever spirit goes into the vessel while
+// it is empty. The returned level is what the ledger says it holds now.
+func fillCycles(movements []models.Movement, vesselId primitive.ObjectID) ([][]primitive.ObjectID, float32) {
+	sortTimeline(movements)
+
+	var cycles [][]primitive.ObjectID
+	var level float32
+	for _, movement := range movements {
+		if movement.ToVesselId != nil && *movement.ToVesselId == vesselId {
+			if level <= volumeTolerance {
+				cycles = append(cycles, nil)
+			}
+			current := len(cycles) - 1
+			if !containsId(cycles[current], movement.BatchId) {
+				cycles[current] = append(cycles[current], movement.BatchId)
+			}
+			level += movement.Volume
+		}
+		if movement.FromVesselId != nil && *movement.FromVesselId == vesselId {
+			level -= movement.Volume
+		}
+	}
+	return cycles, level
+}
+
+// refreshCaskHistory derives the vessel's fill number and the spirits it
+// held in earlier fills from its movements, counting pending ones not yet
+// recorded.
+func refreshCaskHistory(ctx context.Context, s *store.Store, vessel *models.Vessel, pending ...models.Movement) error {
+	movements, err := s.Movements.FindByVessel(ctx, vessel.Id)
+	if err != nil {
+		return err
+	}
+	movements = append(movements, pending...)
+
+	cycles, level := fillCycles(movements, vessel.Id)
+	vessel.FillNumber = len(cycles)
+
+	prior := cycles
+	if level > volumeTolerance && len(prior) > 0 {
+		prior = prior[:len(prior)-1]
+	}
+	var batchIds []primitive.ObjectID
+	for _, cycle := range prior {
+		batchIds = append(batchIds, cycle...)
+	}
+
+	vessel.PriorContents, err = batchContents(ctx, s, batchIds)
+	return err
+}
+
+// batchContents names the spirit each batch belongs to, falling back to the
+// batch id for batches that are not part of a spirit.
+func batchContents(ctx context.Context, s *store.Store, batchIds []primitive.ObjectID) ([]string, error) {
+	contents := make([]string, 0, len(batchIds))
+	if len(batchIds) == 0 {
+		return contents, nil
+	}
+
+	spirits, err := s.Spirits.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, batchId := range batchIds {
+		name := "batch " + batchId.Hex()
+		for _, spirit := range spirits {
+			if containsId(spirit.BatchIds, batchId) {
+				name = spirit.Name
+				break
+			}
+		}
+		if !seen[name] {
+			seen[name] = true
+			contents = append(contents, name)
+		}
+	}
+	return contents, nil
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// tombstoned is implemented by the models that are marked deleted rather
+// than removed.
+type tombstoned[T any] interface {
+	*T
+	Tombstone() *models.Deletion
+}
+
+// deletedIn is like scoped but sees only deleted documents, for listing
+// them with ?deleted=true and restoring them.
+func deletedIn(c *gin.Context, s *store.Store) *store.Store {
+	organisationId, _ := auth.CurrentOrganisation(c)
+	return s.DeletedIn(organisationId).AuditedBy(actor(c))
+}
+
+// softDelete marks a document deleted by the current user. It stays out of
+// sight until it is restored or the retention job purges it.
+func softDelete[T any, P tombstoned[T]](ctx context.Context, c *gin.Context, repo store.Repository[T], id primitive.ObjectID) error {
+	document, err := repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	user, _ := auth.CurrentUser(c)
+	*P(&document).Tombstone() = models.Deletion{
+		DeletedAt: primitive.NewDateTimeFromTime(time.Now()),
+		DeletedBy: &user.Id,
+	}
+	return repo.Update(ctx, &document)
+}
+
+// restore clears the deletion mark of a document deleted from repo, which
+// must come from deletedIn.
+func restore[T any, P tombstoned[T]](c *gin.Context, repo store.Repository[T]) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+	document, err := repo.FindById(ctx, objId)
+	if err != nil {
+		api.Respond(c, statusFor(err), "error", err.Error())
+		return
+	}
+
+	*P(&document).Tombstone() = models.Deletion{}
+	if err := repo.Update(ctx, &document); err != nil {
+		api.Respond(c, statusFor(err), "error", err.Error())
+		return
+	}
+
+	api.Respond(c, http.StatusOK, "success", document)
+}
+
+func RestoreSpirit(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		restore[models.Spirit](c, deletedIn(c, s).Spirits)
+	}
+}
+
+func RestoreBatch(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		restore[models.Batch](c, deletedIn(c, s).Batches)
+	}
+}
+
+func RestoreVessel(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		restore[models.Vessel](c, deletedIn(c, s).Vessels)
+	}
+}
+
+func RestoreMeasurement(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		restore[models.Measurement](c, deletedIn(c, s).Measurements)
+	}
+}
@@ -0,0 +1,468 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// flavourWheel is the wheel LoadFlavourWheel gives an organisation to start
+// from, after the one the whisky industry tastes by.
+var flavourWheel = []struct {
+	category    string
+	descriptors []string
+}{
+	{"Cereal", []string{"Malt", "Cooked Mash", "Husky", "Yeasty", "Toasted Grain"}},
+	{"Fruity", []string{"Citrus", "Fresh Fruit", "Cooked Fruit", "Dried Fruit", "Tropical Fruit", "Banana"}},
+	{"Floral", []string{"Fragrant", "Green Leafy", "Hay", "Heather"}},
+	{"Peaty", []string{"Medicinal", "Smoky", "Kippery", "Mossy"}},
+	{"Feinty", []string{"Honey", "Tobacco", "Leather", "Sweaty"}},
+	{"Sulphury", []string{"Vegetative", "Coal Gas", "Rubbery", "Struck Match"}},
+	{"Woody", []string{"Vanilla", "Toasted", "Old Wood", "New Wood", "Spice", "Coconut"}},
+	{"Winey", []string{"Sherried", "Nutty", "Chocolate", "Oily"}},
+	{"Sweet", []string{"Caramel", "Toffee", "Butterscotch", "Syrup"}},
+}
+
+var wheelSynonyms = map[string][]string{
+	"Vanilla":     {"Vanillin", "Vanilla Pod"},
+	"Citrus":      {"Lemon", "Orange Peel"},
+	"Dried Fruit": {"Raisin", "Sultana", "Fig"},
+	"Spice":       {"Spicy", "Clove", "Cinnamon"},
+	"Smoky":       {"Smoke"},
+	"Sherried":    {"Sherry"},
+}
+
+// descriptorTree nests descriptors under their parents, by name at each
+// level, and returns the categories.
+func descriptorTree(descriptors []models.Descriptor) []models.Descriptor {
+	children := make(map[primitive.ObjectID][]models.Descriptor)
+	var roots []models.Descriptor
+	for _, descriptor := range descriptors {
+		if descriptor.ParentId == nil {
+			roots = append(roots, descriptor)
+		} else {
+			children[*descriptor.ParentId] = append(children[*descriptor.ParentId], descriptor)
+		}
+	}
+
+	var nest func(level []models.Descriptor) []models.Descriptor
+	nest = func(level []models.Descriptor) []models.Descriptor {
+		sort.Slice(level, func(i, j int) bool { return level[i].Name < level[j].Name })
+		for i := range level {
+			level[i].Children = nest(children[level[i].Id])
+		}
+		return level
+	}
+	if roots == nil {
+		return []models.Descriptor{}
+	}
+	return nest(roots)
+}
+
+// findDescriptor looks a name or synonym up the way tasters' words are
+// matched, regardless of case.
+func findDescriptor(descriptors []models.Descriptor, name string) (models.Descriptor, bool) {
+	term := models.NormaliseTerm(name)
+	for _, descriptor := range descriptors {
+		for _, existing := range descriptor.Terms() {
+			if existing == term {
+				return descriptor, true
+			}
+		}
+	}
+	return models.Descriptor{}, false
+}
+
+// checkDescriptor makes sure a new or changed descriptor shares no name or
+// synonym with another and sits under an existing parent, not under itself.
+func checkDescriptor(descriptors []models.Descriptor, descriptor *models.Descriptor) error {
+	for _, term := range descriptor.Terms() {
+		if existing, ok := findDescriptor(descriptors, term); ok && existing.Id != descriptor.Id {
+			return fmt.Errorf("%w: %q is already used by descriptor %s", store.ErrDuplicate, term, existing.Name)
+		}
+	}
+
+	byId := make(map[primitive.ObjectID]models.Descriptor, len(descriptors))
+	for _, existing := range descriptors {
+		byId[existing.Id] = existing
+	}
+	for parentId := descriptor.ParentId; parentId != nil; parentId = byId[*parentId].ParentId {
+		if *parentId == descriptor.Id {
+			return missingReferenceError{kind: "parent descriptor", name: "outside its own branch"}
+		}
+		if _, ok := byId[*parentId]; !ok {
+			return missingReferenceError{kind: "parent descriptor", id: *parentId}
+		}
+	}
+	return nil
+}
+
+// resolveDescriptors points each tag of a tasting at a descriptor of the
+// organisation's wheel, looking up tags that only give a name, and keeps
+// only the descriptor's id; nameDescriptors puts its name back when the tag
+// is read. A descriptor tagged twice keeps the stronger intensity.
+func resolveDescriptors(ctx context.Context, s *store.Store, tags *[]models.DescriptorTag) error {
+	if len(*tags) == 0 {
+		return nil
+	}
+	descriptors, err := s.Descriptors.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	resolved := make([]models.DescriptorTag, 0, len(*tags))
+	index := make(map[primitive.ObjectID]int)
+	for _, tag := range *tags {
+		var descriptor models.Descriptor
+		if tag.DescriptorId.IsZero() {
+			found, ok := findDescriptor(descriptors, tag.Name)
+			if !ok {
+				return missingReferenceError{kind: "descriptor", name: tag.Name}
+			}
+			descriptor = found
+		} else if descriptor, err = s.Descriptors.FindById(ctx, tag.DescriptorId); err == store.ErrNotFound {
+			return missingReferenceError{kind: "descriptor", id: tag.DescriptorId}
+		} else if err != nil {
+			return err
+		}
+
+		tag = models.DescriptorTag{DescriptorId: descriptor.Id, Intensity: tag.Intensity}
+		if i, seen := index[descriptor.Id]; seen {
+			if tag.Intensity > resolved[i].Intensity {
+				resolved[i] = tag
+			}
+			continue
+		}
+		index[descriptor.Id] = len(resolved)
+		resolved = append(resolved, tag)
+	}
+	*tags = resolved
+	return nil
+}
+
+// nameDescriptors gives each tag the name its descriptor has now, so that a
+// renamed descriptor reads the same everywhere it was tagged.
+func nameDescriptors(ctx context.Context, s *store.Store, tags ...[]models.DescriptorTag) error {
+	tagged := false
+	for _, list := range tags {
+		tagged = tagged || len(list) > 0
+	}
+	if !tagged {
+		return nil
+	}
+	descriptors, err := s.Descriptors.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[primitive.ObjectID]string, len(descriptors))
+	for _, descriptor := range descriptors {
+		names[descriptor.Id] = descriptor.Name
+	}
+	for _, list := range tags {
+		for i := range list {
+			if name, ok := names[list[i].DescriptorId]; ok {
+				list[i].Name = name
+			}
+		}
+	}
+	return nil
+}
+
+func nameMeasurements(ctx context.Context, s *store.Store, measurements []models.Measurement) error {
+	tags := make([][]models.DescriptorTag, len(measurements))
+	for i, measurement := range measurements {
+		tags[i] = measurement.Descriptors
+	}
+	return nameDescriptors(ctx, s, tags...)
+}
+
+func nameScores(ctx context.Context, s *store.Store, sessions []models.TastingSession) error {
+	var tags [][]models.DescriptorTag
+	for _, session := range sessions {
+		for _, score := range session.Scores {
+			tags = append(tags, score.Descriptors)
+		}
+	}
+	return nameDescriptors(ctx, s, tags...)
+}
+
+// GetDescriptors returns the organisation's flavour wheel as a tree of
+// categories and their descriptors.
+func GetDescriptors(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		descriptors, err := s.Descriptors.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", descriptorTree(descriptors))
+	}
+}
+
+// GetDescriptor returns a descriptor with the branch of the wheel below it.
+func GetDescriptor(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		descriptors, err := s.Descriptors.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		var found *models.Descriptor
+		var walk func(level []models.Descriptor)
+		walk = func(level []models.Descriptor) {
+			for i := range level {
+				if level[i].Id == objId {
+					found = &level[i]
+					return
+				}
+				walk(level[i].Children)
+			}
+		}
+		walk(descriptorTree(descriptors))
+		if found == nil {
+			api.Respond(c, http.StatusNotFound, "error", store.ErrNotFound.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", found)
+	}
+}
+
+func CreateDescriptor(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request models.Descriptor
+		defer cancel()
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		descriptor := models.Descriptor{
+			Id:        primitive.NewObjectID(),
+			CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+			ParentId:  request.ParentId,
+			Name:      request.Name,
+			Synonyms:  unique(request.Synonyms),
+		}
+
+		descriptors, err := s.Descriptors.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		if err := checkDescriptor(descriptors, &descriptor); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if err := s.Descriptors.Create(ctx, &descriptor); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusCreated, "success", descriptor.Id)
+	}
+}
+
+func UpdateDescriptor(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request models.Descriptor
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		descriptor, err := s.Descriptors.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		descriptor.ParentId = request.ParentId
+		descriptor.Name = request.Name
+		descriptor.Synonyms = unique(request.Synonyms)
+
+		descriptors, err := s.Descriptors.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		if err := checkDescriptor(descriptors, &descriptor); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if err := s.Descriptors.Update(ctx, &descriptor); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", descriptor)
+	}
+}
+
+// DeleteDescriptor removes a descriptor no measurement or panel score has
+// been tagged with and that has no descriptors under it. Measurements that
+// are deleted but may yet be restored count too.
+func DeleteDescriptor(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deleted := deletedIn(c, s)
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if _, err := s.Descriptors.FindById(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		descriptors, err := s.Descriptors.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		for _, descriptor := range descriptors {
+			if descriptor.ParentId != nil && *descriptor.ParentId == objId {
+				api.Respond(c, http.StatusConflict, "error", "descriptor has descriptors under it")
+				return
+			}
+		}
+
+		measurements, err := s.Measurements.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		tombstoned, err := deleted.Measurements.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		for _, measurement := range append(measurements, tombstoned...) {
+			for _, tag := range measurement.Descriptors {
+				if tag.DescriptorId == objId {
+					api.Respond(c, http.StatusConflict, "error", fmt.Sprintf("descriptor is used by measurement %s", measurement.Id.Hex()))
+					return
+				}
+			}
+		}
+
+		sessions, err := s.Tastings.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		for _, session := range sessions {
+			for _, score := range session.Scores {
+				for _, tag := range score.Descriptors {
+					if tag.DescriptorId == objId {
+						api.Respond(c, http.StatusConflict, "error", fmt.Sprintf("descriptor is used by tasting session %s", session.Id.Hex()))
+						return
+					}
+				}
+			}
+		}
+
+		if err := s.Descriptors.Delete(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", "descriptor deleted")
+	}
+}
+
+// LoadFlavourWheel adds the standard flavour wheel to the organisation's,
+// leaving out any category or descriptor it already has a word for.
+func LoadFlavourWheel(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		descriptors, err := s.Descriptors.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		add := func(name string, parentId *primitive.ObjectID) (models.Descriptor, error) {
+			if existing, ok := findDescriptor(descriptors, name); ok {
+				return existing, nil
+			}
+			descriptor := models.Descriptor{
+				Id:        primitive.NewObjectID(),
+				CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+				ParentId:  parentId,
+				Name:      name,
+			}
+			for _, synonym := range wheelSynonyms[name] {
+				if _, taken := findDescriptor(descriptors, synonym); !taken {
+					descriptor.Synonyms = append(descriptor.Synonyms, synonym)
+				}
+			}
+			if err := s.Descriptors.Create(ctx, &descriptor); err != nil {
+				return descriptor, err
+			}
+			descriptors = append(descriptors, descriptor)
+			return descriptor, nil
+		}
+
+		for _, branch := range flavourWheel {
+			category, err := add(branch.category, nil)
+			if err != nil {
+				api.Respond(c, statusFor(err), "error", err.Error())
+				return
+			}
+			for _, name := range branch.descriptors {
+				if _, err := add(name, &category.Id); err != nil {
+					api.Respond(c, statusFor(err), "error", err.Error())
+					return
+				}
+			}
+		}
+
+		api.Respond(c, http.StatusOK, "success", descriptorTree(descriptors))
+	}
+}
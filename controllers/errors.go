@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"aging-api/store"
+	"errors"
+	"net/http"
+)
+
+// invalidQueryError is a query parameter the client got wrong.
+type invalidQueryError struct {
+	error
+}
+
+func statusFor(err error) int {
+	var missing missingReferenceError
+	var invalid invalidQueryError
+	switch {
+	case errors.As(err, &missing), errors.As(err, &invalid):
+		return http.StatusBadRequest
+	case errors.Is(err, store.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrDuplicate):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/models"
+	"aging-api/reports"
+	"aging-api/store"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type batchFlavour struct {
+	BatchId primitive.ObjectID      `json:"batchId"`
+	Period  reports.Period          `json:"period"`
+	Periods []reports.FlavourPeriod `json:"periods"`
+}
+
+// flavourTerms names each descriptor by its id and places it under the
+// category at the root of its branch.
+func flavourTerms(descriptors []models.Descriptor) map[string]reports.Term {
+	byId := make(map[primitive.ObjectID]models.Descriptor, len(descriptors))
+	for _, descriptor := range descriptors {
+		byId[descriptor.Id] = descriptor
+	}
+
+	terms := make(map[string]reports.Term, len(descriptors))
+	for _, descriptor := range descriptors {
+		root := descriptor
+		// The depth bound guards against a cycle written around the API.
+		for depth := 0; root.ParentId != nil && depth < len(descriptors); depth++ {
+			parent, ok := byId[*root.ParentId]
+			if !ok {
+				break
+			}
+			root = parent
+		}
+		terms[descriptor.Id.Hex()] = reports.Term{Name: descriptor.Name, Category: root.Id.Hex()}
+	}
+	return terms
+}
+
+// GetBatchFlavour follows how a batch's flavour developed, from the
+// descriptor tags of the tastings taken from it, tasting by tasting or
+// averaged by ?period=month or year.
+func GetBatchFlavour(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		period := c.DefaultQuery("period", string(reports.ByMonth))
+		if !reports.IsPeriod(period) {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("period must be %s, %s or %s", reports.EachTasting, reports.ByMonth, reports.ByYear))
+			return
+		}
+
+		batch, err := s.Batches.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		measurements, err := s.Measurements.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		descriptors, err := s.Descriptors.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		var tastings []reports.Tasting
+		for _, measurement := range measurements {
+			inBatch := measurement.BatchId != nil && *measurement.BatchId == batch.Id
+			if len(measurement.Descriptors) == 0 || !(inBatch || containsId(batch.MeasurementIds, measurement.Id)) {
+				continue
+			}
+			tasting := reports.Tasting{Date: measurementDate(measurement).Time()}
+			for _, tag := range measurement.Descriptors {
+				tasting.Tags = append(tasting.Tags, reports.Tag{Descriptor: tag.DescriptorId.Hex(), Intensity: float64(tag.Intensity)})
+			}
+			tastings = append(tastings, tasting)
+		}
+
+		api.Respond(c, http.StatusOK, "success", batchFlavour{
+			BatchId: batch.Id,
+			Period:  reports.Period(period),
+			Periods: reports.FlavourProfile(tastings, flavourTerms(descriptors), reports.Period(period)),
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pointInTime switches s to how things stood at ?asOf=, an RFC 3339 time
+// or a date, which means the end of that day in UTC. Without asOf it
+// returns s.
+func pointInTime(c *gin.Context, s *store.Store) (*store.Store, error) {
+	value := c.Query("asOf")
+	if value == "" {
+		return s, nil
+	}
+
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		day, dayErr := time.Parse("2006-01-02", value)
+		if dayErr != nil {
+			return nil, invalidQueryError{errors.New("asOf must be an RFC 3339 time or a YYYY-MM-DD date")}
+		}
+		at = day.AddDate(0, 0, 1).Add(-time.Millisecond)
+	}
+
+	organisationId, _ := auth.CurrentOrganisation(c)
+	return s.AsOf(organisationId, at), nil
+}
+
+// getHistory lists every version of a document, oldest first.
+func getHistory[T any](c *gin.Context, s *store.Store, entity string, repo store.Repository[T]) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+	organisationId, _ := auth.CurrentOrganisation(c)
+
+	versions, err := s.Versions.Find(ctx, organisationId, entity, &objId)
+	if err != nil {
+		api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+		return
+	}
+
+	// Documents from before versions were kept have none but still exist.
+	if len(versions) == 0 {
+		if _, err := repo.FindById(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+	}
+
+	api.Respond(c, http.StatusOK, "success", versions)
+}
+
+func GetSpiritHistory(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		getHistory[models.Spirit](c, s, "spirit", s.Spirits)
+	}
+}
+
+func GetBatchHistory(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		getHistory[models.Batch](c, s, "batch", s.Batches)
+	}
+}
+
+func GetVesselHistory(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		getHistory[models.Vessel](c, s, "vessel", s.Vessels)
+	}
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"aging-api/listing"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// page filters, sorts and pages documents by the request's query. Parameters
+// named in handled are ones the handler has dealt with itself. A collection
+// too large to list is the server's failing, not the query's.
+func page[T any](c *gin.Context, documents []T, handled ...string) (listing.Page[T], error) {
+	query, err := listing.Parse(c.Request.URL.Query(), handled...)
+	if err != nil {
+		return listing.Page[T]{}, invalidQueryError{err}
+	}
+	result, err := listing.Apply(documents, query)
+	if errors.Is(err, listing.ErrTooMany) {
+		return listing.Page[T]{}, err
+	}
+	if err != nil {
+		return listing.Page[T]{}, invalidQueryError{err}
+	}
+	return result, nil
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// lockoutMu serialises updates to failure counts so that concurrent
+// guesses are all counted.
+var lockoutMu sync.Mutex
+
+// loginKey names what failed logins are counted against: the account
+// being guessed at and the address guessing.
+type loginKey struct {
+	account string
+	address string
+}
+
+func loginKeys(email string, address string) loginKey {
+	return loginKey{
+		account: "email:" + strings.ToLower(strings.TrimSpace(email)),
+		address: "ip:" + address,
+	}
+}
+
+// lockedFor is how long until neither key is locked.
+func lockedFor(ctx context.Context, s *store.Store, keys loginKey, now time.Time) (time.Duration, error) {
+	var longest time.Duration
+	for _, key := range []string{keys.account, keys.address} {
+		lockout, err := s.Lockouts.FindByKey(ctx, key)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if remaining := lockout.LockedUntil.Time().Sub(now); remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest, nil
+}
+
+func recordLoginFailure(ctx context.Context, s *store.Store, keys loginKey, now time.Time) error {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	limits := map[string]int{keys.account: auth.AccountFailureLimit, keys.address: auth.AddressFailureLimit}
+	for key, limit := range limits {
+		lockout, err := s.Lockouts.FindByKey(ctx, key)
+		if err == store.ErrNotFound {
+			lockout = models.Lockout{
+				Id:        primitive.NewObjectID(),
+				CreatedAt: primitive.NewDateTimeFromTime(now),
+				Key:       key,
+			}
+			auth.RecordFailure(&lockout, limit, now)
+			err = s.Lockouts.Create(ctx, &lockout)
+		} else if err == nil {
+			auth.RecordFailure(&lockout, limit, now)
+			err = s.Lockouts.Update(ctx, &lockout)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearLoginFailures forgets failed attempts at an account once its owner
+// logs in. How often it has been locked is kept for the backoff.
+func clearLoginFailures(ctx context.Context, s *store.Store, key string) error {
+	lockoutMu.Lock()
+	defer lockoutMu.Unlock()
+
+	lockout, err := s.Lockouts.FindByKey(ctx, key)
+	if err == store.ErrNotFound {
+		return nil
+	}
+	if err != nil || lockout.Failures == 0 {
+		return err
+	}
+	lockout.Failures = 0
+	return s.Lockouts.Update(ctx, &lockout)
+}
+
+// GetLockouts lists accounts and addresses that have been locked out;
+// ?active=true limits it to those locked now.
+func GetLockouts(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		lockouts, err := s.Lockouts.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		active := c.Query("active") == "true"
+		now := time.Now()
+		results := make([]models.Lockout, 0, len(lockouts))
+		for _, lockout := range lockouts {
+			if lockout.Lockouts == 0 || (active && !lockout.Locked(now)) {
+				continue
+			}
+			results = append(results, lockout)
+		}
+
+		api.Respond(c, http.StatusOK, "success", results)
+	}
+}
+
+// ClearLockout unlocks an account or address and forgets its history.
+func ClearLockout(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		lockoutMu.Lock()
+		defer lockoutMu.Unlock()
+
+		if err := s.Lockouts.Delete(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", "lockout cleared")
+	}
+}
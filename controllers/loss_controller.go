@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/models"
+	"aging-api/reports"
+	"aging-api/store"
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type vesselLoss struct {
+	VesselId primitive.ObjectID `json:"vesselId"`
+	reports.Loss
+}
+
+type batchLoss struct {
+	reports.Loss
+	Vessels []vesselLoss `json:"vessels"`
+}
+
+type groupLoss struct {
+	Group   string `json:"group"`
+	Vessels int    `json:"vessels"`
+	reports.Loss
+}
+
+// strengths answers what strength a batch was at on a given date: its latest
+// reading before then, or the spirit's initial ABV if it has none.
+type strengths struct {
+	readings map[primitive.ObjectID][]models.Measurement
+	vessels  map[primitive.ObjectID][]models.Measurement
+	initial  map[primitive.ObjectID]float32
+}
+
+func loadStrengths(ctx context.Context, s *store.Store, measurements []models.Measurement) (strengths, error) {
+	spirits, err := s.Spirits.FindAll(ctx)
+	if err != nil {
+		return strengths{}, err
+	}
+
+	lookup := strengths{
+		readings: make(map[primitive.ObjectID][]models.Measurement),
+		vessels:  make(map[primitive.ObjectID][]models.Measurement),
+		initial:  make(map[primitive.ObjectID]float32),
+	}
+	for _, spirit := range spirits {
+		for _, batchId := range spirit.BatchIds {
+			lookup.initial[batchId] = spirit.InitialABV
+		}
+	}
+	for _, measurement := range measurements {
+		if measurement.ABV <= 0 {
+			continue
+		}
+		if measurement.BatchId != nil {
+			lookup.readings[*measurement.BatchId] = append(lookup.readings[*measurement.BatchId], measurement)
+		}
+		if measurement.VesselId != nil {
+			lookup.vessels[*measurement.VesselId] = append(lookup.vessels[*measurement.VesselId], measurement)
+		}
+	}
+	for _, index := range []map[primitive.ObjectID][]models.Measurement{lookup.readings, lookup.vessels} {
+		for _, readings := range index {
+			sort.SliceStable(readings, func(i, j int) bool { return measurementDate(readings[i]) < measurementDate(readings[j]) })
+		}
+	}
+	return lookup, nil
+}
+
+func (l strengths) at(batchId primitive.ObjectID, date primitive.DateTime) float64 {
+	abv := l.initial[batchId]
+	for _, reading := range l.readings[batchId] {
+		if measurementDate(reading) > date {
+			break
+		}
+		abv = reading.ABV
+	}
+	return float64(abv)
+}
+
+// lossEvents turns the movements in and out of a vessel, and the readings
+// taken in it, into the events the loss report replays.
+func lossEvents(vesselId primitive.ObjectID, movements []models.Movement, measurements []models.Measurement, abv strengths) []reports.Event {
+	var events []reports.Event
+	for _, movement := range movements {
+		event := reports.Event{
+			Date: movement.Date.Time(),
+			ABV:  abv.at(movement.BatchId, movement.Date),
+		}
+		switch {
+		case movement.ToVesselId != nil && *movement.ToVesselId == vesselId:
+			event.Volume = float64(movement.Volume)
+		case movement.FromVesselId != nil && *movement.FromVesselId == vesselId:
+			event.Volume = -float64(movement.Volume)
+		default:
+			continue
+		}
+		events = append(events, event)
+	}
+	for _, measurement := range measurements {
+		if measurement.VesselId == nil || *measurement.VesselId != vesselId {
+			continue
+		}
+		events = append(events, reports.Event{
+			Date:       measurementDate(measurement).Time(),
+			Reading:    true,
+			ReadVolume: float64(measurement.Volume),
+			ABV:        float64(measurement.ABV),
+		})
+	}
+	return events
+}
+
+// emptied is how little of a batch the ledger may leave in a vessel for the
+// batch to count as gone from it, allowing for rounding.
+const emptied = 0.001
+
+// stay is a time a batch spent in a vessel; To is zero while it is still
+// there.
+type stay struct {
+	From primitive.DateTime
+	To   primitive.DateTime
+}
+
+func (s stay) covers(date primitive.DateTime) bool {
+	return date >= s.From && (s.To == 0 || date <= s.To)
+}
+
+// stays replays a batch's movements to find when it was in a vessel: from a
+// movement in that finds none of it there until one out that leaves none.
+func stays(vesselId primitive.ObjectID, movements []models.Movement) []stay {
+	sorted := append([]models.Movement{}, movements...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date < sorted[j].Date })
+
+	var result []stay
+	level := 0.0
+	for _, movement := range sorted {
+		switch {
+		case movement.ToVesselId != nil && *movement.ToVesselId == vesselId:
+			if level < emptied {
+				result = append(result, stay{From: movement.Date})
+			}
+			level += float64(movement.Volume)
+		case movement.FromVesselId != nil && *movement.FromVesselId == vesselId:
+			level -= float64(movement.Volume)
+			if level < emptied && len(result) > 0 && result[len(result)-1].To == 0 {
+				result[len(result)-1].To = movement.Date
+			}
+		}
+	}
+	return result
+}
+
+// during returns the measurements taken during any of stays, whichever
+// batch they were recorded against.
+func during(measurements []models.Measurement, stays []stay) []models.Measurement {
+	var readings []models.Measurement
+	for _, measurement := range measurements {
+		for _, stay := range stays {
+			if stay.covers(measurementDate(measurement)) {
+				readings = append(readings, measurement)
+				break
+			}
+		}
+	}
+	return readings
+}
+
+func measurementDate(measurement models.Measurement) primitive.DateTime {
+	if measurement.Date == 0 {
+		return measurement.CreatedAt
+	}
+	return measurement.Date
+}
+
+// computeVesselLoss works out a vessel's loss from the readings taken while
+// it held anything.
+func computeVesselLoss(ctx context.Context, s *store.Store, vesselId primitive.ObjectID, measurements []models.Measurement, abv strengths) (reports.Loss, error) {
+	movements, err := s.Movements.FindByVessel(ctx, vesselId)
+	if err != nil {
+		return reports.Loss{}, err
+	}
+	readings := during(measurements, stays(vesselId, movements))
+	return reports.Compute(lossEvents(vesselId, movements, readings, abv), 0), nil
+}
+
+// GetBatchLoss works out the loss in each vessel a batch has been in from
+// the readings taken there while it was, as GetVesselLoss would, and adds
+// them up. The batch's own measurements only give its strength.
+func GetBatchLoss(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		batch, err := s.Batches.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		movements, err := s.Movements.FindByBatch(ctx, objId)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		measurements, err := findByIds[models.Measurement](ctx, s.Measurements, batch.MeasurementIds)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		abv, err := loadStrengths(ctx, s, measurements)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		var vesselIds []primitive.ObjectID
+		for _, movement := range movements {
+			for _, id := range []*primitive.ObjectID{movement.FromVesselId, movement.ToVesselId} {
+				if id != nil && !containsId(vesselIds, *id) {
+					vesselIds = append(vesselIds, *id)
+				}
+			}
+		}
+
+		result := batchLoss{Vessels: []vesselLoss{}}
+		var losses []reports.Loss
+		for _, vesselId := range vesselIds {
+			readings, err := s.Measurements.FindByVessel(ctx, vesselId)
+			if err != nil {
+				api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+				return
+			}
+			readings = during(readings, stays(vesselId, movements))
+			loss := reports.Compute(lossEvents(vesselId, movements, readings, abv), 0)
+			result.Vessels = append(result.Vessels, vesselLoss{VesselId: vesselId, Loss: loss})
+			losses = append(losses, loss)
+		}
+		result.Loss = reports.Combine(losses...)
+
+		api.Respond(c, http.StatusOK, "success", result)
+	}
+}
+
+func GetVesselLoss(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if _, err := s.Vessels.FindById(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		measurements, err := s.Measurements.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		abv, err := loadStrengths(ctx, s, measurements)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		loss, err := computeVesselLoss(ctx, s, objId, measurements, abv)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", vesselLoss{VesselId: objId, Loss: loss})
+	}
+}
+
+var lossGroups = map[string]func(models.Vessel) string{
+	"material": func(v models.Vessel) string { return v.Material },
+	"process":  func(v models.Vessel) string { return v.Process },
+	"location": func(v models.Vessel) string { return v.Location },
+}
+
+// GetLossReport compares losses across vessels grouped by material, process
+// or location, e.g. to compare warehouses or barrel types.
+func GetLossReport(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		groupBy := c.DefaultQuery("groupBy", "material")
+		key, ok := lossGroups[groupBy]
+		if !ok {
+			api.Respond(c, http.StatusBadRequest, "error", "groupBy must be one of material, process or location")
+			return
+		}
+
+		vessels, err := s.Vessels.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		measurements, err := s.Measurements.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		abv, err := loadStrengths(ctx, s, measurements)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		losses := make(map[string][]reports.Loss)
+		for _, vessel := range vessels {
+			loss, err := computeVesselLoss(ctx, s, vessel.Id, measurements, abv)
+			if err != nil {
+				api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+				return
+			}
+			if loss.VolumeIn == 0 {
+				continue
+			}
+			losses[key(vessel)] = append(losses[key(vessel)], loss)
+		}
+
+		groups := make([]groupLoss, 0, len(losses))
+		for group, vesselLosses := range losses {
+			groups = append(groups, groupLoss{Group: group, Vessels: len(vesselLosses), Loss: reports.Combine(vesselLosses...)})
+		}
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Group < groups[j].Group })
+
+		api.Respond(c, http.StatusOK, "success", groups)
+	}
+}
@@ -1,25 +1,25 @@
 package controllers
 
 import (
-	"aging-api/configs"
+	"aging-api/api"
 	"aging-api/models"
 	"aging-api/responses"
+	"aging-api/store"
+	"aging-api/units"
 	"context"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var measurementCollection *mongo.Collection = configs.GetCollection(configs.DB, "measurements")
 var validateMeasurement = validator.New()
 
-func CreateMeasurement() gin.HandlerFunc {
+func CreateMeasurement(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		var measurement models.Measurement
 		defer cancel()
@@ -37,39 +37,91 @@ func CreateMeasurement() gin.HandlerFunc {
 		}
 
 		newMeasurement := models.Measurement{
-			Id:         primitive.NewObjectID(),
-			CreatedAt:  primitive.NewDateTimeFromTime(time.Now()),
-			ABV:        measurement.ABV,
-			Image:      measurement.Image,
-			Nose:       measurement.Nose,
-			ForePalate: measurement.ForePalate,
-			MidPalate:  measurement.MidPalate,
-			Finish:     measurement.Finish,
-			Notes:      measurement.Notes,
-		}
-
-		result, err := measurementCollection.InsertOne(ctx, newMeasurement)
-		if err != nil {
+			Id:          primitive.NewObjectID(),
+			CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+			Date:        movementDate(measurement.Date),
+			BatchId:     measurement.BatchId,
+			VesselId:    measurement.VesselId,
+			Volume:      measurement.Volume,
+			ABV:         measurement.ABV,
+			ApparentABV: measurement.ApparentABV,
+			Temperature: measurement.Temperature,
+			Image:       measurement.Image,
+			Nose:        measurement.Nose,
+			ForePalate:  measurement.ForePalate,
+			MidPalate:   measurement.MidPalate,
+			Finish:      measurement.Finish,
+			Notes:       measurement.Notes,
+			Descriptors: measurement.Descriptors,
+		}
+
+		correctABV(&newMeasurement)
+
+		if err := checkMeasurementReferences(ctx, s, &newMeasurement); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		if err := s.Measurements.Create(ctx, &newMeasurement); err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": result.InsertedID}})
+		if newMeasurement.BatchId != nil {
+			if err := linkMeasurement(ctx, s, *newMeasurement.BatchId, newMeasurement.Id); err != nil {
+				c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+				return
+			}
+		}
+
+		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": newMeasurement.Id}})
 		return
 	}
 }
 
-func GetMeasurement() gin.HandlerFunc {
+// ListMeasurements lists measurements a page at a time, filtered and sorted
+// on any of their fields, such as ?batchId= or ?sort=-date.
+func ListMeasurements(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		measurements, err := s.Measurements.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		found, err := page(c, measurements)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if err := nameMeasurements(ctx, s, found.Items); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.RespondPage(c, found.Items, found.Total, found.NextCursor)
+	}
+}
+
+func GetMeasurement(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		measurementId := c.Param("id")
-		var measurement models.Measurement
 		defer cancel()
 
 		objId, _ := primitive.ObjectIDFromHex(measurementId)
 
-		err := measurementCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&measurement)
+		measurement, err := s.Measurements.FindById(ctx, objId)
 		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+		if err := nameDescriptors(ctx, s, measurement.Descriptors); err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
@@ -79,8 +131,9 @@ func GetMeasurement() gin.HandlerFunc {
 	}
 }
 
-func UpdateMeasurement() gin.HandlerFunc {
+func UpdateMeasurement(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		measurementId := c.Param("id")
 		var measurement models.Measurement
@@ -98,32 +151,42 @@ func UpdateMeasurement() gin.HandlerFunc {
 			return
 		}
 
-		update := bson.M{
-			"ABV":        measurement.ABV,
-			"Image":      measurement.Image,
-			"Nose":       measurement.Nose,
-			"ForePalate": measurement.ForePalate,
-			"MidPalate":  measurement.MidPalate,
-			"Finish":     measurement.Finish,
-			"Notes":      measurement.Notes,
-		}
-
-		result, err := measurementCollection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": update})
-
+		updatedMeasurement, err := s.Measurements.FindById(ctx, objId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		var updatedMeasurement models.Measurement
+		if measurement.Date != 0 {
+			updatedMeasurement.Date = measurement.Date
+		}
+		updatedMeasurement.VesselId = measurement.VesselId
+		updatedMeasurement.Volume = measurement.Volume
+		updatedMeasurement.ABV = measurement.ABV
+		updatedMeasurement.ApparentABV = measurement.ApparentABV
+		updatedMeasurement.Temperature = measurement.Temperature
+		updatedMeasurement.Image = measurement.Image
+		updatedMeasurement.Nose = measurement.Nose
+		updatedMeasurement.ForePalate = measurement.ForePalate
+		updatedMeasurement.MidPalate = measurement.MidPalate
+		updatedMeasurement.Finish = measurement.Finish
+		updatedMeasurement.Notes = measurement.Notes
+		updatedMeasurement.Descriptors = measurement.Descriptors
 
-		if result.MatchedCount == 1 {
-			err := measurementCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&updatedMeasurement)
+		correctABV(&updatedMeasurement)
 
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
-				return
-			}
+		if err := checkMeasurementReferences(ctx, s, &updatedMeasurement); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		if err := s.Measurements.Update(ctx, &updatedMeasurement); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+		if err := nameDescriptors(ctx, s, updatedMeasurement.Descriptors); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
 		}
 
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": updatedMeasurement}})
@@ -131,23 +194,24 @@ func UpdateMeasurement() gin.HandlerFunc {
 	}
 }
 
-func DeleteMeasurement() gin.HandlerFunc {
+func DeleteMeasurement(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		measurementId := c.Param("id")
 		defer cancel()
 
 		objId, _ := primitive.ObjectIDFromHex(measurementId)
 
-		result, err := measurementCollection.DeleteOne(ctx, bson.M{"_id": objId})
+		err := softDelete[models.Measurement](ctx, c, s.Measurements, objId)
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "measurement not found"}})
 			return
 		}
 
-		if result.DeletedCount < 1 {
-			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "measurement not found"}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
@@ -157,3 +221,38 @@ func DeleteMeasurement() gin.HandlerFunc {
 		return
 	}
 }
+
+// correctABV stores the true ABV of a reading submitted as an apparent
+// strength at cellar temperature, keeping the raw values alongside it.
+func correctABV(measurement *models.Measurement) {
+	if measurement.ApparentABV == 0 || measurement.Temperature == nil {
+		return
+	}
+	measurement.ABV = float32(units.CorrectABV(float64(measurement.ApparentABV), float64(*measurement.Temperature)))
+}
+
+func checkMeasurementReferences(ctx context.Context, s *store.Store, measurement *models.Measurement) error {
+	if measurement.BatchId != nil {
+		if err := checkReferences[models.Batch](ctx, "batch", s.Batches, []primitive.ObjectID{*measurement.BatchId}); err != nil {
+			return err
+		}
+	}
+	if measurement.VesselId != nil {
+		if err := checkReferences[models.Vessel](ctx, "vessel", s.Vessels, []primitive.ObjectID{*measurement.VesselId}); err != nil {
+			return err
+		}
+	}
+	return resolveDescriptors(ctx, s, &measurement.Descriptors)
+}
+
+func linkMeasurement(ctx context.Context, s *store.Store, batchId primitive.ObjectID, measurementId primitive.ObjectID) error {
+	batch, err := s.Batches.FindById(ctx, batchId)
+	if err != nil {
+		return err
+	}
+	if containsId(batch.MeasurementIds, measurementId) {
+		return nil
+	}
+	batch.MeasurementIds = append(batch.MeasurementIds, measurementId)
+	return s.Batches.Update(ctx, &batch)
+}
@@ -0,0 +1,441 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var validateMovement = validator.New()
+
+// lifecycleMu serialises fills, transfers and dumps so that two requests
+// cannot both pass the same capacity check.
+var lifecycleMu sync.Mutex
+
+// volumeTolerance absorbs float32 rounding when comparing ledger sums.
+const volumeTolerance = 0.001
+
+type fillRequest struct {
+	VesselId primitive.ObjectID `json:"vesselId" validate:"required"`
+	Volume   float32            `json:"volume" validate:"gt=0"`
+	Date     primitive.DateTime `json:"date"`
+}
+
+type transferRequest struct {
+	FromVesselId primitive.ObjectID `json:"fromVesselId" validate:"required"`
+	ToVesselId   primitive.ObjectID `json:"toVesselId" validate:"required"`
+	Volume       float32            `json:"volume" validate:"gt=0"`
+	Date         primitive.DateTime `json:"date"`
+}
+
+// dumpRequest empties the batch's spirit from a vessel. A zero volume dumps
+// everything the batch still has in the vessel.
+type dumpRequest struct {
+	VesselId primitive.ObjectID `json:"vesselId" validate:"required"`
+	Volume   float32            `json:"volume" validate:"gte=0"`
+	Date     primitive.DateTime `json:"date"`
+}
+
+// volumeIn sums the movements into and out of vesselId.
+func volumeIn(movements []models.Movement, vesselId primitive.ObjectID) float32 {
+	var volume float32
+	for _, movement := range movements {
+		if movement.ToVesselId != nil && *movement.ToVesselId == vesselId {
+			volume += movement.Volume
+		}
+		if movement.FromVesselId != nil && *movement.FromVesselId == vesselId {
+			volume -= movement.Volume
+		}
+	}
+	return volume
+}
+
+func volumeFilled(movements []models.Movement) float32 {
+	var volume float32
+	for _, movement := range movements {
+		if movement.Type == models.MovementFill {
+			volume += movement.Volume
+		}
+	}
+	return volume
+}
+
+func sortTimeline(movements []models.Movement) {
+	sort.SliceStable(movements, func(i, j int) bool {
+		if movements[i].Date != movements[j].Date {
+			return movements[i].Date < movements[j].Date
+		}
+		return movements[i].CreatedAt < movements[j].CreatedAt
+	})
+}
+
+func movementDate(date primitive.DateTime) primitive.DateTime {
+	if date == 0 {
+		return primitive.NewDateTimeFromTime(time.Now())
+	}
+	return date
+}
+
+func findVessel(ctx context.Context, s *store.Store, id primitive.ObjectID) (models.Vessel, error) {
+	vessel, err := s.Vessels.FindById(ctx, id)
+	if err == store.ErrNotFound {
+		return vessel, missingReferenceError{kind: "vessel", id: id}
+	}
+	return vessel, err
+}
+
+func checkFill(vessel models.Vessel, volume float32) error {
+	if status := vessel.CurrentStatus(); !models.CanTransitionVessel(status, models.VesselFilled) {
+		return fmt.Errorf("vessel %s is %s and cannot be filled", vessel.Id.Hex(), status)
+	}
+	if vessel.FillLevel+volume > vessel.Volume+volumeTolerance {
+		return fmt.Errorf("vessel %s holds %g of %g; cannot add %g", vessel.Id.Hex(), vessel.FillLevel, vessel.Volume, volume)
+	}
+	return nil
+}
+
+// recordMovement stores the movement, updates the fill level and status of
+// the vessels involved and links the batch to the vessel it moved into. The
+// stores have no transactions to share, so the movement is written first and
+// if any later write fails every write before it is put back, the movement
+// removed and the first error returned: the ledger never lacks a movement
+// the vessels reflect. Putting back is done as well as the store allows; an
+// error while undoing is not reported over the one that caused it.
+func recordMovement(ctx context.Context, s *store.Store, batch *models.Batch, movement *models.Movement, from *models.Vessel, to *models.Vessel) (err error) {
+	var fromBefore, toBefore models.Vessel
+	if from != nil {
+		fromBefore = *from
+	}
+	if to != nil {
+		toBefore = *to
+	}
+	batchBefore := *batch
+
+	movement.Id = primitive.NewObjectID()
+	movement.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	movement.BatchId = batch.Id
+	movement.Date = movementDate(movement.Date)
+	if from != nil {
+		movement.FromVesselId = &from.Id
+		from.FillLevel -= movement.Volume
+		if from.FillLevel <= volumeTolerance {
+			// Only a dump spoils a vessel; one drained by a transfer can be
+			// filled again straight away.
+			from.FillLevel = 0
+			from.Status = models.VesselEmpty
+			if movement.Type == models.MovementDump {
+				from.Status = models.VesselDumped
+			}
+		}
+	}
+	previous := batch.VesselIds
+	if to != nil {
+		movement.ToVesselId = &to.Id
+		to.FillLevel += movement.Volume
+		to.Status = models.VesselFilled
+		if err := refreshCaskHistory(ctx, s, to, *movement); err != nil {
+			return err
+		}
+		if !containsId(batch.VesselIds, to.Id) {
+			batch.VesselIds = append(append([]primitive.ObjectID{}, previous...), to.Id)
+		}
+	}
+
+	if err := s.Movements.Create(ctx, movement); err != nil {
+		return err
+	}
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		s.Movements.Delete(ctx, movement.Id)
+	}()
+
+	if from != nil {
+		if err := s.Vessels.Update(ctx, from); err != nil {
+			return err
+		}
+		undo = append(undo, func() error { return s.Vessels.Update(ctx, &fromBefore) })
+	}
+	if to != nil {
+		if err := s.Vessels.Update(ctx, to); err != nil {
+			return err
+		}
+		undo = append(undo, func() error { return s.Vessels.Update(ctx, &toBefore) })
+	}
+	if len(batch.VesselIds) != len(previous) {
+		if err := s.Batches.Update(ctx, batch); err != nil {
+			return err
+		}
+		undo = append(undo, func() error { return s.Batches.Update(ctx, &batchBefore) })
+		if err := linkVessels(ctx, s, batch.Id, previous, batch.VesselIds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func FillBatch(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request fillRequest
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validateMovement.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		lifecycleMu.Lock()
+		defer lifecycleMu.Unlock()
+
+		batch, err := s.Batches.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		vessel, err := findVessel(ctx, s, request.VesselId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		history, err := s.Movements.FindByBatch(ctx, batch.Id)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		if remaining := batch.Volume - volumeFilled(history); request.Volume > remaining+volumeTolerance {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("batch has only %g left to fill", remaining))
+			return
+		}
+
+		if err := checkFill(vessel, request.Volume); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		movement := models.Movement{
+			Date:   request.Date,
+			Type:   models.MovementFill,
+			Volume: request.Volume,
+		}
+		if err := recordMovement(ctx, s, &batch, &movement, nil, &vessel); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusCreated, "success", movement)
+	}
+}
+
+func TransferBatch(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request transferRequest
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validateMovement.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		if request.FromVesselId == request.ToVesselId {
+			api.Respond(c, http.StatusBadRequest, "error", "cannot transfer a vessel into itself")
+			return
+		}
+
+		lifecycleMu.Lock()
+		defer lifecycleMu.Unlock()
+
+		batch, err := s.Batches.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		from, err := findVessel(ctx, s, request.FromVesselId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		to, err := findVessel(ctx, s, request.ToVesselId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		history, err := s.Movements.FindByBatch(ctx, batch.Id)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		if held := volumeIn(history, request.FromVesselId); request.Volume > held+volumeTolerance {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("batch has only %g in vessel %s", held, request.FromVesselId.Hex()))
+			return
+		}
+
+		if err := checkFill(to, request.Volume); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		movement := models.Movement{
+			Date:   request.Date,
+			Type:   models.MovementTransfer,
+			Volume: request.Volume,
+		}
+		if err := recordMovement(ctx, s, &batch, &movement, &from, &to); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusCreated, "success", movement)
+	}
+}
+
+func DumpBatch(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request dumpRequest
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validateMovement.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		lifecycleMu.Lock()
+		defer lifecycleMu.Unlock()
+
+		batch, err := s.Batches.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		vessel, err := findVessel(ctx, s, request.VesselId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		history, err := s.Movements.FindByBatch(ctx, batch.Id)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		held := volumeIn(history, request.VesselId)
+		if held <= volumeTolerance {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("batch has nothing in vessel %s", request.VesselId.Hex()))
+			return
+		}
+		volume := request.Volume
+		if volume == 0 {
+			volume = held
+		}
+		if volume > held+volumeTolerance {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("batch has only %g in vessel %s", held, request.VesselId.Hex()))
+			return
+		}
+
+		movement := models.Movement{
+			Date:   request.Date,
+			Type:   models.MovementDump,
+			Volume: volume,
+		}
+		if err := recordMovement(ctx, s, &batch, &movement, &vessel, nil); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusCreated, "success", movement)
+	}
+}
+
+func GetBatchTimeline(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if _, err := s.Batches.FindById(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		movements, err := s.Movements.FindByBatch(ctx, objId)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		sortTimeline(movements)
+
+		api.Respond(c, http.StatusOK, "success", movements)
+	}
+}
+
+func GetVesselTimeline(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if _, err := s.Vessels.FindById(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		movements, err := s.Movements.FindByVessel(ctx, objId)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		sortTimeline(movements)
+
+		api.Respond(c, http.StatusOK, "success", movements)
+	}
+}
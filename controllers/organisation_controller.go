@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// scoped narrows s to the organisation auth.RequireOrganisation settled on,
+// so that a handler cannot read or change another distillery's records, and
+// logs the writes it makes against the authenticated user. Deleted records
+// are hidden, except that a GET with ?deleted=true sees only those.
+func scoped(c *gin.Context, s *store.Store) *store.Store {
+	if c.Request.Method == http.MethodGet && c.Query("deleted") == "true" {
+		return deletedIn(c, s)
+	}
+	organisationId, _ := auth.CurrentOrganisation(c)
+	return s.ForOrganisation(organisationId).AuditedBy(actor(c))
+}
+
+// actor is who the writes made for a request are logged against.
+func actor(c *gin.Context) store.Actor {
+	user, _ := auth.CurrentUser(c)
+	actor := store.Actor{UserId: user.Id}
+	if apiKey, ok := auth.CurrentApiKey(c); ok {
+		actor.ApiKeyId = &apiKey.Id
+	}
+	return actor
+}
+
+// addMember makes a user a member of an organisation.
+func addMember(ctx context.Context, s *store.Store, organisationId primitive.ObjectID, userId primitive.ObjectID) (models.Membership, error) {
+	membership := models.Membership{
+		Id:             primitive.NewObjectID(),
+		CreatedAt:      primitive.NewDateTimeFromTime(time.Now()),
+		OrganisationId: organisationId,
+		UserId:         userId,
+	}
+	return membership, s.Memberships.Create(ctx, &membership)
+}
+
+func findMembership(ctx context.Context, s *store.Store, organisationId primitive.ObjectID, userId primitive.ObjectID) (models.Membership, error) {
+	memberships, err := s.Memberships.FindByUser(ctx, userId)
+	if err != nil {
+		return models.Membership{}, err
+	}
+	for _, membership := range memberships {
+		if membership.OrganisationId == organisationId {
+			return membership, nil
+		}
+	}
+	return models.Membership{}, store.ErrNotFound
+}
+
+// CreateOrganisation sets up a new distillery with the admin creating it as
+// its first member.
+func CreateOrganisation(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request models.Organisation
+		defer cancel()
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		user, ok := auth.CurrentUser(c)
+		if !ok {
+			api.Respond(c, http.StatusUnauthorized, "error", "not authenticated")
+			return
+		}
+
+		organisation := models.Organisation{
+			Id:        primitive.NewObjectID(),
+			CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+			Name:      request.Name,
+		}
+		if err := s.Organisations.Create(ctx, &organisation); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if _, err := addMember(ctx, s, organisation.Id, user.Id); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusCreated, "success", organisation)
+	}
+}
+
+// GetOrganisations lists the organisations the user belongs to; admins see
+// every organisation.
+func GetOrganisations(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, ok := auth.CurrentUser(c)
+		if !ok {
+			api.Respond(c, http.StatusUnauthorized, "error", "not authenticated")
+			return
+		}
+
+		if user.CurrentRole() == models.RoleAdmin {
+			organisations, err := s.Organisations.FindAll(ctx)
+			if err != nil {
+				api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+				return
+			}
+			api.Respond(c, http.StatusOK, "success", organisations)
+			return
+		}
+
+		memberships, err := s.Memberships.FindByUser(ctx, user.Id)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		ids := make([]primitive.ObjectID, 0, len(memberships))
+		for _, membership := range memberships {
+			ids = append(ids, membership.OrganisationId)
+		}
+		organisations, err := findByIds[models.Organisation](ctx, s.Organisations, ids)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", organisations)
+	}
+}
+
+func GetMembers(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if _, err := s.Organisations.FindById(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		memberships, err := s.Memberships.FindByOrganisation(ctx, objId)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", memberships)
+	}
+}
+
+func AddMember(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request models.Membership
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		if _, err := s.Organisations.FindById(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if err := checkReferences[models.User](ctx, "user", s.Users, []primitive.ObjectID{request.UserId}); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		membership, err := addMember(ctx, s, objId, request.UserId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusCreated, "success", membership)
+	}
+}
+
+func RemoveMember(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+		userId, _ := primitive.ObjectIDFromHex(c.Param("userId"))
+
+		membership, err := findMembership(ctx, s, objId, userId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if err := s.Memberships.Delete(ctx, membership.Id); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", "member removed")
+	}
+}
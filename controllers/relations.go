@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// missingReferenceError is a reference to a document that does not exist,
+// by id or, for descriptors, by name.
+type missingReferenceError struct {
+	kind string
+	id   primitive.ObjectID
+	name string
+}
+
+func (e missingReferenceError) Error() string {
+	if e.name != "" {
+		return fmt.Sprintf("%s %q does not exist", e.kind, e.name)
+	}
+	return fmt.Sprintf("%s %s does not exist", e.kind, e.id.Hex())
+}
+
+func checkReferences[T any](ctx context.Context, kind string, repo store.Repository[T], ids []primitive.ObjectID) error {
+	for _, id := range ids {
+		if _, err := repo.FindById(ctx, id); err == store.ErrNotFound {
+			return missingReferenceError{kind: kind, id: id}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findByIds resolves references for expansion. References to documents that
+// have since been deleted are skipped.
+func findByIds[T any](ctx context.Context, repo store.Repository[T], ids []primitive.ObjectID) ([]T, error) {
+	results := make([]T, 0, len(ids))
+	for _, id := range ids {
+		document, err := repo.FindById(ctx, id)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, document)
+	}
+	return results, nil
+}
+
+func unique[T comparable](values []T) []T {
+	seen := make(map[T]bool, len(values))
+	result := make([]T, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func containsId(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sameIds reports whether a and b hold the same ids, in any order.
+func sameIds(a []primitive.ObjectID, b []primitive.ObjectID) bool {
+	a, b = unique(a), unique(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for _, id := range a {
+		if !containsId(b, id) {
+			return false
+		}
+	}
+	return true
+}
+
+func removeId(ids []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	result := make([]primitive.ObjectID, 0, len(ids))
+	for _, existing := range ids {
+		if existing != id {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
+
+// expansions parses ?expand=a,b into the set of relations to resolve.
+func expansions(c *gin.Context) map[string]bool {
+	expand := make(map[string]bool)
+	for _, value := range c.QueryArray("expand") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				expand[name] = true
+			}
+		}
+	}
+	return expand
+}
+
+func expandSpirit(ctx context.Context, s *store.Store, spirit *models.Spirit, expand map[string]bool) (err error) {
+	if expand["batches"] {
+		spirit.Batches, err = findByIds[models.Batch](ctx, s.Batches, spirit.BatchIds)
+	}
+	return err
+}
+
+func expandBatch(ctx context.Context, s *store.Store, batch *models.Batch, expand map[string]bool) (err error) {
+	if expand["vessels"] {
+		if batch.Vessels, err = findByIds[models.Vessel](ctx, s.Vessels, batch.VesselIds); err != nil {
+			return err
+		}
+	}
+	if expand["measurements"] {
+		if batch.Measurements, err = findByIds[models.Measurement](ctx, s.Measurements, batch.MeasurementIds); err != nil {
+			return err
+		}
+		err = nameMeasurements(ctx, s, batch.Measurements)
+	}
+	return err
+}
+
+func expandVessel(ctx context.Context, s *store.Store, vessel *models.Vessel, expand map[string]bool) (err error) {
+	if expand["batches"] {
+		vessel.Batches, err = findByIds[models.Batch](ctx, s.Batches, vessel.BatchIds)
+	}
+	return err
+}
+
+// linkVessels keeps Vessel.BatchIds in step with a batch's VesselIds after
+// the batch's vessels change from previous to current.
+func linkVessels(ctx context.Context, s *store.Store, batchId primitive.ObjectID, previous []primitive.ObjectID, current []primitive.ObjectID) error {
+	for _, vesselId := range previous {
+		if containsId(current, vesselId) {
+			continue
+		}
+		vessel, err := s.Vessels.FindById(ctx, vesselId)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		vessel.BatchIds = removeId(vessel.BatchIds, batchId)
+		if err := s.Vessels.Update(ctx, &vessel); err != nil {
+			return err
+		}
+	}
+
+	for _, vesselId := range current {
+		vessel, err := s.Vessels.FindById(ctx, vesselId)
+		if err != nil {
+			return err
+		}
+		if containsId(vessel.BatchIds, batchId) {
+			continue
+		}
+		vessel.BatchIds = append(vessel.BatchIds, batchId)
+		if err := s.Vessels.Update(ctx, &vessel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/search"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchDate reads ?from= or ?to= as an RFC 3339 time or a date; a date
+// in to means the end of that day.
+func searchDate(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, invalidQueryError{errors.New(name + " must be an RFC 3339 time or a YYYY-MM-DD date")}
+	}
+	if name == "to" {
+		day = day.AddDate(0, 0, 1).Add(-time.Millisecond)
+	}
+	return day, nil
+}
+
+func searchRequest(c *gin.Context) (search.Request, error) {
+	query, err := search.ParseQuery(c.Query("q"))
+	if err != nil {
+		return search.Request{}, invalidQueryError{err}
+	}
+	request := search.Request{
+		Query:    query,
+		Spirit:   c.Query("spirit"),
+		Material: c.Query("material"),
+		Interval: search.Interval(c.DefaultQuery("interval", string(search.Month))),
+		Limit:    20,
+	}
+	if request.Interval != search.Month && request.Interval != search.Year {
+		return request, invalidQueryError{errors.New("interval must be month or year")}
+	}
+	if request.From, err = searchDate(c, "from"); err != nil {
+		return request, err
+	}
+	if request.To, err = searchDate(c, "to"); err != nil {
+		return request, err
+	}
+	if value := c.Query("limit"); value != "" {
+		if request.Limit, err = strconv.Atoi(value); err != nil || request.Limit < 1 {
+			return request, invalidQueryError{errors.New("limit must be a positive integer")}
+		}
+	}
+	return request, nil
+}
+
+// Search finds measurements by their tasting notes and the spirits they
+// were taken from. ?q= takes words, "phrases", prefixes* and field:word;
+// ?spirit=, ?material=, ?from= and ?to= narrow the hits, and the facets
+// count them by spirit, vessel material and ?interval=month or year.
+func Search(indexer *search.Indexer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		request, err := searchRequest(c)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		organisationId, _ := auth.CurrentOrganisation(c)
+		results, err := indexer.Search(ctx, organisationId, request)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", results)
+	}
+}
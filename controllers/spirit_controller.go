@@ -1,25 +1,24 @@
 package controllers
 
 import (
-	"aging-api/configs"
+	"aging-api/api"
 	"aging-api/models"
 	"aging-api/responses"
+	"aging-api/store"
 	"context"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var spiritCollection *mongo.Collection = configs.GetCollection(configs.DB, "spirits")
 var validateSpirit = validator.New()
 
-func CreateSpirit() gin.HandlerFunc {
+func CreateSpirit(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		var spirit models.Spirit
 		defer cancel()
@@ -38,7 +37,7 @@ func CreateSpirit() gin.HandlerFunc {
 
 		newSpirit := models.Spirit{
 			Id:         primitive.NewObjectID(),
-			Batches:    spirit.Batches,
+			BatchIds:   unique(spirit.BatchIds),
 			CreatedAt:  primitive.NewDateTimeFromTime(time.Now()),
 			Volume:     spirit.Volume,
 			Name:       spirit.Name,
@@ -47,64 +46,107 @@ func CreateSpirit() gin.HandlerFunc {
 			RecipeName: spirit.RecipeName,
 		}
 
-		result, err := spiritCollection.InsertOne(ctx, newSpirit)
-		if err != nil {
+		if err := checkReferences[models.Batch](ctx, "batch", s.Batches, newSpirit.BatchIds); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		if err := s.Spirits.Create(ctx, &newSpirit); err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": result.InsertedID}})
+		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": newSpirit.Id}})
 		return
 	}
 }
 
-func GetAllSpirits() gin.HandlerFunc {
+// GetAllSpirits lists spirits a page at a time, filtered and sorted on any
+// of their fields.
+func GetAllSpirits(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
+		s, err := pointInTime(c, s)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		cur, err := userCollection.Find(ctx, bson.D{})
-		results := make([]interface{}, 0)
-		for cur.Next(ctx) {
-			var result bson.D
-			if err := cur.Decode(&result); err != nil {
-				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
-				return
-			}
-			results = append(results, result)
-		}
+		spirits, err := s.Spirits.FindAll(ctx)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"spirits": results}})
+		found, err := page(c, spirits)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+		results := found.Items
+
+		alcohol, err := newAlcoholContent(ctx, c, s)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		expand := expansions(c)
+		for i := range results {
+			if err := expandSpirit(ctx, s, &results[i], expand); err != nil {
+				c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+				return
+			}
+			alcohol.spirit(&results[i])
+		}
+
+		api.RespondPage(c, results, found.Total, found.NextCursor)
 		return
 	}
 }
 
-func GetSpiritById() gin.HandlerFunc {
+func GetSpiritById(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
+		s, err := pointInTime(c, s)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		spiritId := c.Param("id")
-		var spirit models.Spirit
 		defer cancel()
 
 		objId, _ := primitive.ObjectIDFromHex(spiritId)
 
-		err := spiritCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&spirit)
+		spirit, err := s.Spirits.FindById(ctx, objId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		if err := expandSpirit(ctx, s, &spirit, expansions(c)); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		alcohol, err := newAlcoholContent(ctx, c, s)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
+		alcohol.spirit(&spirit)
 
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": spirit}})
 		return
 	}
 }
 
-func UpdateSpirit() gin.HandlerFunc {
+func UpdateSpirit(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		spiritId := c.Param("id")
 		var spirit models.Spirit
@@ -122,30 +164,27 @@ func UpdateSpirit() gin.HandlerFunc {
 			return
 		}
 
-		update := bson.M{
-			"Volume":     spirit.Volume,
-			"Name":       spirit.Name,
-			"Type":       spirit.Type,
-			"InitialABV": spirit.InitialABV,
-			"RecipeName": spirit.RecipeName,
-		}
-
-		result, err := spiritCollection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": update})
-
+		updatedSpirit, err := s.Spirits.FindById(ctx, objId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		var updatedSpirit models.Spirit
+		updatedSpirit.BatchIds = unique(spirit.BatchIds)
+		updatedSpirit.Volume = spirit.Volume
+		updatedSpirit.Name = spirit.Name
+		updatedSpirit.Type = spirit.Type
+		updatedSpirit.InitialABV = spirit.InitialABV
+		updatedSpirit.RecipeName = spirit.RecipeName
 
-		if result.MatchedCount == 1 {
-			err := spiritCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&updatedSpirit)
+		if err := checkReferences[models.Batch](ctx, "batch", s.Batches, updatedSpirit.BatchIds); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
 
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
-				return
-			}
+		if err := s.Spirits.Update(ctx, &updatedSpirit); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
 		}
 
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": updatedSpirit}})
@@ -154,23 +193,24 @@ func UpdateSpirit() gin.HandlerFunc {
 	}
 }
 
-func DeleteSpirit() gin.HandlerFunc {
+func DeleteSpirit(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		spiritId := c.Param("id")
 		defer cancel()
 
 		objId, _ := primitive.ObjectIDFromHex(spiritId)
 
-		result, err := spiritCollection.DeleteOne(ctx, bson.M{"_id": objId})
+		err := softDelete[models.Spirit](ctx, c, s.Spirits, objId)
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "spirit not found"}})
 			return
 		}
 
-		if result.DeletedCount < 1 {
-			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "spirit not found"}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
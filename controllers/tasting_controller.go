@@ -0,0 +1,503 @@
+package controllers
+
+import (
+	"aging-api/api"
+	"aging-api/auth"
+	"aging-api/models"
+	"aging-api/reports"
+	"aging-api/store"
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type sampleResult struct {
+	SampleId primitive.ObjectID  `json:"sampleId"`
+	Code     string              `json:"code"`
+	BatchId  *primitive.ObjectID `json:"batchId,omitempty"`
+	VesselId *primitive.ObjectID `json:"vesselId,omitempty"`
+	reports.SampleScores
+}
+
+type tastingResults struct {
+	SessionId  primitive.ObjectID  `json:"sessionId"`
+	Name       string              `json:"name"`
+	Date       primitive.DateTime  `json:"date"`
+	Closed     bool                `json:"closed"`
+	Samples    []sampleResult      `json:"samples"`
+	Panellists []reports.Panellist `json:"panellists"`
+	Variance   float64             `json:"variance"`
+}
+
+type scoreRequest struct {
+	Scores []models.TastingScore `json:"scores" validate:"required,min=1,dive"`
+}
+
+// panelResults works out the consensus on each sample of a session and how
+// far each panellist strayed from it.
+func panelResults(session models.TastingSession) tastingResults {
+	ratings := make([][]reports.Rating, len(session.Samples))
+	for i, sample := range session.Samples {
+		for _, score := range session.Scores {
+			if score.SampleId == sample.Id {
+				ratings[i] = append(ratings[i], reports.Rating{Taster: score.TasterId.Hex(), Score: score.Score})
+			}
+		}
+	}
+	panel := reports.ScorePanel(ratings)
+
+	results := tastingResults{
+		SessionId:  session.Id,
+		Name:       session.Name,
+		Date:       session.Date,
+		Closed:     session.Closed(),
+		Samples:    make([]sampleResult, len(session.Samples)),
+		Panellists: panel.Panellists,
+		Variance:   panel.Variance,
+	}
+	for i, sample := range session.Samples {
+		results.Samples[i] = sampleResult{SampleId: sample.Id, Code: sample.Code, BatchId: sample.BatchId, VesselId: sample.VesselId, SampleScores: panel.Samples[i]}
+	}
+	return results
+}
+
+// checkTasting gives new samples their ids and codes and makes sure every
+// sample is of an existing batch and vessel and every panellist a member of
+// the organisation. Scores of samples or panellists no longer in the
+// session are dropped.
+func checkTasting(ctx context.Context, c *gin.Context, s *store.Store, session *models.TastingSession, previous []models.TastingSample) error {
+	for i := range session.Samples {
+		sample := &session.Samples[i]
+		sample.Code, sample.MeasurementId = "", nil
+		if !sample.Id.IsZero() {
+			kept, ok := findSample(previous, sample.Id)
+			if !ok {
+				return missingReferenceError{kind: "sample", id: sample.Id}
+			}
+			sample.Code = kept.Code
+		}
+		if err := checkReferences[models.Batch](ctx, "batch", s.Batches, []primitive.ObjectID{*sample.BatchId}); err != nil {
+			return err
+		}
+		if sample.VesselId != nil {
+			if err := checkReferences[models.Vessel](ctx, "vessel", s.Vessels, []primitive.ObjectID{*sample.VesselId}); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range session.Samples {
+		if sample := &session.Samples[i]; sample.Id.IsZero() {
+			code, err := sampleCode(session.Samples)
+			if err != nil {
+				return err
+			}
+			sample.Id, sample.Code = primitive.NewObjectID(), code
+		}
+	}
+
+	organisationId, _ := auth.CurrentOrganisation(c)
+	members, err := s.Memberships.FindByOrganisation(ctx, organisationId)
+	if err != nil {
+		return err
+	}
+	session.PanelIds = unique(session.PanelIds)
+	for _, userId := range session.PanelIds {
+		member := false
+		for _, membership := range members {
+			member = member || membership.UserId == userId
+		}
+		if !member {
+			return missingReferenceError{kind: "panellist", id: userId}
+		}
+	}
+
+	scores := make([]models.TastingScore, 0, len(session.Scores))
+	for _, score := range session.Scores {
+		if _, ok := session.Sample(score.SampleId, ""); ok && containsId(session.PanelIds, score.TasterId) {
+			scores = append(scores, score)
+		}
+	}
+	session.Scores = scores
+	return nil
+}
+
+func findSample(samples []models.TastingSample, id primitive.ObjectID) (models.TastingSample, bool) {
+	for _, sample := range samples {
+		if sample.Id == id {
+			return sample, true
+		}
+	}
+	return models.TastingSample{}, false
+}
+
+func GetTastings(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		sessions, err := s.Tastings.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+		for i := range sessions {
+			sessions[i] = tasterView(c, sessions[i])
+		}
+
+		found, err := page(c, sessions)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if err := nameScores(ctx, s, found.Items); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.RespondPage(c, found.Items, found.Total, found.NextCursor)
+	}
+}
+
+func GetTasting(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		session, err := s.Tastings.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if err := nameScores(ctx, s, []models.TastingSession{session}); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", tasterView(c, session))
+	}
+}
+
+func CreateTasting(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request models.TastingSession
+		defer cancel()
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		user, _ := auth.CurrentUser(c)
+		session := models.TastingSession{
+			Id:        primitive.NewObjectID(),
+			CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+			OwnerId:   user.Id,
+			Name:      request.Name,
+			Date:      movementDate(request.Date),
+			Blind:     request.Blind,
+			Samples:   request.Samples,
+			PanelIds:  request.PanelIds,
+		}
+		for i := range session.Samples {
+			session.Samples[i].Id = primitive.NilObjectID
+		}
+
+		if err := checkTasting(ctx, c, s, &session, nil); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if err := s.Tastings.Create(ctx, &session); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusCreated, "success", session.Id)
+	}
+}
+
+// UpdateTasting changes an open session's name, date, samples or panel, or
+// whether it is blind. Samples that are kept must give the ids they were
+// assigned.
+func UpdateTasting(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request models.TastingSession
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		session, err := s.Tastings.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if !organises(c, session) {
+			api.Respond(c, http.StatusForbidden, "error", notOrganiser)
+			return
+		}
+		if session.Closed() {
+			api.Respond(c, http.StatusConflict, "error", "tasting session is closed")
+			return
+		}
+
+		previous := session.Samples
+		session.Name = request.Name
+		session.Date = movementDate(request.Date)
+		session.Blind = request.Blind
+		session.Samples = request.Samples
+		session.PanelIds = request.PanelIds
+		if err := checkTasting(ctx, c, s, &session, previous); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if err := s.Tastings.Update(ctx, &session); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if err := nameScores(ctx, s, []models.TastingSession{session}); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", tasterView(c, session))
+	}
+}
+
+func DeleteTasting(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		session, err := s.Tastings.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if !organises(c, session) {
+			api.Respond(c, http.StatusForbidden, "error", notOrganiser)
+			return
+		}
+
+		if err := s.Tastings.Delete(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", "tasting session deleted")
+	}
+}
+
+// ScoreTasting records the scores of the panellist making the request,
+// replacing any they gave the same samples before.
+func ScoreTasting(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request scoreRequest
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		session, err := s.Tastings.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		user, _ := auth.CurrentUser(c)
+		if !containsId(session.PanelIds, user.Id) {
+			api.Respond(c, http.StatusForbidden, "error", "not on the panel of this tasting session")
+			return
+		}
+		if session.Closed() {
+			api.Respond(c, http.StatusConflict, "error", "tasting session is closed")
+			return
+		}
+
+		now := primitive.NewDateTimeFromTime(time.Now())
+		for _, score := range request.Scores {
+			sample, ok := session.Sample(score.SampleId, score.Code)
+			if !ok {
+				err := missingReferenceError{kind: "sample", id: score.SampleId}
+				if score.SampleId.IsZero() {
+					err.name = score.Code
+				}
+				api.Respond(c, http.StatusBadRequest, "error", err.Error())
+				return
+			}
+			score.SampleId, score.Code = sample.Id, sample.Code
+			if err := resolveDescriptors(ctx, s, &score.Descriptors); err != nil {
+				api.Respond(c, statusFor(err), "error", err.Error())
+				return
+			}
+			score.TasterId = user.Id
+			score.CreatedAt = now
+
+			replaced := false
+			for i, existing := range session.Scores {
+				if existing.SampleId == score.SampleId && existing.TasterId == user.Id {
+					session.Scores[i] = score
+					replaced = true
+				}
+			}
+			if !replaced {
+				session.Scores = append(session.Scores, score)
+			}
+		}
+
+		if err := s.Tastings.Update(ctx, &session); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if err := nameScores(ctx, s, []models.TastingSession{session}); err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", tasterView(c, session))
+	}
+}
+
+// CloseTasting ends a session, fixing its scores and opening its results
+// to every member.
+func CloseTasting(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		session, err := s.Tastings.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if !organises(c, session) {
+			api.Respond(c, http.StatusForbidden, "error", notOrganiser)
+			return
+		}
+		if session.Closed() {
+			api.Respond(c, http.StatusConflict, "error", "tasting session is already closed")
+			return
+		}
+
+		session.ClosedAt = primitive.NewDateTimeFromTime(time.Now())
+		if err := s.Tastings.Update(ctx, &session); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", resultsFor(c, session))
+	}
+}
+
+// GetTastingResults returns the consensus, spread and outliers of each
+// sample. Only those who run the session may see them before it is closed.
+func GetTastingResults(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		session, err := s.Tastings.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		if !session.Closed() && !organises(c, session) {
+			api.Respond(c, http.StatusForbidden, "error", "results are hidden until the tasting session is closed")
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", resultsFor(c, session))
+	}
+}
+
+// GetBatchTastings returns how a batch's samples fared in every closed
+// tasting session it was poured at, oldest first, leaving out blind
+// sessions the request may not yet know the samples of.
+func GetBatchTastings(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if _, err := s.Batches.FindById(ctx, objId); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		sessions, err := s.Tastings.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		found := make([]tastingResults, 0)
+		for _, session := range sessions {
+			if !session.Closed() || !identifies(c, session) {
+				continue
+			}
+			results := panelResults(session)
+			samples := make([]sampleResult, 0)
+			for _, sample := range results.Samples {
+				if sample.BatchId != nil && *sample.BatchId == objId {
+					samples = append(samples, sample)
+				}
+			}
+			if len(samples) == 0 {
+				continue
+			}
+			results.Samples = samples
+			found = append(found, results)
+		}
+		sort.SliceStable(found, func(i, j int) bool { return found[i].Date < found[j].Date })
+
+		api.Respond(c, http.StatusOK, "success", found)
+	}
+}
@@ -1,26 +1,27 @@
 package controllers
 
 import (
+	"aging-api/api"
 	"aging-api/auth"
-	"aging-api/configs"
+	"aging-api/mail"
 	"aging-api/models"
 	"aging-api/responses"
+	"aging-api/store"
 	"context"
-	"log"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var userCollection *mongo.Collection = configs.GetCollection(configs.DB, "users")
 var validate = validator.New()
 
-func CreateUser() gin.HandlerFunc {
+// CreateUser signs a user up and mails them a token to verify their email
+// address with; they cannot log in until they have.
+func CreateUser(s *store.Store, sender mail.Sender) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		var user models.User
@@ -36,7 +37,7 @@ func CreateUser() gin.HandlerFunc {
 			return
 		}
 
-		err := userCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&user)
+		_, err := s.Users.FindByEmail(ctx, user.Email)
 		if err == nil {
 			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "User account already exists", Data: map[string]interface{}{"data": "User account already exists"}})
 			return
@@ -48,53 +49,84 @@ func CreateUser() gin.HandlerFunc {
 			return
 		}
 
+		existing, err := s.Users.FindAll(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		// The first account administers the rest.
+		role := models.RoleReadOnly
+		if len(existing) == 0 {
+			role = models.RoleAdmin
+		}
+
 		newUser := models.User{
 			Id:        primitive.NewObjectID(),
 			CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
 			Email:     user.Email,
 			Password:  passHash,
+			Role:      role,
 		}
 
-		result, err := userCollection.InsertOne(ctx, newUser)
-		if err != nil {
+		if err := s.Users.Create(ctx, &newUser); err != nil {
+			if err == store.ErrDuplicate {
+				c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "User account already exists", Data: map[string]interface{}{"data": "User account already exists"}})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "insert error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": result}})
+		// The first account also gets a distillery to keep records in.
+		// Everyone else joins one when an admin adds them.
+		if role == models.RoleAdmin {
+			organisation := models.Organisation{
+				Id:        primitive.NewObjectID(),
+				CreatedAt: newUser.CreatedAt,
+				Name:      "Default",
+			}
+			if err := s.Organisations.Create(ctx, &organisation); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "insert error", Data: map[string]interface{}{"data": err.Error()}})
+				return
+			}
+			if _, err := addMember(ctx, s, organisation.Id, newUser.Id); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "insert error", Data: map[string]interface{}{"data": err.Error()}})
+				return
+			}
+		}
+
+		if err := sendUserToken(ctx, s, sender, newUser, models.TokenVerifyEmail); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "verification email error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": newUser.Id}})
 		return
 	}
 }
 
-func GetAllUsers() gin.HandlerFunc {
+func GetAllUsers(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		if !auth.Authenticate(c) {
-			return
-		}
-
-		cur, err := userCollection.Find(ctx, bson.D{})
-		results := make([]interface{}, 0)
-		for cur.Next(ctx) {
-			var result bson.D
-			if err := cur.Decode(&result); err != nil {
-				log.Fatal(err)
-			}
-			results = append(results, result)
-		}
+		results, err := s.Users.FindAll(ctx)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
+		for i := range results {
+			results[i].Password = ""
+		}
+
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"users": results}})
 		return
 	}
 }
 
-func UpdateUser() gin.HandlerFunc {
+func UpdateUser(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -114,33 +146,28 @@ func UpdateUser() gin.HandlerFunc {
 			return
 		}
 
-		update := bson.M{"email": user.Email}
-
-		result, err := userCollection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": update})
-
+		updatedUser, err := s.Users.FindById(ctx, objId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		var updatedUser models.User
-
-		if result.MatchedCount == 1 {
-			err := userCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&updatedUser)
+		updatedUser.Email = user.Email
 
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
-				return
-			}
+		if err := s.Users.Update(ctx, &updatedUser); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
 		}
 
+		updatedUser.Password = ""
+
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": updatedUser}})
 		return
 	}
 
 }
 
-func DeleteUser() gin.HandlerFunc {
+func DeleteUser(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		userId := c.Param("id")
@@ -148,17 +175,29 @@ func DeleteUser() gin.HandlerFunc {
 
 		objId, _ := primitive.ObjectIDFromHex(userId)
 
-		result, err := userCollection.DeleteOne(ctx, bson.M{"_id": objId})
+		err := s.Users.Delete(ctx, objId)
+
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "user not found"}})
+			return
+		}
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		if result.DeletedCount < 1 {
-			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "user not found"}})
+		memberships, err := s.Memberships.FindByUser(ctx, objId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
+		for _, membership := range memberships {
+			if err := s.Memberships.Delete(ctx, membership.Id); err != nil && err != store.ErrNotFound {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+				return
+			}
+		}
 
 		c.JSON(http.StatusOK,
 			responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": "user deleted"}},
@@ -166,3 +205,79 @@ func DeleteUser() gin.HandlerFunc {
 		return
 	}
 }
+
+// GetMe returns the authenticated user.
+func GetMe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := auth.CurrentUser(c)
+		if !ok {
+			api.Respond(c, http.StatusUnauthorized, "error", "not authenticated")
+			return
+		}
+
+		user.Password = ""
+		api.Respond(c, http.StatusOK, "success", user)
+	}
+}
+
+type roleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+func SetUserRole(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request roleRequest
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validate.Struct(&request); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		if !models.IsRole(request.Role) {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("unknown role %q", request.Role))
+			return
+		}
+
+		user, err := s.Users.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if user.CurrentRole() == models.RoleAdmin && request.Role != models.RoleAdmin {
+			users, err := s.Users.FindAll(ctx)
+			if err != nil {
+				api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+				return
+			}
+			admins := 0
+			for _, u := range users {
+				if u.CurrentRole() == models.RoleAdmin {
+					admins++
+				}
+			}
+			if admins <= 1 {
+				api.Respond(c, http.StatusConflict, "error", "cannot remove the last admin")
+				return
+			}
+		}
+
+		user.Role = request.Role
+		if err := s.Users.Update(ctx, &user); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		user.Password = ""
+		api.Respond(c, http.StatusOK, "success", user)
+	}
+}
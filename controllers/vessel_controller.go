@@ -1,21 +1,22 @@
 package controllers
 
 import (
-	"aging-api/configs"
+	"aging-api/api"
 	"aging-api/models"
 	"aging-api/responses"
+	"aging-api/store"
 	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var vesselCollection *mongo.Collection = configs.GetCollection(configs.DB, "vessels")
 var validateVessel = validator.New()
 var _ = validateVessel.RegisterValidation(
 	"material",
@@ -53,8 +54,9 @@ var _ = validateVessel.RegisterValidation(
 	},
 )
 
-func CreateVessel() gin.HandlerFunc {
+func CreateVessel(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		var vessel models.Vessel
 		defer cancel()
@@ -63,6 +65,7 @@ func CreateVessel() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest,
 				responses.Response{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"data": err.Error()}},
 			)
+			return
 		}
 
 		if validationErr := validateVessel.Struct(&vessel); validationErr != nil {
@@ -72,46 +75,145 @@ func CreateVessel() gin.HandlerFunc {
 
 		newVessel := models.Vessel{
 			Id:        primitive.NewObjectID(),
-			Batches:   vessel.Batches,
 			CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
 			Volume:    vessel.Volume,
 			Material:  vessel.Material,
 			Process:   vessel.Process,
+			Location:  vessel.Location,
+			Status:    models.VesselEmpty,
 		}
 
-		result, err := vesselCollection.InsertOne(ctx, newVessel)
-		if err != nil {
+		if err := s.Vessels.Create(ctx, &newVessel); err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": result.InsertedID}})
+		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: map[string]interface{}{"data": newVessel.Id}})
 		return
 	}
 }
 
-func GetVessel() gin.HandlerFunc {
+// ListVessels filters on ?status=, on ?minCapacity=, the space still free
+// in the vessel, on ?fillNumber= and on ?priorContents=, a spirit name, and
+// then on any other field like the other listings.
+func ListVessels(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		s, err := pointInTime(c, s)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		status := c.Query("status")
+		if status != "" && !models.IsVesselStatus(status) {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("unknown status %q", status))
+			return
+		}
+
+		var minCapacity float64
+		if value := c.Query("minCapacity"); value != "" {
+			var err error
+			if minCapacity, err = strconv.ParseFloat(value, 32); err != nil {
+				api.Respond(c, http.StatusBadRequest, "error", "minCapacity must be a number")
+				return
+			}
+		}
+
+		fillNumber := -1
+		if value := c.Query("fillNumber"); value != "" {
+			var err error
+			if fillNumber, err = strconv.Atoi(value); err != nil {
+				api.Respond(c, http.StatusBadRequest, "error", "fillNumber must be an integer")
+				return
+			}
+		}
+		priorContents := c.Query("priorContents")
+
+		vessels, err := s.Vessels.FindAll(ctx)
+		if err != nil {
+			api.Respond(c, http.StatusInternalServerError, "error", err.Error())
+			return
+		}
+
+		alcohol, err := newAlcoholContent(ctx, c, s)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		matched := make([]models.Vessel, 0, len(vessels))
+		for _, vessel := range vessels {
+			if status != "" && vessel.CurrentStatus() != status {
+				continue
+			}
+			if vessel.Volume-vessel.FillLevel < float32(minCapacity) {
+				continue
+			}
+			if fillNumber >= 0 && vessel.FillNumber != fillNumber {
+				continue
+			}
+			if priorContents != "" && !containsFold(vessel.PriorContents, priorContents) {
+				continue
+			}
+			matched = append(matched, vessel)
+		}
+
+		found, err := page(c, matched, "status", "minCapacity", "fillNumber", "priorContents")
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+		for i := range found.Items {
+			alcohol.vessel(&found.Items[i])
+		}
+
+		api.RespondPage(c, found.Items, found.Total, found.NextCursor)
+	}
+}
+
+func GetVessel(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
+		s, err := pointInTime(c, s)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		vesselId := c.Param("id")
-		var vessel models.Vessel
 		defer cancel()
 
 		objId, _ := primitive.ObjectIDFromHex(vesselId)
 
-		err := vesselCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&vessel)
+		vessel, err := s.Vessels.FindById(ctx, objId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		if err := expandVessel(ctx, s, &vessel, expansions(c)); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
+		}
+
+		alcohol, err := newAlcoholContent(ctx, c, s)
+		if err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
+		alcohol.vessel(&vessel)
 
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": vessel}})
 		return
 	}
 }
 
-func UpdateVessel() gin.HandlerFunc {
+func UpdateVessel(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		vesselId := c.Param("id")
 		var vessel models.Vessel
@@ -129,28 +231,25 @@ func UpdateVessel() gin.HandlerFunc {
 			return
 		}
 
-		update := bson.M{
-			"Volume":   vessel.Volume,
-			"Material": vessel.Material,
-			"Process":  vessel.Process,
-		}
-
-		result, err := vesselCollection.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": update})
-
+		updatedVessel, err := s.Vessels.FindById(ctx, objId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
-		var updatedVessel models.Vessel
+		if vessel.Volume < updatedVessel.FillLevel {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: map[string]interface{}{"data": "volume is less than the vessel's fill level"}})
+			return
+		}
 
-		if result.MatchedCount == 1 {
-			err := vesselCollection.FindOne(ctx, bson.M{"_id": objId}).Decode(&updatedVessel)
+		updatedVessel.Volume = vessel.Volume
+		updatedVessel.Material = vessel.Material
+		updatedVessel.Process = vessel.Process
+		updatedVessel.Location = vessel.Location
 
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
-				return
-			}
+		if err := s.Vessels.Update(ctx, &updatedVessel); err != nil {
+			c.JSON(statusFor(err), responses.Response{Status: statusFor(err), Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+			return
 		}
 
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: map[string]interface{}{"data": updatedVessel}})
@@ -159,23 +258,24 @@ func UpdateVessel() gin.HandlerFunc {
 	}
 }
 
-func DeleteVessel() gin.HandlerFunc {
+func DeleteVessel(s *store.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		s := scoped(c, s)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		vesselId := c.Param("id")
 		defer cancel()
 
 		objId, _ := primitive.ObjectIDFromHex(vesselId)
 
-		result, err := vesselCollection.DeleteOne(ctx, bson.M{"_id": objId})
+		err := softDelete[models.Vessel](ctx, c, s.Vessels, objId)
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "vessel not found"}})
 			return
 		}
 
-		if result.DeletedCount < 1 {
-			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: map[string]interface{}{"data": "vessel not found"}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: map[string]interface{}{"data": err.Error()}})
 			return
 		}
 
@@ -185,3 +285,115 @@ func DeleteVessel() gin.HandlerFunc {
 		return
 	}
 }
+
+type vesselStatusRequest struct {
+	Status string `json:"status" validate:"required"`
+}
+
+// SetVesselStatus covers the transitions that are not driven by fills,
+// transfers and dumps: resting a filled vessel, marking a dumped vessel as
+// cleaned and empty, and retiring it.
+func SetVesselStatus(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var request vesselStatusRequest
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&request); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if !models.IsVesselStatus(request.Status) {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("unknown status %q", request.Status))
+			return
+		}
+
+		lifecycleMu.Lock()
+		defer lifecycleMu.Unlock()
+
+		vessel, err := s.Vessels.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		current := vessel.CurrentStatus()
+		manual := request.Status != models.VesselFilled && request.Status != models.VesselDumped
+		if current == models.VesselResting && request.Status == models.VesselFilled {
+			manual = true
+		}
+		if !manual || !models.CanTransitionVessel(current, request.Status) {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("cannot change vessel from %s to %s", current, request.Status))
+			return
+		}
+
+		vessel.Status = request.Status
+		if err := s.Vessels.Update(ctx, &vessel); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusOK, "success", vessel)
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddVesselTreatment records a re-char or re-toast, which sets the vessel's
+// process. Only an empty or dumped vessel can be treated.
+func AddVesselTreatment(s *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := scoped(c, s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var treatment models.Treatment
+		defer cancel()
+
+		objId, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+		if err := c.BindJSON(&treatment); err != nil {
+			api.Respond(c, http.StatusBadRequest, "error", err.Error())
+			return
+		}
+
+		if validationErr := validateVessel.Struct(&treatment); validationErr != nil {
+			api.Respond(c, http.StatusBadRequest, "error", validationErr.Error())
+			return
+		}
+
+		lifecycleMu.Lock()
+		defer lifecycleMu.Unlock()
+
+		vessel, err := s.Vessels.FindById(ctx, objId)
+		if err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		if status := vessel.CurrentStatus(); status != models.VesselEmpty && status != models.VesselDumped {
+			api.Respond(c, http.StatusBadRequest, "error", fmt.Sprintf("vessel is %s; only an empty or dumped vessel can be treated", status))
+			return
+		}
+
+		treatment.Date = movementDate(treatment.Date)
+		vessel.Process = treatment.Process
+		vessel.Treatments = append(vessel.Treatments, treatment)
+
+		if err := s.Vessels.Update(ctx, &vessel); err != nil {
+			api.Respond(c, statusFor(err), "error", err.Error())
+			return
+		}
+
+		api.Respond(c, http.StatusCreated, "success", vessel)
+	}
+}
@@ -0,0 +1,449 @@
+// Package listing filters, sorts and pages the documents behind the
+// collection endpoints. Fields are named as they are in the JSON the API
+// returns, so clients filter and sort on what they see.
+//
+// It works in memory on the whole collection the store returns, so each
+// listing costs time and memory in proportion to the collection, not the
+// page. That suits a distillery's records; MaxDocuments stops a collection
+// that has outgrown it from taking the server down with it.
+package listing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+	// MaxDocuments is the largest collection Apply will list.
+	MaxDocuments = 50000
+)
+
+// ErrTooMany is returned for a collection larger than MaxDocuments.
+var ErrTooMany = errors.New("collection is too large to list")
+
+// reserved are the query parameters with a meaning of their own on every
+// collection endpoint.
+var reserved = map[string]bool{
+	"sort": true, "limit": true, "cursor": true,
+	"asOf": true, "deleted": true, "expand": true, "units": true,
+}
+
+var operators = map[string]bool{"eq": true, "ne": true, "gt": true, "gte": true, "lt": true, "lte": true, "in": true}
+
+// Filter keeps documents whose field compares to a value: material=French Oak
+// or createdAt[gte]=2024-01-01. in takes a comma-separated list.
+type Filter struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// Query is a parsed ?sort=-createdAt,volume&limit=20&cursor=… plus filters.
+type Query struct {
+	Filters []Filter
+	Sort    []SortKey
+	Limit   int
+	Cursor  string
+}
+
+// Page is one page of results. Total counts every document that matched
+// the filters; NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T
+	Total      int
+	NextCursor string
+}
+
+// Parse reads a query from request parameters. Parameters named in ignore
+// are handled by the caller and are not taken as filters.
+func Parse(values url.Values, ignore ...string) (Query, error) {
+	query := Query{Limit: DefaultLimit, Cursor: values.Get("cursor")}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return Query{}, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		query.Limit = limit
+	}
+
+	for _, value := range values["sort"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			key := SortKey{Field: strings.TrimPrefix(field, "-"), Descending: strings.HasPrefix(field, "-")}
+			query.Sort = append(query.Sort, key)
+		}
+	}
+
+	skip := make(map[string]bool, len(ignore))
+	for _, name := range ignore {
+		skip[name] = true
+	}
+	for name, list := range values {
+		if reserved[name] || skip[name] {
+			continue
+		}
+		field, operator := name, "eq"
+		if open := strings.Index(name, "["); open > 0 && strings.HasSuffix(name, "]") {
+			field, operator = name[:open], name[open+1:len(name)-1]
+		}
+		if !operators[operator] {
+			return Query{}, fmt.Errorf("unknown operator %q in %s", operator, name)
+		}
+		for _, value := range list {
+			query.Filters = append(query.Filters, Filter{Field: field, Operator: operator, Value: value})
+		}
+	}
+	return query, nil
+}
+
+// fields lists the JSON names of the fields of a struct type, including
+// those of embedded structs.
+func fields(t reflect.Type, names map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			fields(field.Type, names)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+}
+
+// cursor marks where a page ended: the sort the client asked for and the
+// sort values of the last document on it.
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+func (q Query) sortSpec() string {
+	parts := make([]string, len(q.Sort))
+	for i, key := range q.Sort {
+		parts[i] = key.Field
+		if key.Descending {
+			parts[i] = "-" + key.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// keys are the sort fields with the id last, so that no two documents sort
+// the same and pages neither skip nor repeat any.
+func (q Query) keys() []SortKey {
+	keys := append([]SortKey{}, q.Sort...)
+	return append(keys, SortKey{Field: "id"})
+}
+
+type row[T any] struct {
+	document T
+	fields   map[string]interface{}
+}
+
+func (r row[T]) values(keys []SortKey) []interface{} {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = r.fields[key.Field]
+	}
+	return values
+}
+
+// Apply filters, sorts and pages documents. Errors other than ErrTooMany
+// are mistakes in the query, such as an unknown field or a value that
+// cannot be compared.
+func Apply[T any](documents []T, q Query) (Page[T], error) {
+	if len(documents) > MaxDocuments {
+		return Page[T]{}, fmt.Errorf("%w: %d documents, at most %d", ErrTooMany, len(documents), MaxDocuments)
+	}
+
+	known := make(map[string]bool)
+	fields(reflect.TypeOf((*T)(nil)).Elem(), known)
+	for _, filter := range q.Filters {
+		if !known[filter.Field] {
+			return Page[T]{}, fmt.Errorf("cannot filter on %q", filter.Field)
+		}
+	}
+	for _, key := range q.Sort {
+		if !known[key.Field] {
+			return Page[T]{}, fmt.Errorf("cannot sort on %q", key.Field)
+		}
+	}
+
+	rows := make([]row[T], 0, len(documents))
+	for _, document := range documents {
+		encoded, err := json.Marshal(document)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		var decoded map[string]interface{}
+		if err := decode(encoded, &decoded); err != nil {
+			return Page[T]{}, err
+		}
+		matched := true
+		for _, filter := range q.Filters {
+			ok, err := filter.matches(decoded[filter.Field])
+			if err != nil {
+				return Page[T]{}, err
+			}
+			if !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			rows = append(rows, row[T]{document: document, fields: decoded})
+		}
+	}
+
+	keys := q.keys()
+	var sortErr error
+	less := func(a, b []interface{}) bool {
+		order, err := compareKeys(keys, a, b)
+		if err != nil && sortErr == nil {
+			sortErr = err
+		}
+		return order < 0
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return less(rows[i].values(keys), rows[j].values(keys))
+	})
+	if sortErr != nil {
+		return Page[T]{}, sortErr
+	}
+
+	page := Page[T]{Total: len(rows), Items: make([]T, 0)}
+	start := 0
+	if q.Cursor != "" {
+		after, err := q.decodeCursor()
+		if err != nil {
+			return Page[T]{}, err
+		}
+		for start < len(rows) && !less(after, rows[start].values(keys)) {
+			start++
+		}
+	}
+	end := start + q.Limit
+	if end > len(rows) {
+		end = len(rows)
+	}
+	for _, r := range rows[start:end] {
+		page.Items = append(page.Items, r.document)
+	}
+	if end < len(rows) && end > start {
+		page.NextCursor = q.encodeCursor(rows[end-1].values(keys))
+	}
+	return page, sortErr
+}
+
+func decode(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func (q Query) encodeCursor(values []interface{}) string {
+	encoded, _ := json.Marshal(cursor{Sort: q.sortSpec(), Values: values})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func (q Query) decodeCursor() ([]interface{}, error) {
+	invalid := fmt.Errorf("cursor is not valid for this listing")
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	var c cursor
+	if err := decode(data, &c); err != nil || c.Sort != q.sortSpec() || len(c.Values) != len(q.keys()) {
+		return nil, invalid
+	}
+	return c.Values, nil
+}
+
+func compareKeys(keys []SortKey, a, b []interface{}) (int, error) {
+	for i, key := range keys {
+		order, err := compare(a[i], b[i])
+		if err != nil {
+			return 0, fmt.Errorf("cannot sort on %q: %v", key.Field, err)
+		}
+		if key.Descending {
+			order = -order
+		}
+		if order != 0 {
+			return order, nil
+		}
+	}
+	return 0, nil
+}
+
+// compare orders two JSON values of the same type, with null first.
+// Strings that are both times compare as times.
+func compare(a, b interface{}) (int, error) {
+	switch {
+	case a == nil && b == nil:
+		return 0, nil
+	case a == nil:
+		return -1, nil
+	case b == nil:
+		return 1, nil
+	}
+	switch a := a.(type) {
+	case json.Number:
+		if b, ok := b.(json.Number); ok {
+			x, _ := a.Float64()
+			y, _ := b.Float64()
+			return compareFloats(x, y), nil
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			if x, ok := parseTime(a); ok {
+				if y, ok := parseTime(b); ok {
+					return compareTimes(x, y), nil
+				}
+			}
+			return strings.Compare(a, b), nil
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case !a:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, fmt.Errorf("values are not comparable")
+}
+
+func compareTimes(x, y time.Time) int {
+	switch {
+	case x.Before(y):
+		return -1
+	case x.After(y):
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// parseTime reads an RFC 3339 time or a YYYY-MM-DD date, which is the
+// start of that day in UTC.
+func parseTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// operand converts a filter value to the JSON type of the field it is
+// compared with.
+func operand(field interface{}, value string) (interface{}, error) {
+	switch field.(type) {
+	case json.Number:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return json.Number(value), nil
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not true or false", value)
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+func (f Filter) matches(field interface{}) (bool, error) {
+	if list, ok := field.([]interface{}); ok {
+		if f.Operator != "eq" && f.Operator != "in" {
+			return false, fmt.Errorf("%s is a list and can only be matched with eq or in", f.Field)
+		}
+		for _, element := range list {
+			if ok, err := f.matches(element); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
+	if f.Operator == "in" {
+		for _, value := range strings.Split(f.Value, ",") {
+			if ok, err := (Filter{Field: f.Field, Operator: "eq", Value: strings.TrimSpace(value)}).matches(field); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
+	if field == nil {
+		return f.Operator == "ne", nil
+	}
+	value, err := operand(field, f.Value)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", f.Field, err)
+	}
+
+	// Plain text is matched regardless of case, as people type it.
+	order := 1
+	text, isText := field.(string)
+	if _, isTime := parseTime(text); isText && !isTime && (f.Operator == "eq" || f.Operator == "ne") {
+		if strings.EqualFold(text, f.Value) {
+			order = 0
+		}
+	} else if order, err = compare(field, value); err != nil {
+		return false, fmt.Errorf("%s: %v", f.Field, err)
+	}
+
+	switch f.Operator {
+	case "eq":
+		return order == 0, nil
+	case "ne":
+		return order != 0, nil
+	case "gt":
+		return order > 0, nil
+	case "gte":
+		return order >= 0, nil
+	case "lt":
+		return order < 0, nil
+	}
+	return order <= 0, nil
+}
@@ -0,0 +1,114 @@
+package listing
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+type cask struct {
+	Id        string   `json:"id"`
+	CreatedAt string   `json:"createdAt"`
+	Material  string   `json:"material"`
+	Volume    float64  `json:"volume"`
+	Prior     []string `json:"priorContents"`
+	Retired   bool     `json:"retired"`
+}
+
+var casks = []cask{
+	{Id: "a", CreatedAt: "2024-01-05T10:00:00Z", Material: "French Oak", Volume: 225, Prior: []string{"Sherry"}},
+	{Id: "b", CreatedAt: "2024-02-01T10:00:00Z", Material: "American Oak", Volume: 200, Prior: []string{"Bourbon"}},
+	{Id: "c", CreatedAt: "2024-03-01T10:00:00Z", Material: "French Oak", Volume: 500, Retired: true},
+	{Id: "d", CreatedAt: "2024-03-02T10:00:00Z", Material: "American Oak", Volume: 200},
+}
+
+func ids(items []cask) string {
+	result := ""
+	for _, item := range items {
+		result += item.Id
+	}
+	return result
+}
+
+func mustParse(t *testing.T, query string) Query {
+	t.Helper()
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := Parse(values)
+	if err != nil {
+		t.Fatalf("Parse %q: %v", query, err)
+	}
+	return q
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"", "abcd"},
+		{"material=french oak", "ac"},
+		{"material[ne]=French Oak", "bd"},
+		{"createdAt[gte]=2024-02-01", "bcd"},
+		{"createdAt[lt]=2024-03-01T10:00:00Z&volume[gt]=200", "a"},
+		{"volume[in]=200,500", "bcd"},
+		{"priorContents=bourbon", "b"},
+		{"retired=true", "c"},
+	}
+	for _, test := range tests {
+		page, err := Apply(casks, mustParse(t, test.query))
+		if err != nil || ids(page.Items) != test.want || page.Total != len(test.want) {
+			t.Errorf("Apply %q: got %v (total %v), %v, want %v", test.query, ids(page.Items), page.Total, err, test.want)
+		}
+	}
+
+	for _, query := range []string{"colour=red", "volume=lots", "priorContents[gt]=a", "sort=colour"} {
+		if _, err := Apply(casks, mustParse(t, query)); err == nil {
+			t.Errorf("Apply %q: expected an error", query)
+		}
+	}
+	if _, err := Parse(url.Values{"volume[about]": {"200"}}); err == nil {
+		t.Error("Parse unknown operator: expected an error")
+	}
+	if _, err := Parse(url.Values{"limit": {"0"}}); err == nil {
+		t.Error("Parse limit 0: expected an error")
+	}
+}
+
+func TestSortAndPages(t *testing.T) {
+	page, err := Apply(casks, mustParse(t, "sort=-volume,createdAt"))
+	if err != nil || ids(page.Items) != "cabd" {
+		t.Errorf("Sort: got %v, %v", ids(page.Items), err)
+	}
+
+	seen := ""
+	q := mustParse(t, "sort=material,-createdAt&limit=3")
+	for pages := 0; pages < 3; pages++ {
+		page, err := Apply(casks, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen += ids(page.Items)
+		if page.Total != 4 || page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if seen != "dbca" {
+		t.Errorf("Pages: got %v, want dbca", seen)
+	}
+
+	q = mustParse(t, "limit=2")
+	first, _ := Apply(casks, q)
+	q = mustParse(t, "sort=volume&cursor="+first.NextCursor)
+	if _, err := Apply(casks, q); err == nil {
+		t.Error("Cursor from another sort: expected an error")
+	}
+}
+
+func TestTooMany(t *testing.T) {
+	if _, err := Apply(make([]cask, MaxDocuments+1), mustParse(t, "")); !errors.Is(err, ErrTooMany) {
+		t.Errorf("Apply %d documents: got %v, want %v", MaxDocuments+1, err, ErrTooMany)
+	}
+}
@@ -0,0 +1,52 @@
+// Package mail sends the emails the API needs, such as address
+// verification and password resets. Only development senders live here;
+// a real transport implements Sender.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// LogSender writes messages to the standard logger.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, message Message) error {
+	log.Printf("mail to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
+
+// FileSender appends messages to a file, one after another.
+type FileSender struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (f *FileSender) Send(ctx context.Context, message Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), message.To, message.Subject, message.Body)
+	return err
+}
@@ -0,0 +1,26 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSender(t *testing.T) {
+	sender := &FileSender{Path: filepath.Join(t.TempDir(), "mail.log")}
+	for _, to := range []string{"a@test.test", "b@test.test"} {
+		if err := sender.Send(context.Background(), Message{To: to, Subject: "Hello", Body: "token"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written, err := os.ReadFile(sender.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "To: a@test.test") || !strings.Contains(string(written), "To: b@test.test") {
+		t.Errorf("FileSender wrote: %s", written)
+	}
+}
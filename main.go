@@ -1,21 +1,107 @@
 package main
 
 import (
+	"aging-api/configs"
+	"aging-api/mail"
+	"aging-api/models"
+	"aging-api/retention"
 	"aging-api/routes"
+	"aging-api/search"
+	"aging-api/store"
+	"context"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func main() {
+func setupRouter(s *store.Store, sender mail.Sender) *gin.Engine {
+	indexer := search.NewIndexer(search.NewMemoryIndex(), s)
+	s = indexer.Watch(s)
+
 	router := gin.Default()
+	if err := router.SetTrustedProxies(configs.EnvTrustedProxies()); err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
 	router.GET("/api/v1", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"data": "Hello world"})
 	})
-	routes.AuthRoute(router)
-	routes.MeasurementRoute(router)
-	routes.SpiritRoute(router)
-	routes.UserRoute(router)
-	routes.VesselRoute(router)
+	routes.AuditRoute(router, s)
+	routes.AuthRoute(router, s, sender)
+	routes.BatchRoute(router, s)
+	routes.DescriptorRoute(router, s)
+	routes.MeasurementRoute(router, s)
+	routes.ReportRoute(router, s)
+	routes.SearchRoute(router, s, indexer)
+	routes.SpiritRoute(router, s)
+	routes.TastingRoute(router, s)
+	routes.UserRoute(router, s, sender)
+	routes.VesselRoute(router, s)
+	return router
+}
+
+// grantAdmin makes an existing account an admin, for deployments that
+// predate roles or have locked themselves out.
+func grantAdmin(s *store.Store, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := s.Users.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	user.Role = models.RoleAdmin
+	return s.Users.Update(ctx, &user)
+}
+
+// retentionPeriod is how long deleted records can still be restored.
+func retentionPeriod(days int) time.Duration {
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		driver := configs.EnvDatabaseDriver()
+		if driver != "sqlite" && driver != "postgres" {
+			log.Fatalf("migrate: DATABASE_DRIVER %q has no schema migrations", driver)
+		}
+		configs.MigrateSQL(configs.ConnectSQL())
+		return
+	}
+
+	if len(os.Args) > 2 && os.Args[1] == "grant-admin" {
+		if err := grantAdmin(configs.ConnectStore(), os.Args[2]); err != nil {
+			log.Fatalf("grant-admin: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		days := configs.EnvRetentionDays()
+		if len(os.Args) > 2 {
+			var err error
+			if days, err = strconv.Atoi(os.Args[2]); err != nil || days < 0 {
+				log.Fatalf("purge: %q is not a number of days", os.Args[2])
+			}
+		} else if days == 0 {
+			log.Fatal("purge: RETENTION_DAYS is unset or 0, so deleted records are kept; give a number of days to purge anyway")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		n, err := retention.Purge(ctx, configs.ConnectStore(), retentionPeriod(days))
+		if err != nil {
+			log.Fatalf("purge: %v", err)
+		}
+		log.Printf("purge: removed %d deleted records", n)
+		return
+	}
+
+	s := configs.ConnectStore()
+	go retention.Run(context.Background(), s, retentionPeriod(configs.EnvRetentionDays()), time.Hour)
+
+	router := setupRouter(s, configs.MailSender())
 	router.Run()
 }
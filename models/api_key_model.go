@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ApiKey lets scripts and devices act as the user who created it, limited
+// to its Scopes. Only a SHA-256 hash of the key is stored; Prefix is kept
+// so the owner can tell keys apart.
+type ApiKey struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CreatedAt primitive.DateTime `json:"createdAt"`
+	UserId    primitive.ObjectID `json:"userId"`
+	Label     string             `json:"label" validate:"required"`
+	Prefix    string             `json:"prefix"`
+	KeyHash   string             `json:"-"`
+	Scopes    []string           `json:"scopes" validate:"required,min=1"`
+	// ExpiresAt is optional; zero means the key does not expire.
+	ExpiresAt primitive.DateTime `json:"expiresAt,omitempty"`
+	RevokedAt primitive.DateTime `json:"revokedAt,omitempty"`
+}
+
+func (k ApiKey) Active(now time.Time) bool {
+	return k.RevokedAt == 0 && (k.ExpiresAt == 0 || now.Before(k.ExpiresAt.Time()))
+}
+
+func (k ApiKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Deleting a document marks it deleted; restoring it clears the mark and
+// purging it removes it for good.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// AuditEntry records one write to a spirit, batch, vessel, measurement or
+// movement: who made it, when, and each field it changed. Entries are only
+// ever appended.
+type AuditEntry struct {
+	Id             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CreatedAt      primitive.DateTime  `json:"createdAt"`
+	OrganisationId primitive.ObjectID  `json:"organisationId"`
+	ActorId        primitive.ObjectID  `json:"actorId"`
+	ApiKeyId       *primitive.ObjectID `json:"apiKeyId,omitempty" bson:",omitempty"`
+	Entity         string              `json:"entity"`
+	EntityId       primitive.ObjectID  `json:"entityId"`
+	Operation      string              `json:"operation"`
+	Changes        map[string]Change   `json:"changes"`
+}
+
+// Change is the JSON value of a field before and after a write; null when
+// the document did not exist.
+type Change struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
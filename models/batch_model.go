@@ -1,11 +1,23 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"aging-api/units"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Batch struct {
-	Id           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	CreatedAt    primitive.DateTime `json:"createdAt"`
-	Vessels      []Vessel           `json:"vessels"`
-	Measurements []Measurement      `json:"measurements"`
-	Volume       float32            `json:"volume,omitempty" validate:"required"`
+	Id             primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	CreatedAt      primitive.DateTime   `json:"createdAt"`
+	OrganisationId primitive.ObjectID   `json:"organisationId"`
+	VesselIds      []primitive.ObjectID `json:"vesselIds"`
+	MeasurementIds []primitive.ObjectID `json:"measurementIds"`
+	Volume         float32              `json:"volume,omitempty" validate:"required"`
+
+	Deletion `bson:",inline"`
+
+	Vessels      []Vessel      `json:"vessels,omitempty" bson:"-"`
+	Measurements []Measurement `json:"measurements,omitempty" bson:"-"`
+	// Alcohol is computed from the latest ABV reading for responses.
+	Alcohol *units.Content `json:"alcohol,omitempty" bson:"-"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Deletion marks a document as deleted without removing it, so that it can
+// be restored until the retention job purges it.
+type Deletion struct {
+	DeletedAt primitive.DateTime  `json:"deletedAt,omitempty"`
+	DeletedBy *primitive.ObjectID `json:"deletedBy,omitempty" bson:",omitempty"`
+}
+
+// Deleted reports whether the document has been deleted.
+func (d Deletion) Deleted() bool {
+	return d.DeletedAt != 0
+}
+
+// Tombstone gives generic code access to the Deletion embedded in a model.
+func (d *Deletion) Tombstone() *Deletion {
+	return d
+}
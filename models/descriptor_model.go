@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Descriptor is a term of an organisation's flavour wheel. Descriptors
+// without a parent are the wheel's categories, such as Fruity; the others
+// refine their parent, as Dried Fruit does Fruity.
+type Descriptor struct {
+	Id             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CreatedAt      primitive.DateTime  `json:"createdAt"`
+	OrganisationId primitive.ObjectID  `json:"organisationId"`
+	ParentId       *primitive.ObjectID `json:"parentId,omitempty" bson:",omitempty"`
+	Name           string              `json:"name" validate:"required"`
+	// Synonyms are other words tasters use for the descriptor, such as
+	// vanillin for Vanilla, and are matched as its name is.
+	Synonyms []string `json:"synonyms"`
+
+	Children []Descriptor `json:"children,omitempty" bson:"-"`
+}
+
+// Terms are the descriptor's name and synonyms in the form they are matched
+// in, ignoring case and surrounding space.
+func (d Descriptor) Terms() []string {
+	terms := []string{NormaliseTerm(d.Name)}
+	for _, synonym := range d.Synonyms {
+		terms = append(terms, NormaliseTerm(synonym))
+	}
+	return terms
+}
+
+func NormaliseTerm(term string) string {
+	return strings.ToLower(strings.Join(strings.Fields(term), " "))
+}
+
+// DescriptorTag records how strongly a descriptor came through in a
+// tasting, from 1, faint, to 5, dominant. A tag may name its descriptor
+// instead of giving its id; Name is then looked up among names and
+// synonyms. Only the id is stored, and Name reads as the descriptor's
+// current name.
+type DescriptorTag struct {
+	DescriptorId primitive.ObjectID `json:"descriptorId"`
+	Name         string             `json:"name,omitempty" validate:"required_without=DescriptorId"`
+	Intensity    int                `json:"intensity" validate:"min=1,max=5"`
+}
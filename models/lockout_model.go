@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lockout tracks failed logins for one account ("email:...") or client
+// address ("ip:..."). Lockouts counts how many times the key has been
+// locked, which sets how long the next lock lasts.
+type Lockout struct {
+	Id            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CreatedAt     primitive.DateTime `json:"createdAt"`
+	Key           string             `json:"key"`
+	Failures      int                `json:"failures"`
+	LastFailureAt primitive.DateTime `json:"lastFailureAt"`
+	Lockouts      int                `json:"lockouts"`
+	LockedAt      primitive.DateTime `json:"lockedAt,omitempty"`
+	LockedUntil   primitive.DateTime `json:"lockedUntil,omitempty"`
+}
+
+func (l Lockout) Locked(now time.Time) bool {
+	return now.Before(l.LockedUntil.Time())
+}
@@ -3,13 +3,33 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Measurement struct {
-	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	CreatedAt  primitive.DateTime `json:"createdAt"`
-	ABV        float32            `json:"abv,omitempty" validate:"required"`
-	Image      string             `json:"image,omitempty" validate:"required"`
-	Nose       string             `json:"nose,omitempty"`
-	ForePalate string             `json:"forePalate,omitempty"`
-	MidPalate  string             `json:"midPalate,omitempty"`
-	Finish     string             `json:"finish,omitempty"`
-	Notes      string             `json:"notes,omitempty"`
+	Id             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CreatedAt      primitive.DateTime  `json:"createdAt"`
+	OrganisationId primitive.ObjectID  `json:"organisationId"`
+	Date           primitive.DateTime  `json:"date"`
+	BatchId        *primitive.ObjectID `json:"batchId,omitempty" bson:",omitempty"`
+	VesselId       *primitive.ObjectID `json:"vesselId,omitempty" bson:",omitempty"`
+	// Volume is an optional reading of what the vessel holds.
+	Volume float32 `json:"volume,omitempty"`
+	// ABV is the true strength at 20 °C. When a hydrometer reading is
+	// submitted as ApparentABV and Temperature, ABV is computed from them.
+	ABV         float32  `json:"abv,omitempty" validate:"required_without_all=Volume ApparentABV"`
+	ApparentABV float32  `json:"apparentABV,omitempty" validate:"omitempty,gt=0,lte=100"`
+	Temperature *float32 `json:"temperature,omitempty" validate:"required_with=ApparentABV,omitempty,gte=-20,lte=40"`
+	Image       string   `json:"image,omitempty" validate:"required"`
+	Nose        string   `json:"nose,omitempty"`
+	ForePalate  string   `json:"forePalate,omitempty"`
+	MidPalate   string   `json:"midPalate,omitempty"`
+	Finish      string   `json:"finish,omitempty"`
+	Notes       string   `json:"notes,omitempty"`
+	// Descriptors are the tasting in terms of the flavour wheel, next to
+	// the free text above.
+	Descriptors []DescriptorTag `json:"descriptors,omitempty" validate:"dive"`
+	// TastingId is the panel tasting the measurement records the result
+	// of, with the panel's consensus Score out of 100. Both are set when
+	// the session is revealed.
+	TastingId *primitive.ObjectID `json:"tastingId,omitempty" bson:",omitempty"`
+	Score     *float32            `json:"score,omitempty"`
+
+	Deletion `bson:",inline"`
 }
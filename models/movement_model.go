@@ -0,0 +1,23 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	MovementFill     = "fill"
+	MovementTransfer = "transfer"
+	MovementDump     = "dump"
+)
+
+// Movement is one entry in the ledger of spirit going into, between and out
+// of vessels. A fill has only ToVesselId, a dump only FromVesselId.
+type Movement struct {
+	Id             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CreatedAt      primitive.DateTime  `json:"createdAt"`
+	OrganisationId primitive.ObjectID  `json:"organisationId"`
+	Date           primitive.DateTime  `json:"date"`
+	BatchId        primitive.ObjectID  `json:"batchId"`
+	Type           string              `json:"type"`
+	FromVesselId   *primitive.ObjectID `json:"fromVesselId,omitempty" bson:",omitempty"`
+	ToVesselId     *primitive.ObjectID `json:"toVesselId,omitempty" bson:",omitempty"`
+	Volume         float32             `json:"volume"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Organisation is a distillery. Spirits, batches, vessels, measurements and
+// movements each belong to one and are only visible to its members.
+type Organisation struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CreatedAt primitive.DateTime `json:"createdAt"`
+	Name      string             `json:"name" validate:"required"`
+}
+
+// Membership puts a user in an organisation. A user may belong to several.
+type Membership struct {
+	Id             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CreatedAt      primitive.DateTime `json:"createdAt"`
+	OrganisationId primitive.ObjectID `json:"organisationId"`
+	UserId         primitive.ObjectID `json:"userId" validate:"required"`
+}
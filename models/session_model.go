@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is a login that can be refreshed until it expires or is revoked.
+// Only a SHA-256 hash of its current refresh token is stored. Refreshing
+// revokes the session and points ReplacedBy at the one that follows it.
+type Session struct {
+	Id         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CreatedAt  primitive.DateTime  `json:"createdAt"`
+	UserId     primitive.ObjectID  `json:"userId"`
+	TokenHash  string              `json:"-"`
+	ExpiresAt  primitive.DateTime  `json:"expiresAt"`
+	RevokedAt  primitive.DateTime  `json:"revokedAt,omitempty"`
+	ReplacedBy *primitive.ObjectID `json:"replacedBy,omitempty" bson:",omitempty"`
+}
+
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == 0 && now.Before(s.ExpiresAt.Time())
+}
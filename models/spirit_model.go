@@ -1,14 +1,24 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"aging-api/units"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Spirit struct {
-	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	CreatedAt  primitive.DateTime `json:"createdAt"`
-	Batches    []Batch            `json:"batches"`
-	Volume     float32            `json:"volume,omitempty" validate:"required"`
-	Name       string             `json:"name,omitempty" validate:"required"`
-	Type       string             `json:"type,omitempty"`
-	InitialABV float32            `json:"initialABV,omitempty" validate:"required"`
-	RecipeName string             `json:"recipeName,omitempty"`
+	Id             primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	CreatedAt      primitive.DateTime   `json:"createdAt"`
+	OrganisationId primitive.ObjectID   `json:"organisationId"`
+	BatchIds       []primitive.ObjectID `json:"batchIds"`
+	Volume         float32              `json:"volume,omitempty" validate:"required"`
+	Name           string               `json:"name,omitempty" validate:"required"`
+	Type           string               `json:"type,omitempty"`
+	InitialABV     float32              `json:"initialABV,omitempty" validate:"required"`
+	RecipeName     string               `json:"recipeName,omitempty"`
+
+	Deletion `bson:",inline"`
+
+	Batches []Batch        `json:"batches,omitempty" bson:"-"`
+	Alcohol *units.Content `json:"alcohol,omitempty" bson:"-"`
 }
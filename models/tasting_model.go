@@ -0,0 +1,68 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// TastingSession is a panel tasting: each member of the panel scores the
+// same samples, blind to one another's scores until the session is closed.
+// A Blind session also keeps from the panel what each sample is until its
+// owner reveals it.
+type TastingSession struct {
+	Id             primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	CreatedAt      primitive.DateTime   `json:"createdAt"`
+	OrganisationId primitive.ObjectID   `json:"organisationId"`
+	OwnerId        primitive.ObjectID   `json:"ownerId"`
+	Name           string               `json:"name" validate:"required"`
+	Date           primitive.DateTime   `json:"date"`
+	Blind          bool                 `json:"blind"`
+	Samples        []TastingSample      `json:"samples" validate:"required,min=1,max=100,dive"`
+	PanelIds       []primitive.ObjectID `json:"panelIds" validate:"required,min=1"`
+	Scores         []TastingScore       `json:"scores"`
+	// ClosedAt is set once the panel has finished; scores can no longer
+	// change and the results are open to everyone.
+	ClosedAt primitive.DateTime `json:"closedAt,omitempty"`
+	// RevealedAt is set when the owner reveals the samples and the results
+	// are recorded as measurements.
+	RevealedAt primitive.DateTime `json:"revealedAt,omitempty"`
+}
+
+// TastingSample is a batch poured for the panel, drawn from a vessel if
+// VesselId is set. Code is what the panel knows it by.
+type TastingSample struct {
+	Id       primitive.ObjectID  `json:"id"`
+	Code     string              `json:"code"`
+	BatchId  *primitive.ObjectID `json:"batchId,omitempty" validate:"required"`
+	VesselId *primitive.ObjectID `json:"vesselId,omitempty"`
+	// MeasurementId is the measurement the panel's result was recorded as.
+	MeasurementId *primitive.ObjectID `json:"measurementId,omitempty"`
+}
+
+// TastingScore is one panellist's score of a sample, out of 100, with
+// their notes. A panellist may name the sample by its code.
+type TastingScore struct {
+	SampleId    primitive.ObjectID `json:"sampleId" validate:"required_without=Code"`
+	Code        string             `json:"code,omitempty"`
+	TasterId    primitive.ObjectID `json:"tasterId"`
+	CreatedAt   primitive.DateTime `json:"createdAt"`
+	Score       float64            `json:"score" validate:"min=0,max=100"`
+	Notes       string             `json:"notes,omitempty"`
+	Descriptors []DescriptorTag    `json:"descriptors,omitempty" validate:"dive"`
+}
+
+func (t TastingSession) Closed() bool {
+	return t.ClosedAt != 0
+}
+
+func (t TastingSession) Revealed() bool {
+	return t.RevealedAt != 0
+}
+
+// Sample finds a sample of the session by its id, or by its code if id is
+// zero.
+func (t TastingSession) Sample(id primitive.ObjectID, code string) (TastingSample, bool) {
+	for _, sample := range t.Samples {
+		if (!id.IsZero() && sample.Id == id) || (id.IsZero() && code != "" && sample.Code == code) {
+			return sample, true
+		}
+	}
+	return TastingSample{}, false
+}
@@ -5,6 +5,11 @@ import "go.mongodb.org/mongo-driver/bson/primitive"
 type User struct {
 	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	CreatedAt primitive.DateTime `json:"createdAt"`
-	Email     string             `json:"email,omitempty" validate:"required"`
+	Email     string             `json:"email,omitempty" validate:"required,email"`
 	Password  string             `json:"password,omitempty" validate:"required"`
+	// Role is assigned by an admin through PUT /api/v1/users/:id/role.
+	Role string `json:"role,omitempty"`
+	// EmailVerified is set once the user follows the link mailed on sign-up;
+	// until then they cannot log in.
+	EmailVerified bool `json:"emailVerified"`
 }
@@ -0,0 +1,27 @@
+package models
+
+const (
+	RoleAdmin        = "admin"
+	RoleCellarMaster = "cellar_master"
+	RoleTaster       = "taster"
+	RoleReadOnly     = "read_only"
+)
+
+var roles = []string{RoleAdmin, RoleCellarMaster, RoleTaster, RoleReadOnly}
+
+func IsRole(role string) bool {
+	for _, known := range roles {
+		if known == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentRole treats users stored before roles existed as read-only.
+func (u User) CurrentRole() string {
+	if u.Role == "" {
+		return RoleReadOnly
+	}
+	return u.Role
+}
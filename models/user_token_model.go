@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// UserToken is a single-use token mailed to a user to prove they own their
+// email address. Only a SHA-256 hash of it is stored.
+type UserToken struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CreatedAt primitive.DateTime `json:"createdAt"`
+	UserId    primitive.ObjectID `json:"userId"`
+	Purpose   string             `json:"purpose"`
+	TokenHash string             `json:"-"`
+	ExpiresAt primitive.DateTime `json:"expiresAt"`
+	UsedAt    primitive.DateTime `json:"usedAt,omitempty"`
+}
+
+func (t UserToken) Usable(purpose string, now time.Time) bool {
+	return t.Purpose == purpose && t.UsedAt == 0 && now.Before(t.ExpiresAt.Time())
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Version is a spirit, batch or vessel exactly as it was written at
+// CreatedAt, kept so it can be read back as of any later time. A delete
+// leaves a version with a null Document.
+type Version struct {
+	Id             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CreatedAt      primitive.DateTime `json:"createdAt"`
+	OrganisationId primitive.ObjectID `json:"organisationId"`
+	Entity         string             `json:"entity"`
+	EntityId       primitive.ObjectID `json:"entityId"`
+	Operation      string             `json:"operation"`
+	Document       json.RawMessage    `json:"document"`
+}
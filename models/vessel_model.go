@@ -1,12 +1,38 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"aging-api/units"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Vessel struct {
-	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Batches   []Batch            `json:"batches"`
-	CreatedAt primitive.DateTime `json:"createdAt"`
-	Volume    float32            `json:"volume,omitempty" validate:"required"`
-	Material  string             `json:"material,omitempty" validate:"material"`
-	Process   string             `json:"process" validate:"process"`
+	Id primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// BatchIds is maintained from the batch side through Batch.VesselIds.
+	BatchIds       []primitive.ObjectID `json:"batchIds"`
+	CreatedAt      primitive.DateTime   `json:"createdAt"`
+	OrganisationId primitive.ObjectID   `json:"organisationId"`
+	Volume         float32              `json:"volume,omitempty" validate:"required"`
+	Material       string               `json:"material,omitempty" validate:"material"`
+	Process        string               `json:"process" validate:"process"`
+	Location       string               `json:"location,omitempty"`
+	FillLevel      float32              `json:"fillLevel"`
+	Status         string               `json:"status"`
+	// FillNumber and PriorContents are derived from the vessel's movements
+	// each time spirit goes into it; 1 is a first-fill cask.
+	FillNumber    int         `json:"fillNumber"`
+	PriorContents []string    `json:"priorContents"`
+	Treatments    []Treatment `json:"treatments"`
+
+	Deletion `bson:",inline"`
+
+	Batches []Batch        `json:"batches,omitempty" bson:"-"`
+	Alcohol *units.Content `json:"alcohol,omitempty" bson:"-"`
+}
+
+// Treatment is a re-char or re-toast of the vessel between fills.
+type Treatment struct {
+	Date    primitive.DateTime `json:"date"`
+	Process string             `json:"process" validate:"required,process"`
+	Notes   string             `json:"notes,omitempty"`
 }
@@ -0,0 +1,42 @@
+package models
+
+const (
+	VesselEmpty   = "empty"
+	VesselFilled  = "filled"
+	VesselResting = "resting"
+	VesselDumped  = "dumped"
+	VesselRetired = "retired"
+)
+
+// vesselTransitions lists the statuses each status may move to. A dumped
+// vessel has to be marked empty again (cleaned) before it can be refilled,
+// and a retired vessel never changes again.
+var vesselTransitions = map[string][]string{
+	VesselEmpty:   {VesselFilled, VesselRetired},
+	VesselFilled:  {VesselFilled, VesselResting, VesselDumped},
+	VesselResting: {VesselFilled, VesselResting, VesselDumped},
+	VesselDumped:  {VesselEmpty, VesselRetired},
+	VesselRetired: {},
+}
+
+func IsVesselStatus(status string) bool {
+	_, ok := vesselTransitions[status]
+	return ok
+}
+
+func CanTransitionVessel(from string, to string) bool {
+	for _, allowed := range vesselTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentStatus treats vessels stored before statuses existed as empty.
+func (v Vessel) CurrentStatus() string {
+	if v.Status == "" {
+		return VesselEmpty
+	}
+	return v.Status
+}
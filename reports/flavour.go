@@ -0,0 +1,159 @@
+package reports
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Tag is how strongly a descriptor came through in a tasting.
+type Tag struct {
+	Descriptor string
+	Intensity  float64
+}
+
+// Tasting is the descriptors noted at one measurement.
+type Tasting struct {
+	Date time.Time
+	Tags []Tag
+}
+
+// Term is a descriptor of the flavour wheel with the category at the root
+// of its branch, which is itself for a category.
+type Term struct {
+	Name     string
+	Category string
+}
+
+// Intensity is the mean strength of a descriptor or category over the
+// tastings of a period, counting those that did not note it as zero, and in
+// how many tastings it was noted.
+type Intensity struct {
+	Id        string  `json:"id"`
+	Name      string  `json:"name"`
+	Intensity float64 `json:"intensity"`
+	Count     int     `json:"count"`
+}
+
+// FlavourPeriod is the profile of a batch over one period.
+type FlavourPeriod struct {
+	Period      string      `json:"period"`
+	Start       time.Time   `json:"start"`
+	Tastings    int         `json:"tastings"`
+	Descriptors []Intensity `json:"descriptors"`
+	Categories  []Intensity `json:"categories"`
+}
+
+// Period groups tastings: each on its own, or by month or year.
+type Period string
+
+const (
+	EachTasting Period = "tasting"
+	ByMonth     Period = "month"
+	ByYear      Period = "year"
+)
+
+func IsPeriod(period string) bool {
+	switch Period(period) {
+	case EachTasting, ByMonth, ByYear:
+		return true
+	}
+	return false
+}
+
+func (p Period) of(date time.Time) (string, time.Time) {
+	date = date.UTC()
+	switch p {
+	case ByYear:
+		start := time.Date(date.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		return start.Format("2006"), start
+	case ByMonth:
+		start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01"), start
+	}
+	return date.Format(time.RFC3339), date
+}
+
+type accumulator struct {
+	sum   map[string]float64
+	count map[string]int
+}
+
+func newAccumulator() accumulator {
+	return accumulator{sum: make(map[string]float64), count: make(map[string]int)}
+}
+
+func (a accumulator) add(id string, intensity float64) {
+	a.sum[id] += intensity
+	a.count[id]++
+}
+
+func (a accumulator) intensities(tastings int, name func(string) string) []Intensity {
+	result := make([]Intensity, 0, len(a.sum))
+	for id, sum := range a.sum {
+		result = append(result, Intensity{Id: id, Name: name(id), Intensity: round(sum / float64(tastings)), Count: a.count[id]})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Intensity != result[j].Intensity {
+			return result[i].Intensity > result[j].Intensity
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// FlavourProfile follows how strongly each descriptor, and each category of
+// the wheel, came through from period to period. A category's strength in a
+// tasting is that of its strongest descriptor. Tags of descriptors missing
+// from terms are left out.
+func FlavourProfile(tastings []Tasting, terms map[string]Term, period Period) []FlavourPeriod {
+	sorted := append([]Tasting{}, tastings...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	name := func(id string) string { return terms[id].Name }
+	var periods []FlavourPeriod
+	var descriptors, categories accumulator
+	finish := func() {
+		if len(periods) == 0 {
+			return
+		}
+		last := &periods[len(periods)-1]
+		last.Descriptors = descriptors.intensities(last.Tastings, name)
+		last.Categories = categories.intensities(last.Tastings, name)
+	}
+
+	for _, tasting := range sorted {
+		label, start := period.of(tasting.Date)
+		if len(periods) == 0 || periods[len(periods)-1].Period != label {
+			finish()
+			periods = append(periods, FlavourPeriod{Period: label, Start: start})
+			descriptors, categories = newAccumulator(), newAccumulator()
+		}
+		periods[len(periods)-1].Tastings++
+
+		strongest := make(map[string]float64)
+		for _, tag := range tasting.Tags {
+			term, ok := terms[tag.Descriptor]
+			if !ok {
+				continue
+			}
+			descriptors.add(tag.Descriptor, tag.Intensity)
+			if tag.Intensity > strongest[term.Category] {
+				strongest[term.Category] = tag.Intensity
+			}
+		}
+		for category, intensity := range strongest {
+			categories.add(category, intensity)
+		}
+	}
+	finish()
+
+	if periods == nil {
+		return []FlavourPeriod{}
+	}
+	return periods
+}
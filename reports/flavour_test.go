@@ -0,0 +1,46 @@
+package reports
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlavourProfile(t *testing.T) {
+	terms := map[string]Term{
+		"fruity":  {Name: "Fruity", Category: "fruity"},
+		"dried":   {Name: "Dried Fruit", Category: "fruity"},
+		"citrus":  {Name: "Citrus", Category: "fruity"},
+		"woody":   {Name: "Woody", Category: "woody"},
+		"vanilla": {Name: "Vanilla", Category: "woody"},
+	}
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tastings := []Tasting{
+		{Date: march.AddDate(0, 1, 2), Tags: []Tag{{"vanilla", 4}, {"dried", 3}}},
+		{Date: march, Tags: []Tag{{"citrus", 4}, {"dried", 2}}},
+		{Date: march.AddDate(0, 0, 10), Tags: []Tag{{"citrus", 2}, {"vanilla", 1}, {"removed", 5}}},
+	}
+
+	periods := FlavourProfile(tastings, terms, ByMonth)
+	if len(periods) != 2 || periods[0].Period != "2024-03" || periods[0].Tastings != 2 || periods[1].Period != "2024-04" {
+		t.Fatalf("Periods: %+v", periods)
+	}
+
+	march24 := make(map[string]Intensity)
+	for _, intensity := range periods[0].Descriptors {
+		march24[intensity.Id] = intensity
+	}
+	if len(march24) != 3 || !near(march24["citrus"].Intensity, 3) || march24["citrus"].Count != 2 || !near(march24["dried"].Intensity, 1) || !near(march24["vanilla"].Intensity, 0.5) {
+		t.Errorf("March descriptors: %+v", periods[0].Descriptors)
+	}
+	categories := periods[0].Categories
+	if len(categories) != 2 || categories[0].Id != "fruity" || !near(categories[0].Intensity, 3) || !near(categories[1].Intensity, 0.5) {
+		t.Errorf("March categories: %+v", categories)
+	}
+
+	if each := FlavourProfile(tastings, terms, EachTasting); len(each) != 3 || !each[0].Start.Equal(march) {
+		t.Errorf("Each tasting: %+v", each)
+	}
+	if none := FlavourProfile(nil, terms, ByYear); none == nil || len(none) != 0 {
+		t.Errorf("No tastings: %+v", none)
+	}
+}
@@ -0,0 +1,165 @@
+package reports
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const daysPerYear = 365.25
+
+// Event is either a movement of spirit into (positive Volume) or out of
+// (negative Volume) a vessel, or a reading of what the vessel holds. ABV is
+// the strength of the spirit moved or read; zero means not known.
+type Event struct {
+	Date       time.Time
+	Reading    bool
+	Volume     float64
+	ReadVolume float64
+	ABV        float64
+}
+
+type Point struct {
+	Date        time.Time `json:"date"`
+	Volume      float64   `json:"volume"`
+	ABV         float64   `json:"abv"`
+	VolumeLoss  float64   `json:"volumeLoss"`
+	AlcoholLoss float64   `json:"alcoholLoss"`
+}
+
+// Loss compares what went into a vessel, less what was taken out, with what
+// readings say is left. Alcohol is in litres of absolute alcohol when volume
+// is in litres. The annual rates are compound rates over the whole period.
+type Loss struct {
+	Start                    time.Time `json:"start"`
+	End                      time.Time `json:"end"`
+	Years                    float64   `json:"years"`
+	VolumeIn                 float64   `json:"volumeIn"`
+	Volume                   float64   `json:"volume"`
+	VolumeLoss               float64   `json:"volumeLoss"`
+	VolumeLossPercent        float64   `json:"volumeLossPercent"`
+	AnnualVolumeLossPercent  float64   `json:"annualVolumeLossPercent"`
+	AlcoholIn                float64   `json:"alcoholIn"`
+	Alcohol                  float64   `json:"alcohol"`
+	AlcoholLoss              float64   `json:"alcoholLoss"`
+	AlcoholLossPercent       float64   `json:"alcoholLossPercent"`
+	AnnualAlcoholLossPercent float64   `json:"annualAlcoholLossPercent"`
+	Points                   []Point   `json:"points,omitempty"`
+}
+
+// Compute replays events in date order. Between readings the vessel is
+// assumed to have lost nothing further, so the loss is the cumulative loss
+// at the last reading. A movement out is recorded at what the ledger says
+// the vessel holds, so one that takes at least what readings say is left
+// empties the vessel: the loss stays the ledger less the last reading and
+// nothing is left.
+func Compute(events []Event, startABV float64) Loss {
+	sorted := append([]Event{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.Before(sorted[j].Date)
+		}
+		return !sorted[i].Reading && sorted[j].Reading
+	})
+
+	var loss Loss
+	var expected, expectedAlcohol float64
+	abv := startABV
+	for i, event := range sorted {
+		if i == 0 {
+			loss.Start = event.Date
+		}
+		loss.End = event.Date
+
+		if !event.Reading {
+			strength := abv
+			if event.ABV > 0 {
+				strength = event.ABV
+			}
+			if abv == 0 {
+				abv = strength
+			}
+			if event.Volume < 0 && -event.Volume >= expected-loss.VolumeLoss {
+				expected = loss.VolumeLoss
+				expectedAlcohol = loss.AlcoholLoss
+				continue
+			}
+			expected += event.Volume
+			expectedAlcohol += event.Volume * strength / 100
+			if event.Volume > 0 {
+				loss.VolumeIn += event.Volume
+				loss.AlcoholIn += event.Volume * strength / 100
+			}
+			continue
+		}
+
+		if event.ABV > 0 {
+			abv = event.ABV
+		}
+		if event.ReadVolume > 0 {
+			loss.VolumeLoss = expected - event.ReadVolume
+		}
+		volume := expected - loss.VolumeLoss
+		loss.AlcoholLoss = expectedAlcohol - volume*abv/100
+		loss.Points = append(loss.Points, Point{
+			Date:        event.Date,
+			Volume:      volume,
+			ABV:         abv,
+			VolumeLoss:  loss.VolumeLoss,
+			AlcoholLoss: loss.AlcoholLoss,
+		})
+	}
+
+	loss.Volume = expected - loss.VolumeLoss
+	loss.Alcohol = expectedAlcohol - loss.AlcoholLoss
+	loss.finish()
+	return loss
+}
+
+// Combine adds up the losses of several vessels, for example every vessel
+// a batch has been in. Points are not carried over.
+func Combine(losses ...Loss) Loss {
+	var total Loss
+	for _, loss := range losses {
+		if loss.VolumeIn == 0 {
+			continue
+		}
+		if total.Start.IsZero() || loss.Start.Before(total.Start) {
+			total.Start = loss.Start
+		}
+		if loss.End.After(total.End) {
+			total.End = loss.End
+		}
+		total.VolumeIn += loss.VolumeIn
+		total.Volume += loss.Volume
+		total.VolumeLoss += loss.VolumeLoss
+		total.AlcoholIn += loss.AlcoholIn
+		total.Alcohol += loss.Alcohol
+		total.AlcoholLoss += loss.AlcoholLoss
+	}
+	total.finish()
+	return total
+}
+
+func (l *Loss) finish() {
+	l.Years = l.End.Sub(l.Start).Hours() / 24 / daysPerYear
+	l.VolumeLossPercent = percent(l.VolumeLoss, l.VolumeIn)
+	l.AlcoholLossPercent = percent(l.AlcoholLoss, l.AlcoholIn)
+	l.AnnualVolumeLossPercent = annualised(l.VolumeLoss, l.VolumeIn, l.Years)
+	l.AnnualAlcoholLossPercent = annualised(l.AlcoholLoss, l.AlcoholIn, l.Years)
+}
+
+func percent(part float64, whole float64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return part / whole * 100
+}
+
+func annualised(lost float64, total float64, years float64) float64 {
+	if total <= 0 || years <= 0 || lost >= total {
+		return 0
+	}
+	retained := 1 - lost/total
+	return (1 - math.Pow(retained, 1/years)) * 100
+}
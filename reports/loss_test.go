@@ -0,0 +1,74 @@
+package reports
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+func TestComputeLoss(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Date: start, Volume: 200, ABV: 62.5},
+		{Date: start.AddDate(1, 0, 0), Reading: true, ReadVolume: 190, ABV: 61},
+		{Date: start.AddDate(2, 0, 0), Reading: true, ReadVolume: 180.5, ABV: 60},
+	}
+
+	loss := Compute(events, 0)
+	if !near(loss.VolumeLoss, 19.5) || !near(loss.Volume, 180.5) {
+		t.Errorf("Volume: loss: %v, volume: %v", loss.VolumeLoss, loss.Volume)
+	}
+	if !near(loss.AlcoholIn, 125) || !near(loss.AlcoholLoss, 125-108.3) {
+		t.Errorf("Alcohol: in: %v, loss: %v", loss.AlcoholIn, loss.AlcoholLoss)
+	}
+	if !near(loss.Years, 731/daysPerYear) {
+		t.Errorf("Years: %v", loss.Years)
+	}
+	// 200 -> 180.5 over two years is about 5% a year.
+	if loss.AnnualVolumeLossPercent < 4.9 || loss.AnnualVolumeLossPercent > 5.1 {
+		t.Errorf("Annual volume loss: %v", loss.AnnualVolumeLossPercent)
+	}
+	if len(loss.Points) != 2 {
+		t.Errorf("Points: %+v", loss.Points)
+	}
+}
+
+func TestComputeLossAfterTransferOut(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Date: start, Volume: 200, ABV: 60},
+		{Date: start.AddDate(0, 6, 0), Reading: true, ReadVolume: 196},
+		{Date: start.AddDate(1, 0, 0), Volume: -100},
+	}
+
+	loss := Compute(events, 0)
+	if !near(loss.VolumeLoss, 4) || !near(loss.Volume, 96) {
+		t.Errorf("Volume: loss: %v, volume: %v", loss.VolumeLoss, loss.Volume)
+	}
+}
+
+func TestComputeLossAfterDump(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Date: start, Volume: 200, ABV: 60},
+		{Date: start.AddDate(1, 0, 0), Reading: true, ReadVolume: 190, ABV: 59},
+		{Date: start.AddDate(2, 0, 0), Volume: -200},
+	}
+
+	loss := Compute(events, 0)
+	if !near(loss.VolumeLoss, 10) || !near(loss.Volume, 0) {
+		t.Errorf("Volume: loss: %v, volume: %v", loss.VolumeLoss, loss.Volume)
+	}
+	if !near(loss.AlcoholLoss, 120-190*0.59) || !near(loss.Alcohol, 0) {
+		t.Errorf("Alcohol: loss: %v, alcohol: %v", loss.AlcoholLoss, loss.Alcohol)
+	}
+
+	refilled := Compute(append(events, Event{Date: start.AddDate(2, 1, 0), Volume: 100, ABV: 60}), 0)
+	if !near(refilled.VolumeLoss, 10) || !near(refilled.Volume, 100) {
+		t.Errorf("Refilled: loss: %v, volume: %v", refilled.VolumeLoss, refilled.Volume)
+	}
+}
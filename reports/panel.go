@@ -0,0 +1,145 @@
+package reports
+
+import (
+	"math"
+	"sort"
+)
+
+// OutlierDeviation is the least a score must stray from the rest of the
+// panel's, in points, to be flagged, so that a panel in close agreement
+// does not have every small difference called out.
+const OutlierDeviation = 5
+
+// Rating is one panellist's score of a sample.
+type Rating struct {
+	Taster string
+	Score  float64
+}
+
+// RatedScore is a rating as it stands against the rest of the panel.
+type RatedScore struct {
+	Taster  string  `json:"tasterId"`
+	Score   float64 `json:"score"`
+	Outlier bool    `json:"outlier"`
+}
+
+// SampleScores sums up a panel's scores of one sample. Consensus is the
+// mean leaving out the outliers; Mean and Variance are over every score.
+type SampleScores struct {
+	Scores    []RatedScore `json:"scores"`
+	Consensus float64      `json:"consensus"`
+	Mean      float64      `json:"mean"`
+	Variance  float64      `json:"variance"`
+	StdDev    float64      `json:"stdDev"`
+}
+
+// Panellist is how one taster scored compared with the consensus: Bias is
+// the mean of their scores less it, so a harsh taster's is negative.
+type Panellist struct {
+	Taster   string  `json:"tasterId"`
+	Scored   int     `json:"scored"`
+	Bias     float64 `json:"bias"`
+	Outliers int     `json:"outliers"`
+}
+
+// Panel is a whole session's scores: each sample's and each panellist's,
+// and the inter-rater variance, the mean variance of a sample's scores.
+type Panel struct {
+	Samples    []SampleScores `json:"samples"`
+	Panellists []Panellist    `json:"panellists"`
+	Variance   float64        `json:"variance"`
+}
+
+func meanAndVariance(scores []float64) (float64, float64) {
+	if len(scores) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, score := range scores {
+		sum += score
+	}
+	mean := sum / float64(len(scores))
+	if len(scores) == 1 {
+		return mean, 0
+	}
+	var squares float64
+	for _, score := range scores {
+		squares += (score - mean) * (score - mean)
+	}
+	return mean, squares / float64(len(scores)-1)
+}
+
+// ScoreSample finds the consensus on a sample. A score is an outlier when
+// it lies more than two standard deviations from the mean of the others'
+// scores, and at least OutlierDeviation points from it; it takes three
+// scores to tell.
+func ScoreSample(ratings []Rating) SampleScores {
+	scores := make([]float64, len(ratings))
+	for i, rating := range ratings {
+		scores[i] = rating.Score
+	}
+	result := SampleScores{Scores: make([]RatedScore, len(ratings))}
+	result.Mean, result.Variance = meanAndVariance(scores)
+	result.StdDev = math.Sqrt(result.Variance)
+
+	var agreed []float64
+	for i, rating := range ratings {
+		result.Scores[i] = RatedScore{Taster: rating.Taster, Score: rating.Score}
+		if len(ratings) >= 3 {
+			others := append(append([]float64{}, scores[:i]...), scores[i+1:]...)
+			mean, variance := meanAndVariance(others)
+			deviation := math.Abs(rating.Score - mean)
+			result.Scores[i].Outlier = deviation > 2*math.Sqrt(variance) && deviation >= OutlierDeviation
+		}
+		if !result.Scores[i].Outlier {
+			agreed = append(agreed, rating.Score)
+		}
+	}
+	result.Consensus, _ = meanAndVariance(agreed)
+
+	result.Consensus = round(result.Consensus)
+	result.Mean = round(result.Mean)
+	result.Variance = round(result.Variance)
+	result.StdDev = round(result.StdDev)
+	return result
+}
+
+// ScorePanel scores each sample, given as the ratings of it, and measures
+// every panellist against the consensus.
+func ScorePanel(samples [][]Rating) Panel {
+	panel := Panel{Samples: make([]SampleScores, len(samples)), Panellists: []Panellist{}}
+	bias := make(map[string]float64)
+	panellists := make(map[string]*Panellist)
+	var variance float64
+	var scored int
+	for i, ratings := range samples {
+		result := ScoreSample(ratings)
+		panel.Samples[i] = result
+		if len(ratings) > 0 {
+			variance += result.Variance
+			scored++
+		}
+		for _, score := range result.Scores {
+			p, ok := panellists[score.Taster]
+			if !ok {
+				p = &Panellist{Taster: score.Taster}
+				panellists[score.Taster] = p
+			}
+			p.Scored++
+			bias[score.Taster] += score.Score - result.Consensus
+			if score.Outlier {
+				p.Outliers++
+			}
+		}
+	}
+	if scored > 0 {
+		panel.Variance = round(variance / float64(scored))
+	}
+
+	for taster, p := range panellists {
+		p.Bias = round(bias[taster] / float64(p.Scored))
+		panel.Panellists = append(panel.Panellists, *p)
+	}
+	sort.Slice(panel.Panellists, func(i, j int) bool { return panel.Panellists[i].Taster < panel.Panellists[j].Taster })
+	return panel
+}
@@ -0,0 +1,47 @@
+package reports
+
+import "testing"
+
+func TestScoreSample(t *testing.T) {
+	result := ScoreSample([]Rating{{"ann", 85}, {"bob", 86}, {"cat", 84}, {"dan", 60}})
+	outliers := 0
+	for _, score := range result.Scores {
+		if score.Outlier {
+			outliers++
+			if score.Taster != "dan" {
+				t.Errorf("Outlier: got: %v", score.Taster)
+			}
+		}
+	}
+	if outliers != 1 || !near(result.Consensus, 85) || !near(result.Mean, 78.75) || !near(result.Variance, 156.92) {
+		t.Errorf("Sample: %+v", result)
+	}
+
+	agreed := ScoreSample([]Rating{{"ann", 85}, {"bob", 85}, {"cat", 82}})
+	for _, score := range agreed.Scores {
+		if score.Outlier {
+			t.Errorf("Within %v points flagged: %+v", OutlierDeviation, score)
+		}
+	}
+	if pair := ScoreSample([]Rating{{"ann", 90}, {"bob", 50}}); pair.Scores[0].Outlier || pair.Scores[1].Outlier || !near(pair.Consensus, 70) {
+		t.Errorf("Two scores: %+v", pair)
+	}
+}
+
+func TestScorePanel(t *testing.T) {
+	panel := ScorePanel([][]Rating{
+		{{"ann", 80}, {"bob", 84}, {"cat", 82}},
+		{{"ann", 70}, {"bob", 74}},
+		{},
+	})
+	if len(panel.Samples) != 3 || !near(panel.Variance, 6) {
+		t.Errorf("Panel variance: %+v", panel)
+	}
+	if len(panel.Panellists) != 3 {
+		t.Fatalf("Panellists: %+v", panel.Panellists)
+	}
+	ann, cat := panel.Panellists[0], panel.Panellists[2]
+	if ann.Taster != "ann" || ann.Scored != 2 || !near(ann.Bias, -2) || cat.Scored != 1 || !near(cat.Bias, 0) {
+		t.Errorf("Panellists: %+v", panel.Panellists)
+	}
+}
@@ -0,0 +1,70 @@
+// Package retention purges deleted spirits, batches, vessels and
+// measurements once they have been kept long enough to be restored, and
+// failed-login records once they no longer count for anything.
+package retention
+
+import (
+	"aging-api/auth"
+	"aging-api/store"
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purge removes whatever was deleted more than keep ago.
+func Purge(ctx context.Context, s *store.Store, keep time.Duration) (int, error) {
+	return s.PurgeDeleted(ctx, primitive.NewDateTimeFromTime(time.Now().Add(-keep)))
+}
+
+// PruneLockouts removes the failed-login records auth.Forgotten says are
+// no longer needed, so that guesses at made-up emails do not pile up.
+func PruneLockouts(ctx context.Context, s *store.Store, now time.Time) (int, error) {
+	lockouts, err := s.Lockouts.FindAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for _, lockout := range lockouts {
+		if !auth.Forgotten(lockout, now) {
+			continue
+		}
+		if err := s.Lockouts.Delete(ctx, lockout.Id); err != nil && err != store.ErrNotFound {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// Run prunes lockouts and, unless keep is 0, purges deleted records, at
+// once and then every interval until ctx is done. Failures are logged and
+// tried again next time.
+func Run(ctx context.Context, s *store.Store, keep time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if keep > 0 {
+			n, err := Purge(runCtx, s, keep)
+			if err != nil {
+				log.Printf("retention: purge failed: %v", err)
+			} else if n > 0 {
+				log.Printf("retention: purged %d deleted records", n)
+			}
+		}
+		if n, err := PruneLockouts(runCtx, s, time.Now()); err != nil {
+			log.Printf("retention: pruning lockouts failed: %v", err)
+		} else if n > 0 {
+			log.Printf("retention: pruned %d lockouts", n)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"aging-api/auth"
+	"aging-api/controllers"
+	"aging-api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AuditRoute(router *gin.Engine, s *store.Store) {
+	read := router.Group("/api/v1/audit", auth.Authenticate(s), auth.Require(auth.ReadAudit), auth.RequireOrganisation(s))
+	read.GET("", controllers.GetAuditLog(s))
+}
@@ -1,11 +1,20 @@
 package routes
 
 import (
+	"aging-api/auth"
 	"aging-api/controllers"
+	"aging-api/mail"
+	"aging-api/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthRoute(router *gin.Engine) {
-	router.POST("/api/v1/login", controllers.Login())
+func AuthRoute(router *gin.Engine, s *store.Store, sender mail.Sender) {
+	router.POST("/api/v1/login", controllers.Login(s))
+	router.POST("/api/v1/token/refresh", controllers.RefreshToken(s))
+	router.POST("/api/v1/logout", auth.Authenticate(s), controllers.Logout(s))
+	router.POST("/api/v1/email/verify", controllers.VerifyEmail(s))
+	router.POST("/api/v1/email/verify/resend", controllers.ResendVerification(s, sender))
+	router.POST("/api/v1/password/forgot", controllers.ForgotPassword(s, sender))
+	router.POST("/api/v1/password/reset", controllers.ResetPassword(s))
 }
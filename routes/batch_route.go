@@ -1,14 +1,29 @@
 package routes
 
 import (
+	"aging-api/auth"
 	"aging-api/controllers"
+	"aging-api/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func BatchRoute(router *gin.Engine) {
-	router.GET("/api/v1/batches", controllers.GetBatch())
-	router.POST("/api/v1/batches", controllers.CreateBatch())
-	router.PUT("/api/v1/batches/:id", controllers.UpdateBatch())
-	router.DELETE("/api/v1/batches/:id", controllers.DeleteBatch())
+func BatchRoute(router *gin.Engine, s *store.Store) {
+	read := router.Group("/api/v1/batches", auth.Authenticate(s), auth.Require(auth.ReadBatches), auth.RequireOrganisation(s))
+	read.GET("", controllers.ListBatches(s))
+	read.GET("/:id", controllers.GetBatch(s))
+	read.GET("/:id/timeline", controllers.GetBatchTimeline(s))
+	read.GET("/:id/loss", controllers.GetBatchLoss(s))
+	read.GET("/:id/flavour", controllers.GetBatchFlavour(s))
+	read.GET("/:id/tastings", controllers.GetBatchTastings(s))
+	read.GET("/:id/history", controllers.GetBatchHistory(s))
+
+	write := router.Group("/api/v1/batches", auth.Authenticate(s), auth.Require(auth.WriteBatches), auth.RequireOrganisation(s))
+	write.POST("", controllers.CreateBatch(s))
+	write.PUT("/:id", controllers.UpdateBatch(s))
+	write.DELETE("/:id", controllers.DeleteBatch(s))
+	write.POST("/:id/restore", controllers.RestoreBatch(s))
+	write.POST("/:id/fill", controllers.FillBatch(s))
+	write.POST("/:id/transfer", controllers.TransferBatch(s))
+	write.POST("/:id/dump", controllers.DumpBatch(s))
 }
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"aging-api/auth"
+	"aging-api/controllers"
+	"aging-api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func DescriptorRoute(router *gin.Engine, s *store.Store) {
+	read := router.Group("/api/v1/descriptors", auth.Authenticate(s), auth.Require(auth.ReadMeasurements), auth.RequireOrganisation(s))
+	read.GET("", controllers.GetDescriptors(s))
+	read.GET("/:id", controllers.GetDescriptor(s))
+
+	write := router.Group("/api/v1/descriptors", auth.Authenticate(s), auth.Require(auth.ManageDescriptors), auth.RequireOrganisation(s))
+	write.POST("", controllers.CreateDescriptor(s))
+	write.POST("/wheel", controllers.LoadFlavourWheel(s))
+	write.PUT("/:id", controllers.UpdateDescriptor(s))
+	write.DELETE("/:id", controllers.DeleteDescriptor(s))
+}
@@ -1,14 +1,21 @@
 package routes
 
 import (
+	"aging-api/auth"
 	"aging-api/controllers"
+	"aging-api/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func MeasurementRoute(router *gin.Engine) {
-	router.GET("/api/v1/measurements", controllers.GetMeasurement())
-	router.POST("/api/v1/measurements", controllers.CreateMeasurement())
-	router.PUT("/api/v1/measurements/:id", controllers.UpdateMeasurement())
-	router.DELETE("/api/v1/measurements/:id", controllers.DeleteMeasurement())
+func MeasurementRoute(router *gin.Engine, s *store.Store) {
+	read := router.Group("/api/v1/measurements", auth.Authenticate(s), auth.Require(auth.ReadMeasurements), auth.RequireOrganisation(s))
+	read.GET("", controllers.ListMeasurements(s))
+	read.GET("/:id", controllers.GetMeasurement(s))
+
+	write := router.Group("/api/v1/measurements", auth.Authenticate(s), auth.Require(auth.WriteMeasurements), auth.RequireOrganisation(s))
+	write.POST("", controllers.CreateMeasurement(s))
+	write.PUT("/:id", controllers.UpdateMeasurement(s))
+	write.DELETE("/:id", controllers.DeleteMeasurement(s))
+	write.POST("/:id/restore", controllers.RestoreMeasurement(s))
 }
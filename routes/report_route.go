@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"aging-api/auth"
+	"aging-api/controllers"
+	"aging-api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReportRoute(router *gin.Engine, s *store.Store) {
+	read := router.Group("/api/v1/reports", auth.Authenticate(s), auth.Require(auth.ReadReports), auth.RequireOrganisation(s))
+	read.GET("/loss", controllers.GetLossReport(s))
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"aging-api/auth"
+	"aging-api/controllers"
+	"aging-api/search"
+	"aging-api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SearchRoute(router *gin.Engine, s *store.Store, indexer *search.Indexer) {
+	read := router.Group("/api/v1/search", auth.Authenticate(s), auth.Require(auth.ReadMeasurements), auth.RequireOrganisation(s))
+	read.GET("", controllers.Search(indexer))
+}
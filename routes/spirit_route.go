@@ -1,15 +1,22 @@
 package routes
 
 import (
+	"aging-api/auth"
 	"aging-api/controllers"
+	"aging-api/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SpiritRoute(router *gin.Engine) {
-	router.GET("/api/v1/spirits", controllers.GetAllSpirits())
-	router.GET("/api/v1/spirits/:id", controllers.GetSpiritById())
-	router.POST("/api/v1/spirits", controllers.CreateSpirit())
-	router.PUT("/api/v1/spirits/:id", controllers.UpdateSpirit())
-	router.DELETE("/api/v1/spirits/:id", controllers.DeleteSpirit())
+func SpiritRoute(router *gin.Engine, s *store.Store) {
+	read := router.Group("/api/v1/spirits", auth.Authenticate(s), auth.Require(auth.ReadSpirits), auth.RequireOrganisation(s))
+	read.GET("", controllers.GetAllSpirits(s))
+	read.GET("/:id", controllers.GetSpiritById(s))
+	read.GET("/:id/history", controllers.GetSpiritHistory(s))
+
+	write := router.Group("/api/v1/spirits", auth.Authenticate(s), auth.Require(auth.WriteSpirits), auth.RequireOrganisation(s))
+	write.POST("", controllers.CreateSpirit(s))
+	write.PUT("/:id", controllers.UpdateSpirit(s))
+	write.DELETE("/:id", controllers.DeleteSpirit(s))
+	write.POST("/:id/restore", controllers.RestoreSpirit(s))
 }
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"aging-api/auth"
+	"aging-api/controllers"
+	"aging-api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TastingRoute(router *gin.Engine, s *store.Store) {
+	read := router.Group("/api/v1/tastings", auth.Authenticate(s), auth.Require(auth.ReadMeasurements), auth.RequireOrganisation(s))
+	read.GET("", controllers.GetTastings(s))
+	read.GET("/:id", controllers.GetTasting(s))
+	read.GET("/:id/results", controllers.GetTastingResults(s))
+
+	score := router.Group("/api/v1/tastings", auth.Authenticate(s), auth.Require(auth.WriteMeasurements), auth.RequireOrganisation(s))
+	score.POST("/:id/scores", controllers.ScoreTasting(s))
+
+	write := router.Group("/api/v1/tastings", auth.Authenticate(s), auth.Require(auth.ManageTastings), auth.RequireOrganisation(s))
+	write.POST("", controllers.CreateTasting(s))
+	write.PUT("/:id", controllers.UpdateTasting(s))
+	write.DELETE("/:id", controllers.DeleteTasting(s))
+	write.POST("/:id/close", controllers.CloseTasting(s))
+	write.POST("/:id/reveal", controllers.RevealTasting(s))
+}
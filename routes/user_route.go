@@ -1,14 +1,40 @@
 package routes
 
 import (
+	"aging-api/auth"
 	"aging-api/controllers"
+	"aging-api/mail"
+	"aging-api/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func UserRoute(router *gin.Engine) {
-	router.GET("/api/v1/users", controllers.GetAllUsers())
-	router.POST("/api/v1/users", controllers.CreateUser())
-	router.PUT("/api/v1/users/:id", controllers.UpdateUser())
-	router.DELETE("/api/v1/users/:id", controllers.DeleteUser())
+func UserRoute(router *gin.Engine, s *store.Store, sender mail.Sender) {
+	router.POST("/api/v1/users", controllers.CreateUser(s, sender))
+	router.GET("/api/v1/me", auth.Authenticate(s), controllers.GetMe())
+
+	keys := router.Group("/api/v1/me/keys", auth.Authenticate(s))
+	keys.GET("", controllers.GetApiKeys(s))
+	keys.POST("", controllers.CreateApiKey(s))
+	keys.DELETE("/:id", controllers.RevokeApiKey(s))
+
+	admin := router.Group("/api/v1/users", auth.Authenticate(s), auth.Require(auth.ManageUsers))
+	admin.GET("", controllers.GetAllUsers(s))
+	admin.PUT("/:id", controllers.UpdateUser(s))
+	admin.DELETE("/:id", controllers.DeleteUser(s))
+	admin.PUT("/:id/role", controllers.SetUserRole(s))
+	admin.DELETE("/:id/sessions", controllers.RevokeUserSessions(s))
+
+	organisations := router.Group("/api/v1/organisations", auth.Authenticate(s))
+	organisations.GET("", controllers.GetOrganisations(s))
+
+	manage := router.Group("/api/v1/organisations", auth.Authenticate(s), auth.Require(auth.ManageUsers))
+	manage.POST("", controllers.CreateOrganisation(s))
+	manage.GET("/:id/members", controllers.GetMembers(s))
+	manage.POST("/:id/members", controllers.AddMember(s))
+	manage.DELETE("/:id/members/:userId", controllers.RemoveMember(s))
+
+	lockouts := router.Group("/api/v1/lockouts", auth.Authenticate(s), auth.Require(auth.ManageUsers))
+	lockouts.GET("", controllers.GetLockouts(s))
+	lockouts.DELETE("/:id", controllers.ClearLockout(s))
 }
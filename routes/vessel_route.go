@@ -1,14 +1,26 @@
 package routes
 
 import (
+	"aging-api/auth"
 	"aging-api/controllers"
+	"aging-api/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func VesselRoute(router *gin.Engine) {
-	router.GET("/api/v1/vessels", controllers.GetVessel())
-	router.POST("/api/v1/vessels", controllers.CreateVessel())
-	router.PUT("/api/v1/vessels/:id", controllers.UpdateVessel())
-	router.DELETE("/api/v1/vessels/:id", controllers.DeleteVessel())
+func VesselRoute(router *gin.Engine, s *store.Store) {
+	read := router.Group("/api/v1/vessels", auth.Authenticate(s), auth.Require(auth.ReadVessels), auth.RequireOrganisation(s))
+	read.GET("", controllers.ListVessels(s))
+	read.GET("/:id", controllers.GetVessel(s))
+	read.GET("/:id/timeline", controllers.GetVesselTimeline(s))
+	read.GET("/:id/loss", controllers.GetVesselLoss(s))
+	read.GET("/:id/history", controllers.GetVesselHistory(s))
+
+	write := router.Group("/api/v1/vessels", auth.Authenticate(s), auth.Require(auth.WriteVessels), auth.RequireOrganisation(s))
+	write.POST("", controllers.CreateVessel(s))
+	write.PUT("/:id", controllers.UpdateVessel(s))
+	write.DELETE("/:id", controllers.DeleteVessel(s))
+	write.POST("/:id/restore", controllers.RestoreVessel(s))
+	write.POST("/:id/status", controllers.SetVesselStatus(s))
+	write.POST("/:id/treatments", controllers.AddVesselTreatment(s))
 }
@@ -0,0 +1,237 @@
+// Package search finds measurements by what their tasting notes say, and
+// by the names and recipes of the spirits they were taken from.
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Spirit is a spirit a measured batch went into.
+type Spirit struct {
+	Id   primitive.ObjectID `json:"id"`
+	Name string             `json:"name"`
+}
+
+// Document is what is indexed of one measurement: the text to search and
+// what results are faceted by.
+type Document struct {
+	Id             primitive.ObjectID  `json:"id"`
+	OrganisationId primitive.ObjectID  `json:"-"`
+	BatchId        *primitive.ObjectID `json:"batchId,omitempty"`
+	VesselId       *primitive.ObjectID `json:"vesselId,omitempty"`
+	Date           time.Time           `json:"date"`
+	Spirits        []Spirit            `json:"spirits"`
+	Material       string              `json:"material,omitempty"`
+	Fields         map[string]string   `json:"fields"`
+}
+
+// Hit is a document that matched, scored by how often its terms occur.
+type Hit struct {
+	Document
+	Score int `json:"score"`
+}
+
+// Index stores documents and finds those matching a query. The embedded
+// default is MemoryIndex; others can be plugged in through NewIndexer.
+type Index interface {
+	Put(ctx context.Context, document Document) error
+	Remove(ctx context.Context, organisationId primitive.ObjectID, id primitive.ObjectID) error
+	// Clear drops every document of an organisation before a rebuild.
+	Clear(ctx context.Context, organisationId primitive.ObjectID) error
+	// Search returns every document of the organisation that matches,
+	// best first.
+	Search(ctx context.Context, organisationId primitive.ObjectID, query Query) ([]Hit, error)
+}
+
+// occurrence is where a term appears in a document.
+type occurrence struct {
+	field    string
+	position int
+}
+
+// memoryOrganisation is the inverted index of one organisation's
+// documents: each term maps to the documents and positions it occurs at.
+type memoryOrganisation struct {
+	documents map[primitive.ObjectID]Document
+	postings  map[string]map[primitive.ObjectID][]occurrence
+}
+
+// MemoryIndex keeps a positional inverted index in memory. It is rebuilt
+// from the store after a restart.
+type MemoryIndex struct {
+	mu            sync.RWMutex
+	organisations map[primitive.ObjectID]*memoryOrganisation
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{organisations: make(map[primitive.ObjectID]*memoryOrganisation)}
+}
+
+func (x *MemoryIndex) organisation(id primitive.ObjectID) *memoryOrganisation {
+	o, ok := x.organisations[id]
+	if !ok {
+		o = &memoryOrganisation{
+			documents: make(map[primitive.ObjectID]Document),
+			postings:  make(map[string]map[primitive.ObjectID][]occurrence),
+		}
+		x.organisations[id] = o
+	}
+	return o
+}
+
+func (o *memoryOrganisation) remove(id primitive.ObjectID) {
+	document, ok := o.documents[id]
+	if !ok {
+		return
+	}
+	for _, text := range document.Fields {
+		for _, term := range tokens(text) {
+			delete(o.postings[term], id)
+			if len(o.postings[term]) == 0 {
+				delete(o.postings, term)
+			}
+		}
+	}
+	delete(o.documents, id)
+}
+
+func (x *MemoryIndex) Put(ctx context.Context, document Document) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	o := x.organisation(document.OrganisationId)
+	o.remove(document.Id)
+	o.documents[document.Id] = document
+	for field, text := range document.Fields {
+		for position, term := range tokens(text) {
+			if o.postings[term] == nil {
+				o.postings[term] = make(map[primitive.ObjectID][]occurrence)
+			}
+			o.postings[term][document.Id] = append(o.postings[term][document.Id], occurrence{field, position})
+		}
+	}
+	return nil
+}
+
+func (x *MemoryIndex) Remove(ctx context.Context, organisationId primitive.ObjectID, id primitive.ObjectID) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.organisation(organisationId).remove(id)
+	return nil
+}
+
+func (x *MemoryIndex) Clear(ctx context.Context, organisationId primitive.ObjectID) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.organisations, organisationId)
+	return nil
+}
+
+// matches finds the occurrences of term, or of every term starting with it
+// for a prefix, in one field or any.
+func (o *memoryOrganisation) matches(term string, prefix bool, field string) map[primitive.ObjectID][]occurrence {
+	found := make(map[primitive.ObjectID][]occurrence)
+	add := func(postings map[primitive.ObjectID][]occurrence) {
+		for id, occurrences := range postings {
+			for _, at := range occurrences {
+				if field == "" || at.field == field {
+					found[id] = append(found[id], at)
+				}
+			}
+		}
+	}
+	if !prefix {
+		add(o.postings[term])
+		return found
+	}
+	for candidate, postings := range o.postings {
+		if strings.HasPrefix(candidate, term) {
+			add(postings)
+		}
+	}
+	return found
+}
+
+// clause scores each document matching c by the number of times it does.
+func (o *memoryOrganisation) clause(c Clause) map[primitive.ObjectID]int {
+	last := len(c.Terms) - 1
+	first := o.matches(c.Terms[0], c.Prefix && last == 0, c.Field)
+	scores := make(map[primitive.ObjectID]int)
+	if last == 0 {
+		for id, occurrences := range first {
+			scores[id] = len(occurrences)
+		}
+		return scores
+	}
+
+	// A phrase matches where each following term comes right after the
+	// one before it in the same field.
+	following := make([]map[primitive.ObjectID][]occurrence, len(c.Terms))
+	for i := 1; i <= last; i++ {
+		following[i] = o.matches(c.Terms[i], c.Prefix && i == last, c.Field)
+	}
+	for id, starts := range first {
+		for _, start := range starts {
+			if phraseAt(following, id, start) {
+				scores[id]++
+			}
+		}
+	}
+	return scores
+}
+
+func phraseAt(following []map[primitive.ObjectID][]occurrence, id primitive.ObjectID, start occurrence) bool {
+	for i := 1; i < len(following); i++ {
+		found := false
+		for _, at := range following[i][id] {
+			if at.field == start.field && at.position == start.position+i {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (x *MemoryIndex) Search(ctx context.Context, organisationId primitive.ObjectID, query Query) ([]Hit, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	o, ok := x.organisations[organisationId]
+	if !ok || len(query) == 0 {
+		return []Hit{}, nil
+	}
+
+	scores := o.clause(query[0])
+	for _, c := range query[1:] {
+		more := o.clause(c)
+		for id, score := range scores {
+			if extra, ok := more[id]; ok {
+				scores[id] = score + extra
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{Document: o.documents[id], Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Date.After(hits[j].Date)
+	})
+	return hits, nil
+}
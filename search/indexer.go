@@ -0,0 +1,345 @@
+package search
+
+import (
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Interval is the width of the date facet's buckets.
+type Interval string
+
+const (
+	Month Interval = "month"
+	Year  Interval = "year"
+)
+
+// Request is a search with the facets it is narrowed to. Zero values leave
+// a facet open.
+type Request struct {
+	Query Query
+	// Spirit is a spirit's id or name.
+	Spirit   string
+	Material string
+	From     time.Time
+	To       time.Time
+	Interval Interval
+	Limit    int
+}
+
+// Bucket is one value of a facet and how many hits have it.
+type Bucket struct {
+	Value string `json:"value"`
+	Id    string `json:"id,omitempty"`
+	Count int    `json:"count"`
+}
+
+type Facets struct {
+	Spirits   []Bucket `json:"spirits"`
+	Materials []Bucket `json:"materials"`
+	Dates     []Bucket `json:"dates"`
+}
+
+// Results are the best hits up to the limit, with the total and facets
+// counted over every hit.
+type Results struct {
+	Hits   []Hit  `json:"hits"`
+	Total  int    `json:"total"`
+	Facets Facets `json:"facets"`
+}
+
+// Indexer keeps an Index in step with the store. An organisation's
+// documents are indexed when it is first searched; after that a change to a
+// measurement reindexes it alone, and a change to a spirit, batch or vessel,
+// which may be named in any number of documents, has the organisation
+// indexed afresh on its next search.
+type Indexer struct {
+	index Index
+	store *store.Store
+
+	mu    sync.Mutex
+	fresh map[primitive.ObjectID]bool
+}
+
+// NewIndexer indexes the measurements in s, which must not be scoped to an
+// organisation.
+func NewIndexer(index Index, s *store.Store) *Indexer {
+	return &Indexer{index: index, store: s, fresh: make(map[primitive.ObjectID]bool)}
+}
+
+// watchedAudit hears of every change to the organisation's records by way
+// of the audit log, which every write through AuditedBy goes to.
+type watchedAudit struct {
+	store.AuditRepository
+	indexer *Indexer
+}
+
+func (w *watchedAudit) Create(ctx context.Context, entry *models.AuditEntry) error {
+	if err := w.AuditRepository.Create(ctx, entry); err != nil {
+		return err
+	}
+	w.indexer.changed(ctx, entry)
+	return nil
+}
+
+// Watch returns a copy of s whose writes keep the index up to date.
+func (x *Indexer) Watch(s *store.Store) *store.Store {
+	watched := *s
+	watched.Audit = &watchedAudit{AuditRepository: s.Audit, indexer: x}
+	return &watched
+}
+
+func (x *Indexer) changed(ctx context.Context, entry *models.AuditEntry) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if !x.fresh[entry.OrganisationId] {
+		return
+	}
+	if entry.Entity != "measurement" || x.reindex(ctx, entry.OrganisationId, entry.EntityId) != nil {
+		x.fresh[entry.OrganisationId] = false
+	}
+}
+
+// relations are what a measurement's document takes from other records.
+type relations struct {
+	batches   map[primitive.ObjectID][]primitive.ObjectID
+	spirits   map[primitive.ObjectID][]models.Spirit
+	materials map[primitive.ObjectID]string
+}
+
+func loadRelations(ctx context.Context, s *store.Store) (relations, error) {
+	r := relations{
+		batches:   make(map[primitive.ObjectID][]primitive.ObjectID),
+		spirits:   make(map[primitive.ObjectID][]models.Spirit),
+		materials: make(map[primitive.ObjectID]string),
+	}
+	spirits, err := s.Spirits.FindAll(ctx)
+	if err != nil {
+		return r, err
+	}
+	for _, spirit := range spirits {
+		for _, batchId := range spirit.BatchIds {
+			r.spirits[batchId] = append(r.spirits[batchId], spirit)
+		}
+	}
+	batches, err := s.Batches.FindAll(ctx)
+	if err != nil {
+		return r, err
+	}
+	for _, batch := range batches {
+		for _, measurementId := range batch.MeasurementIds {
+			r.batches[measurementId] = append(r.batches[measurementId], batch.Id)
+		}
+	}
+	vessels, err := s.Vessels.FindAll(ctx)
+	if err != nil {
+		return r, err
+	}
+	for _, vessel := range vessels {
+		r.materials[vessel.Id] = vessel.Material
+	}
+	return r, nil
+}
+
+// document collects the text of a measurement and of the spirits taken
+// from the batch it measured, found through either side of the link.
+func (r relations) document(measurement models.Measurement) Document {
+	batchIds := r.batches[measurement.Id]
+	if measurement.BatchId != nil {
+		batchIds = append([]primitive.ObjectID{*measurement.BatchId}, batchIds...)
+	}
+
+	seen := make(map[primitive.ObjectID]bool)
+	var spirits []Spirit
+	var names, recipes []string
+	for _, batchId := range batchIds {
+		for _, spirit := range r.spirits[batchId] {
+			if seen[spirit.Id] {
+				continue
+			}
+			seen[spirit.Id] = true
+			spirits = append(spirits, Spirit{Id: spirit.Id, Name: spirit.Name})
+			names = append(names, spirit.Name)
+			recipes = append(recipes, spirit.RecipeName)
+		}
+	}
+
+	date := measurement.Date
+	if date == 0 {
+		date = measurement.CreatedAt
+	}
+	document := Document{
+		Id:             measurement.Id,
+		OrganisationId: measurement.OrganisationId,
+		BatchId:        measurement.BatchId,
+		VesselId:       measurement.VesselId,
+		Date:           date.Time().UTC(),
+		Spirits:        spirits,
+		Fields: map[string]string{
+			FieldNose:       measurement.Nose,
+			FieldForePalate: measurement.ForePalate,
+			FieldMidPalate:  measurement.MidPalate,
+			FieldFinish:     measurement.Finish,
+			FieldNotes:      measurement.Notes,
+			FieldSpirit:     strings.Join(names, "\n"),
+			FieldRecipe:     strings.Join(recipes, "\n"),
+		},
+	}
+	if measurement.VesselId != nil {
+		document.Material = r.materials[*measurement.VesselId]
+	}
+	return document
+}
+
+func (x *Indexer) reindex(ctx context.Context, organisationId primitive.ObjectID, measurementId primitive.ObjectID) error {
+	s := x.store.ForOrganisation(organisationId)
+	measurement, err := s.Measurements.FindById(ctx, measurementId)
+	if err == store.ErrNotFound {
+		return x.index.Remove(ctx, organisationId, measurementId)
+	}
+	if err != nil {
+		return err
+	}
+	r, err := loadRelations(ctx, s)
+	if err != nil {
+		return err
+	}
+	return x.index.Put(ctx, r.document(measurement))
+}
+
+func (x *Indexer) rebuild(ctx context.Context, organisationId primitive.ObjectID) error {
+	s := x.store.ForOrganisation(organisationId)
+	measurements, err := s.Measurements.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := loadRelations(ctx, s)
+	if err != nil {
+		return err
+	}
+	if err := x.index.Clear(ctx, organisationId); err != nil {
+		return err
+	}
+	for _, measurement := range measurements {
+		if err := x.index.Put(ctx, r.document(measurement)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search finds an organisation's measurements, indexing them first if
+// anything has changed that could not be reindexed on its own.
+func (x *Indexer) Search(ctx context.Context, organisationId primitive.ObjectID, request Request) (Results, error) {
+	x.mu.Lock()
+	if !x.fresh[organisationId] {
+		if err := x.rebuild(ctx, organisationId); err != nil {
+			x.mu.Unlock()
+			return Results{}, err
+		}
+		x.fresh[organisationId] = true
+	}
+	x.mu.Unlock()
+
+	hits, err := x.index.Search(ctx, organisationId, request.Query)
+	if err != nil {
+		return Results{}, err
+	}
+
+	results := Results{Hits: make([]Hit, 0)}
+	spirits := make(map[primitive.ObjectID]*Bucket)
+	materials := make(map[string]*Bucket)
+	dates := make(map[string]*Bucket)
+	for _, hit := range hits {
+		if !request.matches(hit.Document) {
+			continue
+		}
+		results.Total++
+		if request.Limit == 0 || len(results.Hits) < request.Limit {
+			results.Hits = append(results.Hits, hit)
+		}
+
+		for _, spirit := range hit.Spirits {
+			count(spirits, spirit.Id, Bucket{Value: spirit.Name, Id: spirit.Id.Hex()})
+		}
+		if hit.Material != "" {
+			count(materials, hit.Material, Bucket{Value: hit.Material})
+		}
+		period := request.Interval.bucket(hit.Date)
+		count(dates, period, Bucket{Value: period})
+	}
+
+	results.Facets = Facets{Spirits: byCount(spirits), Materials: byCount(materials), Dates: byValue(dates)}
+	return results, nil
+}
+
+func (r Request) matches(document Document) bool {
+	if r.Material != "" && !strings.EqualFold(document.Material, r.Material) {
+		return false
+	}
+	if !r.From.IsZero() && document.Date.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && document.Date.After(r.To) {
+		return false
+	}
+	if r.Spirit == "" {
+		return true
+	}
+	for _, spirit := range document.Spirits {
+		if spirit.Id.Hex() == r.Spirit || strings.EqualFold(spirit.Name, r.Spirit) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i Interval) bucket(date time.Time) string {
+	if i == Year {
+		return date.Format("2006")
+	}
+	return date.Format("2006-01")
+}
+
+func count[K comparable](buckets map[K]*Bucket, key K, bucket Bucket) {
+	if existing, ok := buckets[key]; ok {
+		existing.Count++
+		return
+	}
+	bucket.Count = 1
+	buckets[key] = &bucket
+}
+
+func flatten[K comparable](buckets map[K]*Bucket) []Bucket {
+	result := make([]Bucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		result = append(result, *bucket)
+	}
+	return result
+}
+
+// byCount puts the commonest values first.
+func byCount[K comparable](buckets map[K]*Bucket) []Bucket {
+	result := flatten(buckets)
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
+// byValue puts date buckets in order.
+func byValue[K comparable](buckets map[K]*Bucket) []Bucket {
+	result := flatten(buckets)
+	sort.Slice(result, func(i, j int) bool { return result[i].Value < result[j].Value })
+	return result
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The fields of a Document that are searched, and the names a query uses
+// to pick one out, as in nose:banana.
+const (
+	FieldNose       = "nose"
+	FieldForePalate = "forePalate"
+	FieldMidPalate  = "midPalate"
+	FieldFinish     = "finish"
+	FieldNotes      = "notes"
+	FieldSpirit     = "spirit"
+	FieldRecipe     = "recipe"
+)
+
+var fieldNames = map[string]string{
+	"nose":       FieldNose,
+	"forepalate": FieldForePalate,
+	"midpalate":  FieldMidPalate,
+	"finish":     FieldFinish,
+	"notes":      FieldNotes,
+	"spirit":     FieldSpirit,
+	"recipe":     FieldRecipe,
+}
+
+// Clause is one part of a query that a document must match: a single word,
+// a word prefix, or a phrase of words in order. Field empty means any field.
+type Clause struct {
+	Field  string
+	Terms  []string
+	Prefix bool
+}
+
+// Query is a parsed search. Every clause must match.
+type Query []Clause
+
+// tokens splits text into lower-case words.
+func tokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ParseQuery reads a search such as
+//
+//	nose:banana "dried fruit" finish:spic*
+//
+// Quoted words are a phrase, a trailing * makes a word a prefix and
+// field: limits the next word or phrase to one field.
+func ParseQuery(text string) (Query, error) {
+	var query Query
+	rest := strings.TrimSpace(text)
+	for rest != "" {
+		var field string
+		if colon := strings.IndexByte(rest, ':'); colon > 0 && !strings.ContainsAny(rest[:colon], " \t\"") {
+			name, ok := fieldNames[strings.ToLower(rest[:colon])]
+			if !ok {
+				return nil, fmt.Errorf("cannot search field %q", rest[:colon])
+			}
+			field, rest = name, rest[colon+1:]
+		}
+
+		var word string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated phrase in %q", text)
+			}
+			word, rest = rest[1:end+1], rest[end+2:]
+		} else if end := strings.IndexAny(rest, " \t"); end >= 0 {
+			word, rest = rest[:end], rest[end:]
+		} else {
+			word, rest = rest, ""
+		}
+		rest = strings.TrimSpace(rest)
+
+		prefix := strings.HasSuffix(word, "*")
+		terms := tokens(strings.TrimSuffix(word, "*"))
+		if len(terms) == 0 {
+			continue
+		}
+		query = append(query, Clause{Field: field, Terms: terms, Prefix: prefix})
+	}
+	if len(query) == 0 {
+		return nil, fmt.Errorf("nothing to search for")
+	}
+	return query, nil
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseQuery(t *testing.T) {
+	query, err := ParseQuery(`nose:banana "Dried Fruit" finish:spic* Oak`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Query{
+		{Field: FieldNose, Terms: []string{"banana"}},
+		{Terms: []string{"dried", "fruit"}},
+		{Field: FieldFinish, Terms: []string{"spic"}, Prefix: true},
+		{Terms: []string{"oak"}},
+	}
+	if len(query) != len(want) {
+		t.Fatalf("ParseQuery: got %+v", query)
+	}
+	for i := range want {
+		got := query[i]
+		if got.Field != want[i].Field || got.Prefix != want[i].Prefix || len(got.Terms) != len(want[i].Terms) || got.Terms[0] != want[i].Terms[0] {
+			t.Errorf("Clause %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	for _, text := range []string{"", "  ", `"unfinished`, "colour:amber"} {
+		if _, err := ParseQuery(text); err == nil {
+			t.Errorf("ParseQuery %q: expected an error", text)
+		}
+	}
+}
+
+func TestMemoryIndex(t *testing.T) {
+	ctx := context.Background()
+	organisation := primitive.NewObjectID()
+	index := NewMemoryIndex()
+	put := func(nose string, finish string) primitive.ObjectID {
+		document := Document{
+			Id:             primitive.NewObjectID(),
+			OrganisationId: organisation,
+			Date:           time.Now(),
+			Fields:         map[string]string{FieldNose: nose, FieldFinish: finish},
+		}
+		if err := index.Put(ctx, document); err != nil {
+			t.Fatal(err)
+		}
+		return document.Id
+	}
+	banana := put("Ripe banana, banana bread and vanilla", "Long, dried fruit")
+	fruit := put("Dried fruit and oak", "Short and spicy")
+	spice := put("Cut grass", "Spiced fruit, banana")
+
+	tests := []struct {
+		query string
+		want  []primitive.ObjectID
+	}{
+		{"banana", []primitive.ObjectID{banana, spice}},
+		{"nose:banana", []primitive.ObjectID{banana}},
+		{`"dried fruit"`, []primitive.ObjectID{banana, fruit}},
+		{`nose:"dried fruit"`, []primitive.ObjectID{fruit}},
+		{`"fruit dried"`, nil},
+		{"spic*", []primitive.ObjectID{fruit, spice}},
+		{"spic* banana", []primitive.ObjectID{spice}},
+		{`"banana bre*"`, []primitive.ObjectID{banana}},
+	}
+	for _, test := range tests {
+		query, err := ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hits, err := index.Search(ctx, organisation, query)
+		if err != nil || len(hits) != len(test.want) {
+			t.Errorf("Search %q: got %v hits, %v, want %v", test.query, len(hits), err, len(test.want))
+			continue
+		}
+		found := make(map[primitive.ObjectID]bool)
+		for _, hit := range hits {
+			found[hit.Id] = true
+		}
+		for _, id := range test.want {
+			if !found[id] {
+				t.Errorf("Search %q: missing %v", test.query, id)
+			}
+		}
+	}
+
+	query, _ := ParseQuery("banana")
+	if hits, _ := index.Search(ctx, organisation, query); len(hits) == 0 || hits[0].Id != banana || hits[0].Score != 2 {
+		t.Errorf("Best hit for banana: got %+v", hits)
+	}
+	index.Remove(ctx, organisation, banana)
+	if hits, _ := index.Search(ctx, organisation, query); len(hits) != 1 || hits[0].Id != spice {
+		t.Errorf("Search after remove: got %+v", hits)
+	}
+	if hits, _ := index.Search(ctx, primitive.NewObjectID(), query); len(hits) != 0 {
+		t.Errorf("Search another organisation: got %+v", hits)
+	}
+}
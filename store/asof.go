@@ -0,0 +1,142 @@
+package store
+
+import (
+	"aging-api/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrReadOnly is returned for writes through a store from AsOf.
+var ErrReadOnly = errors.New("past versions cannot be changed")
+
+// asOfRepository reads documents as they were at a point in time from their
+// versions. Documents written before versions were kept have none; they are
+// taken as they are now if they had been created by then.
+type asOfRepository[T any] struct {
+	kind[T]
+	base         Repository[T]
+	versions     VersionRepository
+	organisation primitive.ObjectID
+	at           primitive.DateTime
+}
+
+// latest picks the last version written by r.at out of versions, which are
+// oldest first.
+func (r *asOfRepository[T]) latest(versions []models.Version) (models.Version, bool) {
+	var found models.Version
+	ok := false
+	for _, version := range versions {
+		if version.CreatedAt > r.at {
+			break
+		}
+		found, ok = version, true
+	}
+	return found, ok
+}
+
+// gone reports whether a document no longer existed after version.
+func (r *asOfRepository[T]) gone(version models.Version) bool {
+	return version.Operation == models.AuditDelete || version.Operation == models.AuditPurge
+}
+
+func (r *asOfRepository[T]) decode(version models.Version) (T, error) {
+	var document T
+	err := json.Unmarshal(version.Document, &document)
+	return document, err
+}
+
+func (r *asOfRepository[T]) FindById(ctx context.Context, id primitive.ObjectID) (T, error) {
+	var zero T
+	versions, err := r.versions.Find(ctx, r.organisation, r.entity, &id)
+	if err != nil {
+		return zero, err
+	}
+
+	if len(versions) == 0 {
+		document, err := r.base.FindById(ctx, id)
+		if err != nil {
+			return zero, err
+		}
+		if r.created(&document) > r.at {
+			return zero, ErrNotFound
+		}
+		return document, nil
+	}
+
+	version, ok := r.latest(versions)
+	if !ok || r.gone(version) {
+		return zero, ErrNotFound
+	}
+	return r.decode(version)
+}
+
+func (r *asOfRepository[T]) FindAll(ctx context.Context) ([]T, error) {
+	versions, err := r.versions.Find(ctx, r.organisation, r.entity, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	byEntity := make(map[primitive.ObjectID][]models.Version)
+	order := make([]primitive.ObjectID, 0)
+	for _, version := range versions {
+		if _, seen := byEntity[version.EntityId]; !seen {
+			order = append(order, version.EntityId)
+		}
+		byEntity[version.EntityId] = append(byEntity[version.EntityId], version)
+	}
+
+	results := make([]T, 0, len(order))
+	for _, id := range order {
+		version, ok := r.latest(byEntity[id])
+		if !ok || r.gone(version) {
+			continue
+		}
+		document, err := r.decode(version)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, document)
+	}
+
+	current, err := r.base.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range current {
+		if _, versioned := byEntity[r.id(&current[i])]; !versioned && r.created(&current[i]) <= r.at {
+			results = append(results, current[i])
+		}
+	}
+	return results, nil
+}
+
+func (r *asOfRepository[T]) Create(ctx context.Context, document *T) error {
+	return ErrReadOnly
+}
+
+func (r *asOfRepository[T]) Update(ctx context.Context, document *T) error {
+	return ErrReadOnly
+}
+
+func (r *asOfRepository[T]) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return ErrReadOnly
+}
+
+func asOf[T any](s *Store, base Repository[T], organisationId primitive.ObjectID, at time.Time, kind kind[T]) *asOfRepository[T] {
+	return &asOfRepository[T]{kind: kind, base: base, versions: s.Versions, organisation: organisationId, at: primitive.NewDateTimeFromTime(at)}
+}
+
+// AsOf returns a read-only copy of s in which spirits, batches and vessels
+// are as they were at a point in time. Measurements and movements are dated
+// records and are left as they are. Use it on a store from ForOrganisation.
+func (s *Store) AsOf(organisationId primitive.ObjectID, at time.Time) *Store {
+	past := *s
+	past.Spirits = asOf[models.Spirit](s, s.Spirits, organisationId, at, spiritKind)
+	past.Batches = asOf[models.Batch](s, s.Batches, organisationId, at, batchKind)
+	past.Vessels = asOf[models.Vessel](s, s.Vessels, organisationId, at, vesselKind)
+	return &past
+}
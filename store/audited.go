@@ -0,0 +1,162 @@
+package store
+
+import (
+	"aging-api/audit"
+	"aging-api/models"
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actor is who a write is recorded against in the audit log.
+type Actor struct {
+	UserId   primitive.ObjectID
+	ApiKeyId *primitive.ObjectID
+}
+
+// auditedRepository appends an audit entry after every successful write,
+// and a version too for versioned kinds. An update that marks a document
+// deleted is recorded as a delete and one that clears the mark as a restore;
+// removing a document already marked deleted is a purge.
+type auditedRepository[T any] struct {
+	kind[T]
+	base     Repository[T]
+	log      AuditRepository
+	versions VersionRepository
+	actor    Actor
+}
+
+func audited[T any](s *Store, base Repository[T], actor Actor, kind kind[T]) *auditedRepository[T] {
+	return &auditedRepository[T]{kind: kind, base: base, log: s.Audit, versions: s.Versions, actor: actor}
+}
+
+func (r *auditedRepository[T]) record(ctx context.Context, operation string, document *T, before interface{}, after interface{}) error {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		return err
+	}
+	if operation == models.AuditUpdate && len(changes) == 0 {
+		return nil
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	err = r.log.Create(ctx, &models.AuditEntry{
+		Id:             primitive.NewObjectID(),
+		CreatedAt:      now,
+		OrganisationId: *r.owner(document),
+		ActorId:        r.actor.UserId,
+		ApiKeyId:       r.actor.ApiKeyId,
+		Entity:         r.entity,
+		EntityId:       r.id(document),
+		Operation:      operation,
+		Changes:        changes,
+	})
+	if err != nil || !r.versioned {
+		return err
+	}
+
+	var snapshot json.RawMessage
+	if after != nil {
+		if snapshot, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+	return r.versions.Create(ctx, &models.Version{
+		Id:             primitive.NewObjectID(),
+		CreatedAt:      now,
+		OrganisationId: *r.owner(document),
+		Entity:         r.entity,
+		EntityId:       r.id(document),
+		Operation:      operation,
+		Document:       snapshot,
+	})
+}
+
+func (r *auditedRepository[T]) Create(ctx context.Context, document *T) error {
+	if err := r.base.Create(ctx, document); err != nil {
+		return err
+	}
+	return r.record(ctx, models.AuditCreate, document, nil, document)
+}
+
+func (r *auditedRepository[T]) FindById(ctx context.Context, id primitive.ObjectID) (T, error) {
+	return r.base.FindById(ctx, id)
+}
+
+func (r *auditedRepository[T]) FindAll(ctx context.Context) ([]T, error) {
+	return r.base.FindAll(ctx)
+}
+
+func (r *auditedRepository[T]) Update(ctx context.Context, document *T) error {
+	before, err := r.base.FindById(ctx, r.id(document))
+	if err != nil {
+		return err
+	}
+	if err := r.base.Update(ctx, document); err != nil {
+		return err
+	}
+	operation := models.AuditUpdate
+	switch {
+	case !r.deleted(&before) && r.deleted(document):
+		operation = models.AuditDelete
+	case r.deleted(&before) && !r.deleted(document):
+		operation = models.AuditRestore
+	}
+	return r.record(ctx, operation, document, before, document)
+}
+
+func (r *auditedRepository[T]) Delete(ctx context.Context, id primitive.ObjectID) error {
+	before, err := r.base.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.base.Delete(ctx, id); err != nil {
+		return err
+	}
+	operation := models.AuditDelete
+	if r.deleted(&before) {
+		operation = models.AuditPurge
+	}
+	return r.record(ctx, operation, &before, before, nil)
+}
+
+type auditedMeasurements struct {
+	*auditedRepository[models.Measurement]
+	measurements MeasurementRepository
+}
+
+func (r *auditedMeasurements) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Measurement, error) {
+	return r.measurements.FindByVessel(ctx, vesselId)
+}
+
+type auditedMovements struct {
+	*auditedRepository[models.Movement]
+	movements MovementRepository
+}
+
+func (r *auditedMovements) FindByBatch(ctx context.Context, batchId primitive.ObjectID) ([]models.Movement, error) {
+	return r.movements.FindByBatch(ctx, batchId)
+}
+
+func (r *auditedMovements) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Movement, error) {
+	return r.movements.FindByVessel(ctx, vesselId)
+}
+
+// AuditedBy returns a copy of s that records every create, update, delete,
+// restore and purge of a spirit, batch, vessel, measurement, descriptor,
+// tasting or movement against actor, and keeps every version of spirits,
+// batches and vessels. Use it on a store from ForOrganisation so entries
+// carry the organisation the document belongs to.
+func (s *Store) AuditedBy(actor Actor) *Store {
+	logged := *s
+	logged.Spirits = audited[models.Spirit](s, s.Spirits, actor, spiritKind)
+	logged.Batches = audited[models.Batch](s, s.Batches, actor, batchKind)
+	logged.Vessels = audited[models.Vessel](s, s.Vessels, actor, vesselKind)
+	logged.Measurements = &auditedMeasurements{audited[models.Measurement](s, s.Measurements, actor, measurementKind), s.Measurements}
+	logged.Descriptors = audited[models.Descriptor](s, s.Descriptors, actor, descriptorKind)
+	logged.Tastings = audited[models.TastingSession](s, s.Tastings, actor, tastingKind)
+	logged.Movements = &auditedMovements{audited[models.Movement](s, s.Movements, actor, movementKind), s.Movements}
+	return &logged
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"aging-api/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// kind describes a model that belongs to an organisation, for the
+// repositories that wrap another one in ForOrganisation, AuditedBy and AsOf.
+// Versioned kinds keep a Version of every write; kinds with a deletion are
+// deleted by marking them, and nil deletion means they are removed at once.
+type kind[T any] struct {
+	entity    string
+	versioned bool
+	id        func(*T) primitive.ObjectID
+	owner     func(*T) *primitive.ObjectID
+	created   func(*T) primitive.DateTime
+	deletion  func(*T) *models.Deletion
+}
+
+func (k kind[T]) deleted(document *T) bool {
+	return k.deletion != nil && k.deletion(document).Deleted()
+}
+
+var (
+	spiritKind = kind[models.Spirit]{
+		entity:    "spirit",
+		versioned: true,
+		id:        func(s *models.Spirit) primitive.ObjectID { return s.Id },
+		owner:     func(s *models.Spirit) *primitive.ObjectID { return &s.OrganisationId },
+		created:   func(s *models.Spirit) primitive.DateTime { return s.CreatedAt },
+		deletion:  func(s *models.Spirit) *models.Deletion { return &s.Deletion },
+	}
+	batchKind = kind[models.Batch]{
+		entity:    "batch",
+		versioned: true,
+		id:        func(b *models.Batch) primitive.ObjectID { return b.Id },
+		owner:     func(b *models.Batch) *primitive.ObjectID { return &b.OrganisationId },
+		created:   func(b *models.Batch) primitive.DateTime { return b.CreatedAt },
+		deletion:  func(b *models.Batch) *models.Deletion { return &b.Deletion },
+	}
+	vesselKind = kind[models.Vessel]{
+		entity:    "vessel",
+		versioned: true,
+		id:        func(v *models.Vessel) primitive.ObjectID { return v.Id },
+		owner:     func(v *models.Vessel) *primitive.ObjectID { return &v.OrganisationId },
+		created:   func(v *models.Vessel) primitive.DateTime { return v.CreatedAt },
+		deletion:  func(v *models.Vessel) *models.Deletion { return &v.Deletion },
+	}
+	measurementKind = kind[models.Measurement]{
+		entity:   "measurement",
+		id:       func(m *models.Measurement) primitive.ObjectID { return m.Id },
+		owner:    func(m *models.Measurement) *primitive.ObjectID { return &m.OrganisationId },
+		created:  func(m *models.Measurement) primitive.DateTime { return m.CreatedAt },
+		deletion: func(m *models.Measurement) *models.Deletion { return &m.Deletion },
+	}
+	descriptorKind = kind[models.Descriptor]{
+		entity:  "descriptor",
+		id:      func(d *models.Descriptor) primitive.ObjectID { return d.Id },
+		owner:   func(d *models.Descriptor) *primitive.ObjectID { return &d.OrganisationId },
+		created: func(d *models.Descriptor) primitive.DateTime { return d.CreatedAt },
+	}
+	tastingKind = kind[models.TastingSession]{
+		entity:  "tasting",
+		id:      func(t *models.TastingSession) primitive.ObjectID { return t.Id },
+		owner:   func(t *models.TastingSession) *primitive.ObjectID { return &t.OrganisationId },
+		created: func(t *models.TastingSession) primitive.DateTime { return t.CreatedAt },
+	}
+	movementKind = kind[models.Movement]{
+		entity:  "movement",
+		id:      func(m *models.Movement) primitive.ObjectID { return m.Id },
+		owner:   func(m *models.Movement) *primitive.ObjectID { return &m.OrganisationId },
+		created: func(m *models.Movement) primitive.DateTime { return m.CreatedAt },
+	}
+)
+
+// IsEntity reports whether entity names one of the kinds above, as used in
+// audit entries.
+func IsEntity(entity string) bool {
+	switch entity {
+	case spiritKind.entity, batchKind.entity, vesselKind.entity, measurementKind.entity, descriptorKind.entity, tastingKind.entity, movementKind.entity:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package memstore
+
+import (
+	"aging-api/store"
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type collection[T any] struct {
+	mu        sync.RWMutex
+	documents map[primitive.ObjectID][]byte
+	order     []primitive.ObjectID
+	id        func(*T) *primitive.ObjectID
+	unique    func(*T) string
+}
+
+func newCollection[T any](id func(*T) *primitive.ObjectID) *collection[T] {
+	return &collection[T]{
+		documents: make(map[primitive.ObjectID][]byte),
+		id:        id,
+	}
+}
+
+// Documents are kept BSON-encoded so that callers never share memory with
+// the store and fields excluded from Mongo are excluded here as well.
+func encode[T any](document *T) ([]byte, error) {
+	return bson.Marshal(document)
+}
+
+func decode[T any](raw []byte) (T, error) {
+	var document T
+	err := bson.Unmarshal(raw, &document)
+	return document, err
+}
+
+func (c *collection[T]) Create(ctx context.Context, document *T) error {
+	if c.id(document).IsZero() {
+		*c.id(document) = primitive.NewObjectID()
+	}
+
+	raw, err := encode(document)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := *c.id(document)
+	if _, exists := c.documents[id]; exists {
+		return store.ErrDuplicate
+	}
+	if err := c.checkUnique(document, id); err != nil {
+		return err
+	}
+
+	c.documents[id] = raw
+	c.order = append(c.order, id)
+	return nil
+}
+
+func (c *collection[T]) FindById(ctx context.Context, id primitive.ObjectID) (T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	raw, ok := c.documents[id]
+	if !ok {
+		var zero T
+		return zero, store.ErrNotFound
+	}
+	return decode[T](raw)
+}
+
+func (c *collection[T]) FindAll(ctx context.Context) ([]T, error) {
+	return c.filter(func(*T) bool { return true })
+}
+
+func (c *collection[T]) Update(ctx context.Context, document *T) error {
+	raw, err := encode(document)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := *c.id(document)
+	if _, exists := c.documents[id]; !exists {
+		return store.ErrNotFound
+	}
+	if err := c.checkUnique(document, id); err != nil {
+		return err
+	}
+
+	c.documents[id] = raw
+	return nil
+}
+
+func (c *collection[T]) Delete(ctx context.Context, id primitive.ObjectID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.documents[id]; !exists {
+		return store.ErrNotFound
+	}
+
+	delete(c.documents, id)
+	for i, existing := range c.order {
+		if existing == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (c *collection[T]) findOne(match func(*T) bool) (T, error) {
+	results, err := c.filter(match)
+	if err != nil || len(results) == 0 {
+		var zero T
+		if err == nil {
+			err = store.ErrNotFound
+		}
+		return zero, err
+	}
+	return results[0], nil
+}
+
+func (c *collection[T]) filter(match func(*T) bool) ([]T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	results := make([]T, 0)
+	for _, id := range c.order {
+		document, err := decode[T](c.documents[id])
+		if err != nil {
+			return nil, err
+		}
+		if match(&document) {
+			results = append(results, document)
+		}
+	}
+	return results, nil
+}
+
+// checkUnique must be called with the write lock held.
+func (c *collection[T]) checkUnique(document *T, id primitive.ObjectID) error {
+	if c.unique == nil {
+		return nil
+	}
+
+	key := c.unique(document)
+	for otherId, raw := range c.documents {
+		if otherId == id {
+			continue
+		}
+		other, err := decode[T](raw)
+		if err != nil {
+			return err
+		}
+		if c.unique(&other) == key {
+			return store.ErrDuplicate
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package memstore
+
+import (
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type userCollection struct {
+	*collection[models.User]
+}
+
+func (c *userCollection) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	return c.findOne(func(u *models.User) bool { return u.Email == email })
+}
+
+type measurementCollection struct {
+	*collection[models.Measurement]
+}
+
+func (c *measurementCollection) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Measurement, error) {
+	return c.filter(func(m *models.Measurement) bool { return m.VesselId != nil && *m.VesselId == vesselId })
+}
+
+type movementCollection struct {
+	*collection[models.Movement]
+}
+
+func (c *movementCollection) FindByBatch(ctx context.Context, batchId primitive.ObjectID) ([]models.Movement, error) {
+	return c.filter(func(m *models.Movement) bool { return m.BatchId == batchId })
+}
+
+func (c *movementCollection) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Movement, error) {
+	return c.filter(func(m *models.Movement) bool {
+		return (m.FromVesselId != nil && *m.FromVesselId == vesselId) ||
+			(m.ToVesselId != nil && *m.ToVesselId == vesselId)
+	})
+}
+
+type sessionCollection struct {
+	*collection[models.Session]
+}
+
+func (c *sessionCollection) FindByTokenHash(ctx context.Context, hash string) (models.Session, error) {
+	return c.findOne(func(s *models.Session) bool { return s.TokenHash == hash })
+}
+
+func (c *sessionCollection) FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.Session, error) {
+	return c.filter(func(s *models.Session) bool { return s.UserId == userId })
+}
+
+type apiKeyCollection struct {
+	*collection[models.ApiKey]
+}
+
+func (c *apiKeyCollection) FindByKeyHash(ctx context.Context, hash string) (models.ApiKey, error) {
+	return c.findOne(func(k *models.ApiKey) bool { return k.KeyHash == hash })
+}
+
+func (c *apiKeyCollection) FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.ApiKey, error) {
+	return c.filter(func(k *models.ApiKey) bool { return k.UserId == userId })
+}
+
+type userTokenCollection struct {
+	*collection[models.UserToken]
+}
+
+func (c *userTokenCollection) FindByTokenHash(ctx context.Context, hash string) (models.UserToken, error) {
+	return c.findOne(func(t *models.UserToken) bool { return t.TokenHash == hash })
+}
+
+func (c *userTokenCollection) MarkUsed(ctx context.Context, id primitive.ObjectID, usedAt primitive.DateTime) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	raw, exists := c.documents[id]
+	if !exists {
+		return store.ErrNotFound
+	}
+	token, err := decode[models.UserToken](raw)
+	if err != nil {
+		return err
+	}
+	if token.UsedAt != 0 {
+		return store.ErrNotFound
+	}
+	token.UsedAt = usedAt
+	if c.documents[id], err = encode(&token); err != nil {
+		return err
+	}
+	return nil
+}
+
+type lockoutCollection struct {
+	*collection[models.Lockout]
+}
+
+func (c *lockoutCollection) FindByKey(ctx context.Context, key string) (models.Lockout, error) {
+	return c.findOne(func(l *models.Lockout) bool { return l.Key == key })
+}
+
+type membershipCollection struct {
+	*collection[models.Membership]
+}
+
+func (c *membershipCollection) FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.Membership, error) {
+	return c.filter(func(m *models.Membership) bool { return m.UserId == userId })
+}
+
+func (c *membershipCollection) FindByOrganisation(ctx context.Context, organisationId primitive.ObjectID) ([]models.Membership, error) {
+	return c.filter(func(m *models.Membership) bool { return m.OrganisationId == organisationId })
+}
+
+type auditCollection struct {
+	*collection[models.AuditEntry]
+}
+
+func (c *auditCollection) Find(ctx context.Context, organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) ([]models.AuditEntry, error) {
+	return c.filter(func(e *models.AuditEntry) bool {
+		return e.OrganisationId == organisationId &&
+			(entity == "" || e.Entity == entity) &&
+			(entityId == nil || e.EntityId == *entityId)
+	})
+}
+
+type versionCollection struct {
+	*collection[models.Version]
+}
+
+func (c *versionCollection) Find(ctx context.Context, organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) ([]models.Version, error) {
+	return c.filter(func(v *models.Version) bool {
+		return v.OrganisationId == organisationId &&
+			(entity == "" || v.Entity == entity) &&
+			(entityId == nil || v.EntityId == *entityId)
+	})
+}
+
+func New() *store.Store {
+	users := newCollection(func(u *models.User) *primitive.ObjectID { return &u.Id })
+	users.unique = func(u *models.User) string { return u.Email }
+	sessions := newCollection(func(s *models.Session) *primitive.ObjectID { return &s.Id })
+	sessions.unique = func(s *models.Session) string { return s.TokenHash }
+	apiKeys := newCollection(func(k *models.ApiKey) *primitive.ObjectID { return &k.Id })
+	apiKeys.unique = func(k *models.ApiKey) string { return k.KeyHash }
+	lockouts := newCollection(func(l *models.Lockout) *primitive.ObjectID { return &l.Id })
+	lockouts.unique = func(l *models.Lockout) string { return l.Key }
+	memberships := newCollection(func(m *models.Membership) *primitive.ObjectID { return &m.Id })
+	memberships.unique = func(m *models.Membership) string { return m.OrganisationId.Hex() + "/" + m.UserId.Hex() }
+
+	return &store.Store{
+		Spirits:       newCollection(func(s *models.Spirit) *primitive.ObjectID { return &s.Id }),
+		Batches:       newCollection(func(b *models.Batch) *primitive.ObjectID { return &b.Id }),
+		Vessels:       newCollection(func(v *models.Vessel) *primitive.ObjectID { return &v.Id }),
+		Measurements:  &measurementCollection{newCollection(func(m *models.Measurement) *primitive.ObjectID { return &m.Id })},
+		Descriptors:   newCollection(func(d *models.Descriptor) *primitive.ObjectID { return &d.Id }),
+		Tastings:      newCollection(func(t *models.TastingSession) *primitive.ObjectID { return &t.Id }),
+		Users:         &userCollection{users},
+		Movements:     &movementCollection{newCollection(func(m *models.Movement) *primitive.ObjectID { return &m.Id })},
+		Sessions:      &sessionCollection{sessions},
+		ApiKeys:       &apiKeyCollection{apiKeys},
+		UserTokens:    &userTokenCollection{newCollection(func(t *models.UserToken) *primitive.ObjectID { return &t.Id })},
+		Lockouts:      &lockoutCollection{lockouts},
+		Organisations: newCollection(func(o *models.Organisation) *primitive.ObjectID { return &o.Id }),
+		Memberships:   &membershipCollection{memberships},
+		Audit:         &auditCollection{newCollection(func(e *models.AuditEntry) *primitive.ObjectID { return &e.Id })},
+		Versions:      &versionCollection{newCollection(func(v *models.Version) *primitive.ObjectID { return &v.Id })},
+	}
+}
@@ -0,0 +1,90 @@
+package mongostore
+
+import (
+	"aging-api/store"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type collection[T any] struct {
+	coll *mongo.Collection
+	id   func(*T) *primitive.ObjectID
+}
+
+func (c *collection[T]) Create(ctx context.Context, document *T) error {
+	if c.id(document).IsZero() {
+		*c.id(document) = primitive.NewObjectID()
+	}
+
+	_, err := c.coll.InsertOne(ctx, document)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrDuplicate
+	}
+	return err
+}
+
+func (c *collection[T]) FindById(ctx context.Context, id primitive.ObjectID) (T, error) {
+	return c.findOne(ctx, bson.M{"_id": id})
+}
+
+func (c *collection[T]) FindAll(ctx context.Context) ([]T, error) {
+	return c.find(ctx, bson.M{})
+}
+
+// FindByOrganisation is used by store.ForOrganisation for collections whose
+// documents carry an organisation id.
+func (c *collection[T]) FindByOrganisation(ctx context.Context, organisationId primitive.ObjectID) ([]T, error) {
+	return c.find(ctx, bson.M{"organisationid": organisationId})
+}
+
+func (c *collection[T]) Update(ctx context.Context, document *T) error {
+	result, err := c.coll.ReplaceOne(ctx, bson.M{"_id": *c.id(document)}, document)
+	if mongo.IsDuplicateKeyError(err) {
+		return store.ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount < 1 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (c *collection[T]) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := c.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount < 1 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (c *collection[T]) findOne(ctx context.Context, filter interface{}) (T, error) {
+	var document T
+	err := c.coll.FindOne(ctx, filter).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return document, store.ErrNotFound
+	}
+	return document, err
+}
+
+func (c *collection[T]) find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) ([]T, error) {
+	cur, err := c.coll.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	results := make([]T, 0)
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
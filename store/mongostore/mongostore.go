@@ -0,0 +1,364 @@
+package mongostore
+
+import (
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type userCollection struct {
+	collection[models.User]
+}
+
+func (c *userCollection) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	return c.findOne(ctx, bson.M{"email": email})
+}
+
+type measurementCollection struct {
+	collection[models.Measurement]
+}
+
+func (c *measurementCollection) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Measurement, error) {
+	return c.find(ctx, bson.M{"vesselid": vesselId})
+}
+
+type movementCollection struct {
+	collection[models.Movement]
+}
+
+func (c *movementCollection) FindByBatch(ctx context.Context, batchId primitive.ObjectID) ([]models.Movement, error) {
+	return c.find(ctx, bson.M{"batchid": batchId})
+}
+
+func (c *movementCollection) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Movement, error) {
+	return c.find(ctx, bson.M{"$or": bson.A{
+		bson.M{"fromvesselid": vesselId},
+		bson.M{"tovesselid": vesselId},
+	}})
+}
+
+type sessionCollection struct {
+	collection[models.Session]
+}
+
+func (c *sessionCollection) FindByTokenHash(ctx context.Context, hash string) (models.Session, error) {
+	return c.findOne(ctx, bson.M{"tokenhash": hash})
+}
+
+func (c *sessionCollection) FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.Session, error) {
+	return c.find(ctx, bson.M{"userid": userId})
+}
+
+type apiKeyCollection struct {
+	collection[models.ApiKey]
+}
+
+func (c *apiKeyCollection) FindByKeyHash(ctx context.Context, hash string) (models.ApiKey, error) {
+	return c.findOne(ctx, bson.M{"keyhash": hash})
+}
+
+func (c *apiKeyCollection) FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.ApiKey, error) {
+	return c.find(ctx, bson.M{"userid": userId})
+}
+
+type userTokenCollection struct {
+	collection[models.UserToken]
+}
+
+func (c *userTokenCollection) FindByTokenHash(ctx context.Context, hash string) (models.UserToken, error) {
+	return c.findOne(ctx, bson.M{"tokenhash": hash})
+}
+
+func (c *userTokenCollection) MarkUsed(ctx context.Context, id primitive.ObjectID, usedAt primitive.DateTime) error {
+	result, err := c.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "usedat": primitive.DateTime(0)},
+		bson.M{"$set": bson.M{"usedat": usedAt}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount < 1 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+type lockoutCollection struct {
+	collection[models.Lockout]
+}
+
+func (c *lockoutCollection) FindByKey(ctx context.Context, key string) (models.Lockout, error) {
+	return c.findOne(ctx, bson.M{"key": key})
+}
+
+type membershipCollection struct {
+	collection[models.Membership]
+}
+
+func (c *membershipCollection) FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.Membership, error) {
+	return c.find(ctx, bson.M{"userid": userId})
+}
+
+func (c *membershipCollection) FindByOrganisation(ctx context.Context, organisationId primitive.ObjectID) ([]models.Membership, error) {
+	return c.find(ctx, bson.M{"organisationid": organisationId})
+}
+
+// entityFilter narrows audit entries or versions to an organisation and,
+// optionally, a kind of entity and one entity.
+func entityFilter(organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) bson.M {
+	filter := bson.M{"organisationid": organisationId}
+	if entity != "" {
+		filter["entity"] = entity
+	}
+	if entityId != nil {
+		filter["entityid"] = *entityId
+	}
+	return filter
+}
+
+type auditCollection struct {
+	collection[models.AuditEntry]
+}
+
+func (c *auditCollection) Find(ctx context.Context, organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) ([]models.AuditEntry, error) {
+	return c.find(ctx, entityFilter(organisationId, entity, entityId), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+}
+
+type versionCollection struct {
+	collection[models.Version]
+}
+
+func (c *versionCollection) Find(ctx context.Context, organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) ([]models.Version, error) {
+	return c.find(ctx, entityFilter(organisationId, entity, entityId), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+}
+
+func New(ctx context.Context, client *mongo.Client, database string) (*store.Store, error) {
+	db := client.Database(database)
+
+	users := db.Collection("users")
+	_, err := users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := db.Collection("sessions")
+	_, err = sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenhash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userid", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys := db.Collection("apikeys")
+	_, err = apiKeys.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "keyhash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userid", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	userTokens := db.Collection("usertokens")
+	_, err = userTokens.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tokenhash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lockouts := db.Collection("lockouts")
+	_, err = lockouts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	memberships := db.Collection("memberships")
+	_, err = memberships.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "organisationid", Value: 1}, {Key: "userid", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userid", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := []string{"spirits", "batches", "vessels", "measurements", "descriptors", "tastings", "movements"}
+	for _, name := range tenants {
+		_, err = db.Collection(name).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "organisationid", Value: 1}},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	auditEntries := db.Collection("audit")
+	_, err = auditEntries.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "organisationid", Value: 1}, {Key: "entity", Value: 1}, {Key: "entityid", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	versions := db.Collection("versions")
+	_, err = versions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "organisationid", Value: 1}, {Key: "entity", Value: 1}, {Key: "entityid", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	organisations := db.Collection("organisations")
+	if err := adoptUnowned(ctx, db, organisations, memberships, tenants); err != nil {
+		return nil, err
+	}
+
+	// Accounts created before email verification existed stay usable.
+	_, err = users.UpdateMany(ctx,
+		bson.M{"emailverified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"emailverified": true}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.Store{
+		Spirits: &collection[models.Spirit]{
+			coll: db.Collection("spirits"),
+			id:   func(s *models.Spirit) *primitive.ObjectID { return &s.Id },
+		},
+		Batches: &collection[models.Batch]{
+			coll: db.Collection("batches"),
+			id:   func(b *models.Batch) *primitive.ObjectID { return &b.Id },
+		},
+		Vessels: &collection[models.Vessel]{
+			coll: db.Collection("vessels"),
+			id:   func(v *models.Vessel) *primitive.ObjectID { return &v.Id },
+		},
+		Measurements: &measurementCollection{collection[models.Measurement]{
+			coll: db.Collection("measurements"),
+			id:   func(m *models.Measurement) *primitive.ObjectID { return &m.Id },
+		}},
+		Descriptors: &collection[models.Descriptor]{
+			coll: db.Collection("descriptors"),
+			id:   func(d *models.Descriptor) *primitive.ObjectID { return &d.Id },
+		},
+		Tastings: &collection[models.TastingSession]{
+			coll: db.Collection("tastings"),
+			id:   func(t *models.TastingSession) *primitive.ObjectID { return &t.Id },
+		},
+		Users: &userCollection{collection[models.User]{
+			coll: users,
+			id:   func(u *models.User) *primitive.ObjectID { return &u.Id },
+		}},
+		Movements: &movementCollection{collection[models.Movement]{
+			coll: db.Collection("movements"),
+			id:   func(m *models.Movement) *primitive.ObjectID { return &m.Id },
+		}},
+		Sessions: &sessionCollection{collection[models.Session]{
+			coll: sessions,
+			id:   func(s *models.Session) *primitive.ObjectID { return &s.Id },
+		}},
+		ApiKeys: &apiKeyCollection{collection[models.ApiKey]{
+			coll: apiKeys,
+			id:   func(k *models.ApiKey) *primitive.ObjectID { return &k.Id },
+		}},
+		UserTokens: &userTokenCollection{collection[models.UserToken]{
+			coll: userTokens,
+			id:   func(t *models.UserToken) *primitive.ObjectID { return &t.Id },
+		}},
+		Lockouts: &lockoutCollection{collection[models.Lockout]{
+			coll: lockouts,
+			id:   func(l *models.Lockout) *primitive.ObjectID { return &l.Id },
+		}},
+		Organisations: &collection[models.Organisation]{
+			coll: organisations,
+			id:   func(o *models.Organisation) *primitive.ObjectID { return &o.Id },
+		},
+		Memberships: &membershipCollection{collection[models.Membership]{
+			coll: memberships,
+			id:   func(m *models.Membership) *primitive.ObjectID { return &m.Id },
+		}},
+		Audit: &auditCollection{collection[models.AuditEntry]{
+			coll: auditEntries,
+			id:   func(e *models.AuditEntry) *primitive.ObjectID { return &e.Id },
+		}},
+		Versions: &versionCollection{collection[models.Version]{
+			coll: versions,
+			id:   func(v *models.Version) *primitive.ObjectID { return &v.Id },
+		}},
+	}, nil
+}
+
+// adoptUnowned puts data from before organisations existed into a "Default"
+// organisation and makes every user without a membership a member of it.
+func adoptUnowned(ctx context.Context, db *mongo.Database, organisations *mongo.Collection, memberships *mongo.Collection, tenants []string) error {
+	unowned := bson.M{"organisationid": bson.M{"$exists": false}}
+
+	pending := false
+	for _, name := range tenants {
+		count, err := db.Collection(name).CountDocuments(ctx, unowned, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		pending = pending || count > 0
+	}
+	members, err := memberships.CountDocuments(ctx, bson.M{}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	users, err := db.Collection("users").Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	var existing []models.User
+	if err := users.All(ctx, &existing); err != nil {
+		return err
+	}
+	if !pending && (members > 0 || len(existing) == 0) {
+		return nil
+	}
+
+	organisation := models.Organisation{
+		Id:        primitive.NewObjectID(),
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+		Name:      "Default",
+	}
+	if _, err := organisations.InsertOne(ctx, organisation); err != nil {
+		return err
+	}
+	for _, name := range tenants {
+		_, err := db.Collection(name).UpdateMany(ctx, unowned, bson.M{"$set": bson.M{"organisationid": organisation.Id}})
+		if err != nil {
+			return err
+		}
+	}
+	if members > 0 {
+		return nil
+	}
+	for _, user := range existing {
+		_, err := memberships.InsertOne(ctx, models.Membership{
+			Id:             primitive.NewObjectID(),
+			CreatedAt:      organisation.CreatedAt,
+			OrganisationId: organisation.Id,
+			UserId:         user.Id,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
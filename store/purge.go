@@ -0,0 +1,50 @@
+package store
+
+import (
+	"aging-api/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func purge[T any](ctx context.Context, repo Repository[T], kind kind[T], before primitive.DateTime) (int, error) {
+	documents, err := repo.FindAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for i := range documents {
+		if !kind.deleted(&documents[i]) || kind.deletion(&documents[i]).DeletedAt >= before {
+			continue
+		}
+		if err := repo.Delete(ctx, kind.id(&documents[i])); err != nil && err != ErrNotFound {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// PurgeDeleted removes for good the spirits, batches, vessels and
+// measurements of every organisation that were deleted before a time, and
+// returns how many went. Each removal is logged as a purge with no actor.
+// Use it on the store as opened, not one from ForOrganisation.
+func (s *Store) PurgeDeleted(ctx context.Context, before primitive.DateTime) (int, error) {
+	logged := s.AuditedBy(Actor{})
+	total := 0
+
+	n, err := purge[models.Measurement](ctx, logged.Measurements, measurementKind, before)
+	if total += n; err != nil {
+		return total, err
+	}
+	n, err = purge[models.Spirit](ctx, logged.Spirits, spiritKind, before)
+	if total += n; err != nil {
+		return total, err
+	}
+	n, err = purge[models.Batch](ctx, logged.Batches, batchKind, before)
+	if total += n; err != nil {
+		return total, err
+	}
+	n, err = purge[models.Vessel](ctx, logged.Vessels, vesselKind, before)
+	return total + n, err
+}
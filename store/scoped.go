@@ -0,0 +1,157 @@
+package store
+
+import (
+	"aging-api/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// organisationFinder is implemented by repositories that can narrow FindAll
+// to one organisation themselves rather than have every document loaded and
+// filtered.
+type organisationFinder[T any] interface {
+	FindByOrganisation(ctx context.Context, organisationId primitive.ObjectID) ([]T, error)
+}
+
+// scopedRepository only sees documents belonging to one organisation.
+// Documents of any other organisation are reported as not found, so knowing
+// or guessing their ids gives nothing away. It sees either only documents
+// that have not been deleted or, for restoring them, only those that have.
+type scopedRepository[T any] struct {
+	kind[T]
+	base         Repository[T]
+	organisation primitive.ObjectID
+	tombstones   bool
+}
+
+func scope[T any](base Repository[T], organisation primitive.ObjectID, tombstones bool, kind kind[T]) *scopedRepository[T] {
+	return &scopedRepository[T]{kind: kind, base: base, organisation: organisation, tombstones: tombstones}
+}
+
+func (r *scopedRepository[T]) owns(document *T) bool {
+	if *r.owner(document) != r.organisation {
+		return false
+	}
+	return r.deletion == nil || r.deleted(document) == r.tombstones
+}
+
+func (r *scopedRepository[T]) filter(documents []T) []T {
+	owned := make([]T, 0, len(documents))
+	for i := range documents {
+		if r.owns(&documents[i]) {
+			owned = append(owned, documents[i])
+		}
+	}
+	return owned
+}
+
+func (r *scopedRepository[T]) Create(ctx context.Context, document *T) error {
+	*r.owner(document) = r.organisation
+	return r.base.Create(ctx, document)
+}
+
+func (r *scopedRepository[T]) FindById(ctx context.Context, id primitive.ObjectID) (T, error) {
+	document, err := r.base.FindById(ctx, id)
+	if err != nil {
+		return document, err
+	}
+	if !r.owns(&document) {
+		var zero T
+		return zero, ErrNotFound
+	}
+	return document, nil
+}
+
+func (r *scopedRepository[T]) FindAll(ctx context.Context) ([]T, error) {
+	var documents []T
+	var err error
+	if finder, ok := r.base.(organisationFinder[T]); ok {
+		documents, err = finder.FindByOrganisation(ctx, r.organisation)
+	} else {
+		documents, err = r.base.FindAll(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.filter(documents), nil
+}
+
+// Update and Delete check the stored document rather than the one passed
+// in, which may claim any organisation.
+func (r *scopedRepository[T]) Update(ctx context.Context, document *T) error {
+	if _, err := r.FindById(ctx, r.id(document)); err != nil {
+		return err
+	}
+	*r.owner(document) = r.organisation
+	return r.base.Update(ctx, document)
+}
+
+func (r *scopedRepository[T]) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := r.FindById(ctx, id); err != nil {
+		return err
+	}
+	return r.base.Delete(ctx, id)
+}
+
+type scopedMeasurements struct {
+	*scopedRepository[models.Measurement]
+	measurements MeasurementRepository
+}
+
+func (r *scopedMeasurements) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Measurement, error) {
+	measurements, err := r.measurements.FindByVessel(ctx, vesselId)
+	if err != nil {
+		return nil, err
+	}
+	return r.filter(measurements), nil
+}
+
+type scopedMovements struct {
+	*scopedRepository[models.Movement]
+	movements MovementRepository
+}
+
+func (r *scopedMovements) FindByBatch(ctx context.Context, batchId primitive.ObjectID) ([]models.Movement, error) {
+	movements, err := r.movements.FindByBatch(ctx, batchId)
+	if err != nil {
+		return nil, err
+	}
+	return r.filter(movements), nil
+}
+
+func (r *scopedMovements) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Movement, error) {
+	movements, err := r.movements.FindByVessel(ctx, vesselId)
+	if err != nil {
+		return nil, err
+	}
+	return r.filter(movements), nil
+}
+
+func (s *Store) scoped(organisationId primitive.ObjectID, tombstones bool) *Store {
+	scoped := *s
+	scoped.Spirits = scope[models.Spirit](s.Spirits, organisationId, tombstones, spiritKind)
+	scoped.Batches = scope[models.Batch](s.Batches, organisationId, tombstones, batchKind)
+	scoped.Vessels = scope[models.Vessel](s.Vessels, organisationId, tombstones, vesselKind)
+	scoped.Measurements = &scopedMeasurements{scope[models.Measurement](s.Measurements, organisationId, tombstones, measurementKind), s.Measurements}
+	scoped.Descriptors = scope[models.Descriptor](s.Descriptors, organisationId, tombstones, descriptorKind)
+	scoped.Tastings = scope[models.TastingSession](s.Tastings, organisationId, tombstones, tastingKind)
+	scoped.Movements = &scopedMovements{scope[models.Movement](s.Movements, organisationId, tombstones, movementKind), s.Movements}
+	return &scoped
+}
+
+// ForOrganisation returns a copy of s whose spirits, batches, vessels,
+// measurements, descriptors, tastings and movements are limited to one
+// organisation and exclude deleted ones. New documents are assigned to the
+// organisation whatever organisation they name. Accounts and organisations
+// themselves are not scoped.
+func (s *Store) ForOrganisation(organisationId primitive.ObjectID) *Store {
+	return s.scoped(organisationId, false)
+}
+
+// DeletedIn is like ForOrganisation but sees only the spirits, batches,
+// vessels and measurements that have been deleted and not yet purged. Like
+// ForOrganisation, use it on the store as opened.
+func (s *Store) DeletedIn(organisationId primitive.ObjectID) *Store {
+	return s.scoped(organisationId, true)
+}
@@ -0,0 +1,62 @@
+CREATE TABLE spirits (
+    id          TEXT PRIMARY KEY,
+    created_at  BIGINT NOT NULL,
+    volume      REAL NOT NULL,
+    name        TEXT NOT NULL,
+    type        TEXT NOT NULL DEFAULT '',
+    initial_abv REAL NOT NULL,
+    recipe_name TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE batches (
+    id         TEXT PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    volume     REAL NOT NULL
+);
+
+CREATE TABLE vessels (
+    id         TEXT PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    volume     REAL NOT NULL,
+    material   TEXT NOT NULL DEFAULT '',
+    process    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE measurements (
+    id          TEXT PRIMARY KEY,
+    created_at  BIGINT NOT NULL,
+    abv         REAL NOT NULL,
+    image       TEXT NOT NULL DEFAULT '',
+    nose        TEXT NOT NULL DEFAULT '',
+    fore_palate TEXT NOT NULL DEFAULT '',
+    mid_palate  TEXT NOT NULL DEFAULT '',
+    finish      TEXT NOT NULL DEFAULT '',
+    notes       TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE users (
+    id         TEXT PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    email      TEXT NOT NULL UNIQUE,
+    password   TEXT NOT NULL
+);
+
+CREATE TABLE spirit_batches (
+    spirit_id TEXT NOT NULL REFERENCES spirits (id) ON DELETE CASCADE,
+    batch_id  TEXT NOT NULL REFERENCES batches (id) ON DELETE CASCADE,
+    PRIMARY KEY (spirit_id, batch_id)
+);
+
+CREATE TABLE batch_vessels (
+    batch_id  TEXT NOT NULL REFERENCES batches (id) ON DELETE CASCADE,
+    vessel_id TEXT NOT NULL REFERENCES vessels (id) ON DELETE CASCADE,
+    PRIMARY KEY (batch_id, vessel_id)
+);
+
+CREATE TABLE batch_measurements (
+    batch_id       TEXT NOT NULL REFERENCES batches (id) ON DELETE CASCADE,
+    measurement_id TEXT NOT NULL REFERENCES measurements (id) ON DELETE CASCADE,
+    PRIMARY KEY (batch_id, measurement_id)
+);
+
+CREATE INDEX batch_vessels_vessel_id ON batch_vessels (vessel_id);
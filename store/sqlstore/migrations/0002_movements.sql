@@ -0,0 +1,14 @@
+CREATE TABLE movements (
+    id             TEXT PRIMARY KEY,
+    created_at     BIGINT NOT NULL,
+    date           BIGINT NOT NULL,
+    batch_id       TEXT NOT NULL REFERENCES batches (id) ON DELETE CASCADE,
+    type           TEXT NOT NULL,
+    from_vessel_id TEXT REFERENCES vessels (id) ON DELETE SET NULL,
+    to_vessel_id   TEXT REFERENCES vessels (id) ON DELETE SET NULL,
+    volume         REAL NOT NULL
+);
+
+CREATE INDEX movements_batch_id ON movements (batch_id);
+CREATE INDEX movements_from_vessel_id ON movements (from_vessel_id);
+CREATE INDEX movements_to_vessel_id ON movements (to_vessel_id);
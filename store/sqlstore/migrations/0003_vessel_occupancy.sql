@@ -0,0 +1,2 @@
+ALTER TABLE vessels ADD COLUMN fill_level REAL NOT NULL DEFAULT 0;
+ALTER TABLE vessels ADD COLUMN status TEXT NOT NULL DEFAULT 'empty';
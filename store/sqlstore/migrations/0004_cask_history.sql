@@ -0,0 +1,11 @@
+ALTER TABLE vessels ADD COLUMN fill_number INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE vessels ADD COLUMN prior_contents TEXT NOT NULL DEFAULT '[]';
+
+CREATE TABLE vessel_treatments (
+    vessel_id TEXT NOT NULL REFERENCES vessels (id) ON DELETE CASCADE,
+    date      BIGINT NOT NULL,
+    process   TEXT NOT NULL,
+    notes     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX vessel_treatments_vessel_id ON vessel_treatments (vessel_id);
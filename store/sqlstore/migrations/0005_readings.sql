@@ -0,0 +1,7 @@
+ALTER TABLE measurements ADD COLUMN date BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE measurements ADD COLUMN batch_id TEXT REFERENCES batches (id) ON DELETE SET NULL;
+ALTER TABLE measurements ADD COLUMN vessel_id TEXT REFERENCES vessels (id) ON DELETE SET NULL;
+ALTER TABLE measurements ADD COLUMN volume REAL NOT NULL DEFAULT 0;
+ALTER TABLE vessels ADD COLUMN location TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX measurements_vessel_id ON measurements (vessel_id);
@@ -0,0 +1,2 @@
+ALTER TABLE measurements ADD COLUMN apparent_abv REAL NOT NULL DEFAULT 0;
+ALTER TABLE measurements ADD COLUMN temperature REAL;
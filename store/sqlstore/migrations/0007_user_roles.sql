@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'read_only';
+
+-- Whoever has been using the API longest keeps full access.
+UPDATE users SET role = 'admin' WHERE id = (SELECT id FROM users ORDER BY created_at LIMIT 1);
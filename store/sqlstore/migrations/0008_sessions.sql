@@ -0,0 +1,11 @@
+CREATE TABLE sessions (
+    id          TEXT PRIMARY KEY,
+    created_at  BIGINT NOT NULL,
+    user_id     TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash  TEXT NOT NULL UNIQUE,
+    expires_at  BIGINT NOT NULL,
+    revoked_at  BIGINT NOT NULL DEFAULT 0,
+    replaced_by TEXT
+);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
@@ -0,0 +1,13 @@
+CREATE TABLE api_keys (
+    id         TEXT PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    label      TEXT NOT NULL,
+    prefix     TEXT NOT NULL,
+    key_hash   TEXT NOT NULL UNIQUE,
+    scopes     TEXT NOT NULL,
+    expires_at BIGINT NOT NULL DEFAULT 0,
+    revoked_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE lockouts (
+    id              TEXT PRIMARY KEY,
+    created_at      BIGINT NOT NULL,
+    key             TEXT NOT NULL UNIQUE,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    last_failure_at BIGINT NOT NULL DEFAULT 0,
+    lockouts        INTEGER NOT NULL DEFAULT 0,
+    locked_at       BIGINT NOT NULL DEFAULT 0,
+    locked_until    BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,47 @@
+CREATE TABLE organisations (
+    id         TEXT PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    name       TEXT NOT NULL
+);
+
+CREATE TABLE memberships (
+    id              TEXT PRIMARY KEY,
+    created_at      BIGINT NOT NULL,
+    organisation_id TEXT NOT NULL REFERENCES organisations (id) ON DELETE CASCADE,
+    user_id         TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    UNIQUE (organisation_id, user_id)
+);
+
+CREATE INDEX memberships_user_id ON memberships (user_id);
+
+-- Everything that already exists belongs to one distillery, and everyone
+-- already using the API is a member of it.
+INSERT INTO organisations (id, created_at, name)
+SELECT '000000000000000000000001', COALESCE((SELECT MIN(created_at) FROM users), 0), 'Default'
+WHERE EXISTS (SELECT 1 FROM users)
+   OR EXISTS (SELECT 1 FROM spirits)
+   OR EXISTS (SELECT 1 FROM batches)
+   OR EXISTS (SELECT 1 FROM vessels)
+   OR EXISTS (SELECT 1 FROM measurements)
+   OR EXISTS (SELECT 1 FROM movements);
+
+INSERT INTO memberships (id, created_at, organisation_id, user_id)
+SELECT id, created_at, '000000000000000000000001', id FROM users;
+
+ALTER TABLE spirits ADD COLUMN organisation_id TEXT REFERENCES organisations (id) ON DELETE CASCADE;
+ALTER TABLE batches ADD COLUMN organisation_id TEXT REFERENCES organisations (id) ON DELETE CASCADE;
+ALTER TABLE vessels ADD COLUMN organisation_id TEXT REFERENCES organisations (id) ON DELETE CASCADE;
+ALTER TABLE measurements ADD COLUMN organisation_id TEXT REFERENCES organisations (id) ON DELETE CASCADE;
+ALTER TABLE movements ADD COLUMN organisation_id TEXT REFERENCES organisations (id) ON DELETE CASCADE;
+
+UPDATE spirits SET organisation_id = '000000000000000000000001';
+UPDATE batches SET organisation_id = '000000000000000000000001';
+UPDATE vessels SET organisation_id = '000000000000000000000001';
+UPDATE measurements SET organisation_id = '000000000000000000000001';
+UPDATE movements SET organisation_id = '000000000000000000000001';
+
+CREATE INDEX spirits_organisation_id ON spirits (organisation_id);
+CREATE INDEX batches_organisation_id ON batches (organisation_id);
+CREATE INDEX vessels_organisation_id ON vessels (organisation_id);
+CREATE INDEX measurements_organisation_id ON measurements (organisation_id);
+CREATE INDEX movements_organisation_id ON movements (organisation_id);
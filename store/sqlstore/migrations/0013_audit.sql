@@ -0,0 +1,15 @@
+-- Entries outlive the users and API keys they name, so actor_id and
+-- api_key_id are not foreign keys.
+CREATE TABLE audit_entries (
+    id              TEXT PRIMARY KEY,
+    created_at      BIGINT NOT NULL,
+    organisation_id TEXT NOT NULL REFERENCES organisations (id) ON DELETE CASCADE,
+    actor_id        TEXT NOT NULL,
+    api_key_id      TEXT,
+    entity          TEXT NOT NULL,
+    entity_id       TEXT NOT NULL,
+    operation       TEXT NOT NULL,
+    changes         TEXT NOT NULL
+);
+
+CREATE INDEX audit_entries_entity ON audit_entries (organisation_id, entity, entity_id);
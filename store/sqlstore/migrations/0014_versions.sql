@@ -0,0 +1,11 @@
+CREATE TABLE versions (
+    id              TEXT PRIMARY KEY,
+    created_at      BIGINT NOT NULL,
+    organisation_id TEXT NOT NULL REFERENCES organisations (id) ON DELETE CASCADE,
+    entity          TEXT NOT NULL,
+    entity_id       TEXT NOT NULL,
+    operation       TEXT NOT NULL,
+    document        TEXT
+);
+
+CREATE INDEX versions_entity ON versions (organisation_id, entity, entity_id);
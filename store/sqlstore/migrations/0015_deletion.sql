@@ -0,0 +1,8 @@
+ALTER TABLE spirits ADD COLUMN deleted_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE spirits ADD COLUMN deleted_by TEXT;
+ALTER TABLE batches ADD COLUMN deleted_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE batches ADD COLUMN deleted_by TEXT;
+ALTER TABLE vessels ADD COLUMN deleted_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE vessels ADD COLUMN deleted_by TEXT;
+ALTER TABLE measurements ADD COLUMN deleted_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE measurements ADD COLUMN deleted_by TEXT;
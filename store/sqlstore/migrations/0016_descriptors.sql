@@ -0,0 +1,12 @@
+CREATE TABLE descriptors (
+    id              TEXT PRIMARY KEY,
+    created_at      BIGINT NOT NULL,
+    organisation_id TEXT NOT NULL REFERENCES organisations (id) ON DELETE CASCADE,
+    parent_id       TEXT REFERENCES descriptors (id),
+    name            TEXT NOT NULL,
+    synonyms        TEXT
+);
+
+CREATE INDEX descriptors_organisation ON descriptors (organisation_id);
+
+ALTER TABLE measurements ADD COLUMN descriptors TEXT;
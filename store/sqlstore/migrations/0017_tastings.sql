@@ -0,0 +1,13 @@
+CREATE TABLE tastings (
+    id              TEXT PRIMARY KEY,
+    created_at      BIGINT NOT NULL,
+    organisation_id TEXT NOT NULL REFERENCES organisations (id) ON DELETE CASCADE,
+    name            TEXT NOT NULL,
+    date            BIGINT NOT NULL,
+    samples         TEXT,
+    panel_ids       TEXT,
+    scores          TEXT,
+    closed_at       BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX tastings_organisation ON tastings (organisation_id);
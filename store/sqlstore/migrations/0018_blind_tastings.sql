@@ -0,0 +1,7 @@
+-- Sessions from before owners were recorded have none; an admin can reveal them.
+ALTER TABLE tastings ADD COLUMN owner_id TEXT NOT NULL DEFAULT '000000000000000000000000';
+ALTER TABLE tastings ADD COLUMN blind BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE tastings ADD COLUMN revealed_at BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE measurements ADD COLUMN tasting_id TEXT;
+ALTER TABLE measurements ADD COLUMN score REAL;
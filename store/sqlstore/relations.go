@@ -0,0 +1,66 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// relation is one direction of a many-to-many join table.
+type relation struct {
+	table  string
+	owner  string
+	target string
+}
+
+func (r relation) inverse() relation {
+	return relation{table: r.table, owner: r.target, target: r.owner}
+}
+
+// set replaces the owner's rows in the join table. Targets that do not exist
+// in targetTable are skipped rather than violating the foreign key.
+func (r relation) set(ctx context.Context, q queryer, owner primitive.ObjectID, targetTable string, targets []primitive.ObjectID) error {
+	if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s = $1", r.table, r.owner), owner.Hex()); err != nil {
+		return err
+	}
+
+	insert := fmt.Sprintf(
+		"INSERT INTO %s (%s, %s) SELECT $1, id FROM %s WHERE id = $2",
+		r.table, r.owner, r.target, targetTable,
+	)
+	seen := make(map[primitive.ObjectID]bool, len(targets))
+	for _, target := range targets {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		if _, err := q.ExecContext(ctx, insert, owner.Hex(), target.Hex()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ids lists the targets the owner is related to through r, oldest first.
+func (r relation) ids(ctx context.Context, q queryer, owner primitive.ObjectID, targetTable string) ([]primitive.ObjectID, error) {
+	query := fmt.Sprintf(
+		"SELECT r.%s FROM %s r JOIN %s t ON t.id = r.%s WHERE r.%s = $1 ORDER BY t.created_at, t.id",
+		r.target, r.table, targetTable, r.target, r.owner,
+	)
+	rows, err := q.QueryContext(ctx, query, owner.Hex())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]primitive.ObjectID, 0)
+	for rows.Next() {
+		var id primitive.ObjectID
+		if err := rows.Scan(hexID{&id}); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
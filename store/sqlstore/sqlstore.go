@@ -0,0 +1,432 @@
+package sqlstore
+
+import (
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	_ "modernc.org/sqlite"
+)
+
+var (
+	spiritBatches     = relation{table: "spirit_batches", owner: "spirit_id", target: "batch_id"}
+	batchVessels      = relation{table: "batch_vessels", owner: "batch_id", target: "vessel_id"}
+	batchMeasurements = relation{table: "batch_measurements", owner: "batch_id", target: "measurement_id"}
+)
+
+// Open connects to a "sqlite" or "postgres" database. SQLite connections
+// have foreign key enforcement switched on so that join rows cascade.
+func Open(driver string, dsn string) (*sql.DB, error) {
+	switch driver {
+	case "sqlite":
+		if !strings.Contains(dsn, "_pragma=foreign_keys") {
+			separator := "?"
+			if strings.Contains(dsn, "?") {
+				separator = "&"
+			}
+			dsn += separator + "_pragma=foreign_keys(1)"
+		}
+	case "postgres":
+	default:
+		return nil, fmt.Errorf("unsupported SQL driver %q", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite" {
+		// SQLite allows a single writer; serialising connections avoids
+		// "database is locked" errors under concurrent requests.
+		db.SetMaxOpenConns(1)
+	}
+	return db, db.Ping()
+}
+
+type userTable struct {
+	*table[models.User]
+}
+
+func (t *userTable) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	return t.findOne(ctx, "email = $1", email)
+}
+
+type sessionTable struct {
+	*table[models.Session]
+}
+
+func (t *sessionTable) FindByTokenHash(ctx context.Context, hash string) (models.Session, error) {
+	return t.findOne(ctx, "token_hash = $1", hash)
+}
+
+func (t *sessionTable) FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.Session, error) {
+	return t.find(ctx, "user_id = $1", []interface{}{userId.Hex()})
+}
+
+type apiKeyTable struct {
+	*table[models.ApiKey]
+}
+
+func (t *apiKeyTable) FindByKeyHash(ctx context.Context, hash string) (models.ApiKey, error) {
+	return t.findOne(ctx, "key_hash = $1", hash)
+}
+
+func (t *apiKeyTable) FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.ApiKey, error) {
+	return t.find(ctx, "user_id = $1", []interface{}{userId.Hex()})
+}
+
+type userTokenTable struct {
+	*table[models.UserToken]
+}
+
+func (t *userTokenTable) FindByTokenHash(ctx context.Context, hash string) (models.UserToken, error) {
+	return t.findOne(ctx, "token_hash = $1", hash)
+}
+
+func (t *userTokenTable) MarkUsed(ctx context.Context, id primitive.ObjectID, usedAt primitive.DateTime) error {
+	result, err := t.db.ExecContext(ctx, "UPDATE user_tokens SET used_at = $2 WHERE id = $1 AND used_at = 0", id.Hex(), int64(usedAt))
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected < 1 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+type lockoutTable struct {
+	*table[models.Lockout]
+}
+
+func (t *lockoutTable) FindByKey(ctx context.Context, key string) (models.Lockout, error) {
+	return t.findOne(ctx, "key = $1", key)
+}
+
+type membershipTable struct {
+	*table[models.Membership]
+}
+
+func (t *membershipTable) FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.Membership, error) {
+	return t.find(ctx, "user_id = $1", []interface{}{userId.Hex()})
+}
+
+func (t *membershipTable) FindByOrganisation(ctx context.Context, organisationId primitive.ObjectID) ([]models.Membership, error) {
+	return t.find(ctx, "organisation_id = $1", []interface{}{organisationId.Hex()})
+}
+
+// entityFilter narrows audit entries or versions to an organisation and,
+// optionally, a kind of entity and one entity.
+func entityFilter(organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) (string, []interface{}) {
+	where := "organisation_id = $1"
+	args := []interface{}{organisationId.Hex()}
+	if entity != "" {
+		args = append(args, entity)
+		where += fmt.Sprintf(" AND entity = $%d", len(args))
+	}
+	if entityId != nil {
+		args = append(args, entityId.Hex())
+		where += fmt.Sprintf(" AND entity_id = $%d", len(args))
+	}
+	return where, args
+}
+
+type auditTable struct {
+	*table[models.AuditEntry]
+}
+
+func (t *auditTable) Find(ctx context.Context, organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) ([]models.AuditEntry, error) {
+	where, args := entityFilter(organisationId, entity, entityId)
+	return t.find(ctx, where, args)
+}
+
+type versionTable struct {
+	*table[models.Version]
+}
+
+func (t *versionTable) Find(ctx context.Context, organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) ([]models.Version, error) {
+	where, args := entityFilter(organisationId, entity, entityId)
+	return t.find(ctx, where, args)
+}
+
+type measurementTable struct {
+	*table[models.Measurement]
+}
+
+func (t *measurementTable) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Measurement, error) {
+	return t.find(ctx, "vessel_id = $1", []interface{}{vesselId.Hex()})
+}
+
+type movementTable struct {
+	*table[models.Movement]
+}
+
+func (t *movementTable) FindByBatch(ctx context.Context, batchId primitive.ObjectID) ([]models.Movement, error) {
+	return t.find(ctx, "batch_id = $1", []interface{}{batchId.Hex()})
+}
+
+func (t *movementTable) FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Movement, error) {
+	return t.find(ctx, "from_vessel_id = $1 OR to_vessel_id = $1", []interface{}{vesselId.Hex()})
+}
+
+func New(db *sql.DB) *store.Store {
+	spirits := &table[models.Spirit]{
+		db:      db,
+		name:    "spirits",
+		columns: []string{"created_at", "organisation_id", "volume", "name", "type", "initial_abv", "recipe_name", "deleted_at", "deleted_by"},
+		id:      func(s *models.Spirit) *primitive.ObjectID { return &s.Id },
+		values: func(s *models.Spirit) []interface{} {
+			return []interface{}{int64(s.CreatedAt), s.OrganisationId.Hex(), s.Volume, s.Name, s.Type, s.InitialABV, s.RecipeName, int64(s.DeletedAt), nullableHex(s.DeletedBy)}
+		},
+		fields: func(s *models.Spirit) []interface{} {
+			return []interface{}{(*int64)(&s.CreatedAt), hexID{&s.OrganisationId}, &s.Volume, &s.Name, &s.Type, &s.InitialABV, &s.RecipeName, (*int64)(&s.DeletedAt), nullHexID{&s.DeletedBy}}
+		},
+	}
+	batches := &table[models.Batch]{
+		db:      db,
+		name:    "batches",
+		columns: []string{"created_at", "organisation_id", "volume", "deleted_at", "deleted_by"},
+		id:      func(b *models.Batch) *primitive.ObjectID { return &b.Id },
+		values: func(b *models.Batch) []interface{} {
+			return []interface{}{int64(b.CreatedAt), b.OrganisationId.Hex(), b.Volume, int64(b.DeletedAt), nullableHex(b.DeletedBy)}
+		},
+		fields: func(b *models.Batch) []interface{} {
+			return []interface{}{(*int64)(&b.CreatedAt), hexID{&b.OrganisationId}, &b.Volume, (*int64)(&b.DeletedAt), nullHexID{&b.DeletedBy}}
+		},
+	}
+	vessels := &table[models.Vessel]{
+		db:      db,
+		name:    "vessels",
+		columns: []string{"created_at", "organisation_id", "volume", "material", "process", "location", "fill_level", "status", "fill_number", "prior_contents", "deleted_at", "deleted_by"},
+		id:      func(v *models.Vessel) *primitive.ObjectID { return &v.Id },
+		values: func(v *models.Vessel) []interface{} {
+			priorContents, _ := jsonValue(v.PriorContents)
+			return []interface{}{int64(v.CreatedAt), v.OrganisationId.Hex(), v.Volume, v.Material, v.Process, v.Location, v.FillLevel, v.CurrentStatus(), v.FillNumber, priorContents, int64(v.DeletedAt), nullableHex(v.DeletedBy)}
+		},
+		fields: func(v *models.Vessel) []interface{} {
+			return []interface{}{(*int64)(&v.CreatedAt), hexID{&v.OrganisationId}, &v.Volume, &v.Material, &v.Process, &v.Location, &v.FillLevel, &v.Status, &v.FillNumber, jsonColumn{&v.PriorContents}, (*int64)(&v.DeletedAt), nullHexID{&v.DeletedBy}}
+		},
+	}
+	measurements := &table[models.Measurement]{
+		db:      db,
+		name:    "measurements",
+		columns: []string{"created_at", "organisation_id", "date", "batch_id", "vessel_id", "volume", "abv", "apparent_abv", "temperature", "image", "nose", "fore_palate", "mid_palate", "finish", "notes", "descriptors", "tasting_id", "score", "deleted_at", "deleted_by"},
+		id:      func(m *models.Measurement) *primitive.ObjectID { return &m.Id },
+		values: func(m *models.Measurement) []interface{} {
+			descriptors, _ := jsonValue(m.Descriptors)
+			return []interface{}{int64(m.CreatedAt), m.OrganisationId.Hex(), int64(m.Date), nullableHex(m.BatchId), nullableHex(m.VesselId), m.Volume, m.ABV, m.ApparentABV, nullableFloat(m.Temperature), m.Image, m.Nose, m.ForePalate, m.MidPalate, m.Finish, m.Notes, descriptors, nullableHex(m.TastingId), nullableFloat(m.Score), int64(m.DeletedAt), nullableHex(m.DeletedBy)}
+		},
+		fields: func(m *models.Measurement) []interface{} {
+			return []interface{}{(*int64)(&m.CreatedAt), hexID{&m.OrganisationId}, (*int64)(&m.Date), nullHexID{&m.BatchId}, nullHexID{&m.VesselId}, &m.Volume, &m.ABV, &m.ApparentABV, nullFloat{&m.Temperature}, &m.Image, &m.Nose, &m.ForePalate, &m.MidPalate, &m.Finish, &m.Notes, jsonColumn{&m.Descriptors}, nullHexID{&m.TastingId}, nullFloat{&m.Score}, (*int64)(&m.DeletedAt), nullHexID{&m.DeletedBy}}
+		},
+	}
+	descriptors := &table[models.Descriptor]{
+		db:      db,
+		name:    "descriptors",
+		columns: []string{"created_at", "organisation_id", "parent_id", "name", "synonyms"},
+		id:      func(d *models.Descriptor) *primitive.ObjectID { return &d.Id },
+		values: func(d *models.Descriptor) []interface{} {
+			synonyms, _ := jsonValue(d.Synonyms)
+			return []interface{}{int64(d.CreatedAt), d.OrganisationId.Hex(), nullableHex(d.ParentId), d.Name, synonyms}
+		},
+		fields: func(d *models.Descriptor) []interface{} {
+			return []interface{}{(*int64)(&d.CreatedAt), hexID{&d.OrganisationId}, nullHexID{&d.ParentId}, &d.Name, jsonColumn{&d.Synonyms}}
+		},
+	}
+	tastings := &table[models.TastingSession]{
+		db:      db,
+		name:    "tastings",
+		columns: []string{"created_at", "organisation_id", "owner_id", "name", "date", "blind", "samples", "panel_ids", "scores", "closed_at", "revealed_at"},
+		id:      func(t *models.TastingSession) *primitive.ObjectID { return &t.Id },
+		values: func(t *models.TastingSession) []interface{} {
+			samples, _ := jsonValue(t.Samples)
+			panelIds, _ := jsonValue(t.PanelIds)
+			scores, _ := jsonValue(t.Scores)
+			return []interface{}{int64(t.CreatedAt), t.OrganisationId.Hex(), t.OwnerId.Hex(), t.Name, int64(t.Date), t.Blind, samples, panelIds, scores, int64(t.ClosedAt), int64(t.RevealedAt)}
+		},
+		fields: func(t *models.TastingSession) []interface{} {
+			return []interface{}{(*int64)(&t.CreatedAt), hexID{&t.OrganisationId}, hexID{&t.OwnerId}, &t.Name, (*int64)(&t.Date), &t.Blind, jsonColumn{&t.Samples}, jsonColumn{&t.PanelIds}, jsonColumn{&t.Scores}, (*int64)(&t.ClosedAt), (*int64)(&t.RevealedAt)}
+		},
+	}
+	users := &table[models.User]{
+		db:      db,
+		name:    "users",
+		columns: []string{"created_at", "email", "password", "role", "email_verified"},
+		id:      func(u *models.User) *primitive.ObjectID { return &u.Id },
+		values: func(u *models.User) []interface{} {
+			return []interface{}{int64(u.CreatedAt), u.Email, u.Password, u.CurrentRole(), u.EmailVerified}
+		},
+		fields: func(u *models.User) []interface{} {
+			return []interface{}{(*int64)(&u.CreatedAt), &u.Email, &u.Password, &u.Role, &u.EmailVerified}
+		},
+	}
+	movements := &table[models.Movement]{
+		db:      db,
+		name:    "movements",
+		columns: []string{"created_at", "organisation_id", "date", "batch_id", "type", "from_vessel_id", "to_vessel_id", "volume"},
+		id:      func(m *models.Movement) *primitive.ObjectID { return &m.Id },
+		values: func(m *models.Movement) []interface{} {
+			return []interface{}{int64(m.CreatedAt), m.OrganisationId.Hex(), int64(m.Date), m.BatchId.Hex(), m.Type, nullableHex(m.FromVesselId), nullableHex(m.ToVesselId), m.Volume}
+		},
+		fields: func(m *models.Movement) []interface{} {
+			return []interface{}{(*int64)(&m.CreatedAt), hexID{&m.OrganisationId}, (*int64)(&m.Date), hexID{&m.BatchId}, &m.Type, nullHexID{&m.FromVesselId}, nullHexID{&m.ToVesselId}, &m.Volume}
+		},
+	}
+	sessions := &table[models.Session]{
+		db:      db,
+		name:    "sessions",
+		columns: []string{"created_at", "user_id", "token_hash", "expires_at", "revoked_at", "replaced_by"},
+		id:      func(s *models.Session) *primitive.ObjectID { return &s.Id },
+		values: func(s *models.Session) []interface{} {
+			return []interface{}{int64(s.CreatedAt), s.UserId.Hex(), s.TokenHash, int64(s.ExpiresAt), int64(s.RevokedAt), nullableHex(s.ReplacedBy)}
+		},
+		fields: func(s *models.Session) []interface{} {
+			return []interface{}{(*int64)(&s.CreatedAt), hexID{&s.UserId}, &s.TokenHash, (*int64)(&s.ExpiresAt), (*int64)(&s.RevokedAt), nullHexID{&s.ReplacedBy}}
+		},
+	}
+	apiKeys := &table[models.ApiKey]{
+		db:      db,
+		name:    "api_keys",
+		columns: []string{"created_at", "user_id", "label", "prefix", "key_hash", "scopes", "expires_at", "revoked_at"},
+		id:      func(k *models.ApiKey) *primitive.ObjectID { return &k.Id },
+		values: func(k *models.ApiKey) []interface{} {
+			scopes, _ := jsonValue(k.Scopes)
+			return []interface{}{int64(k.CreatedAt), k.UserId.Hex(), k.Label, k.Prefix, k.KeyHash, scopes, int64(k.ExpiresAt), int64(k.RevokedAt)}
+		},
+		fields: func(k *models.ApiKey) []interface{} {
+			return []interface{}{(*int64)(&k.CreatedAt), hexID{&k.UserId}, &k.Label, &k.Prefix, &k.KeyHash, jsonColumn{&k.Scopes}, (*int64)(&k.ExpiresAt), (*int64)(&k.RevokedAt)}
+		},
+	}
+	userTokens := &table[models.UserToken]{
+		db:      db,
+		name:    "user_tokens",
+		columns: []string{"created_at", "user_id", "purpose", "token_hash", "expires_at", "used_at"},
+		id:      func(t *models.UserToken) *primitive.ObjectID { return &t.Id },
+		values: func(t *models.UserToken) []interface{} {
+			return []interface{}{int64(t.CreatedAt), t.UserId.Hex(), t.Purpose, t.TokenHash, int64(t.ExpiresAt), int64(t.UsedAt)}
+		},
+		fields: func(t *models.UserToken) []interface{} {
+			return []interface{}{(*int64)(&t.CreatedAt), hexID{&t.UserId}, &t.Purpose, &t.TokenHash, (*int64)(&t.ExpiresAt), (*int64)(&t.UsedAt)}
+		},
+	}
+	lockouts := &table[models.Lockout]{
+		db:      db,
+		name:    "lockouts",
+		columns: []string{"created_at", "key", "failures", "last_failure_at", "lockouts", "locked_at", "locked_until"},
+		id:      func(l *models.Lockout) *primitive.ObjectID { return &l.Id },
+		values: func(l *models.Lockout) []interface{} {
+			return []interface{}{int64(l.CreatedAt), l.Key, l.Failures, int64(l.LastFailureAt), l.Lockouts, int64(l.LockedAt), int64(l.LockedUntil)}
+		},
+		fields: func(l *models.Lockout) []interface{} {
+			return []interface{}{(*int64)(&l.CreatedAt), &l.Key, &l.Failures, (*int64)(&l.LastFailureAt), &l.Lockouts, (*int64)(&l.LockedAt), (*int64)(&l.LockedUntil)}
+		},
+	}
+	organisations := &table[models.Organisation]{
+		db:      db,
+		name:    "organisations",
+		columns: []string{"created_at", "name"},
+		id:      func(o *models.Organisation) *primitive.ObjectID { return &o.Id },
+		values: func(o *models.Organisation) []interface{} {
+			return []interface{}{int64(o.CreatedAt), o.Name}
+		},
+		fields: func(o *models.Organisation) []interface{} {
+			return []interface{}{(*int64)(&o.CreatedAt), &o.Name}
+		},
+	}
+	memberships := &table[models.Membership]{
+		db:      db,
+		name:    "memberships",
+		columns: []string{"created_at", "organisation_id", "user_id"},
+		id:      func(m *models.Membership) *primitive.ObjectID { return &m.Id },
+		values: func(m *models.Membership) []interface{} {
+			return []interface{}{int64(m.CreatedAt), m.OrganisationId.Hex(), m.UserId.Hex()}
+		},
+		fields: func(m *models.Membership) []interface{} {
+			return []interface{}{(*int64)(&m.CreatedAt), hexID{&m.OrganisationId}, hexID{&m.UserId}}
+		},
+	}
+	auditEntries := &table[models.AuditEntry]{
+		db:      db,
+		name:    "audit_entries",
+		columns: []string{"created_at", "organisation_id", "actor_id", "api_key_id", "entity", "entity_id", "operation", "changes"},
+		id:      func(e *models.AuditEntry) *primitive.ObjectID { return &e.Id },
+		values: func(e *models.AuditEntry) []interface{} {
+			changes, _ := jsonValue(e.Changes)
+			return []interface{}{int64(e.CreatedAt), e.OrganisationId.Hex(), e.ActorId.Hex(), nullableHex(e.ApiKeyId), e.Entity, e.EntityId.Hex(), e.Operation, changes}
+		},
+		fields: func(e *models.AuditEntry) []interface{} {
+			return []interface{}{(*int64)(&e.CreatedAt), hexID{&e.OrganisationId}, hexID{&e.ActorId}, nullHexID{&e.ApiKeyId}, &e.Entity, hexID{&e.EntityId}, &e.Operation, jsonColumn{&e.Changes}}
+		},
+	}
+	versions := &table[models.Version]{
+		db:      db,
+		name:    "versions",
+		columns: []string{"created_at", "organisation_id", "entity", "entity_id", "operation", "document"},
+		id:      func(v *models.Version) *primitive.ObjectID { return &v.Id },
+		values: func(v *models.Version) []interface{} {
+			return []interface{}{int64(v.CreatedAt), v.OrganisationId.Hex(), v.Entity, v.EntityId.Hex(), v.Operation, nullableJSON(v.Document)}
+		},
+		fields: func(v *models.Version) []interface{} {
+			return []interface{}{(*int64)(&v.CreatedAt), hexID{&v.OrganisationId}, &v.Entity, hexID{&v.EntityId}, &v.Operation, rawJSON{&v.Document}}
+		},
+	}
+
+	spirits.afterLoad = func(ctx context.Context, q queryer, s *models.Spirit) (err error) {
+		s.BatchIds, err = spiritBatches.ids(ctx, q, s.Id, batches.name)
+		return err
+	}
+	spirits.afterSave = func(ctx context.Context, q queryer, s *models.Spirit) error {
+		return spiritBatches.set(ctx, q, s.Id, batches.name, s.BatchIds)
+	}
+	batches.afterLoad = func(ctx context.Context, q queryer, b *models.Batch) (err error) {
+		if b.VesselIds, err = batchVessels.ids(ctx, q, b.Id, vessels.name); err != nil {
+			return err
+		}
+		b.MeasurementIds, err = batchMeasurements.ids(ctx, q, b.Id, measurements.name)
+		return err
+	}
+	batches.afterSave = func(ctx context.Context, q queryer, b *models.Batch) error {
+		if err := batchVessels.set(ctx, q, b.Id, vessels.name, b.VesselIds); err != nil {
+			return err
+		}
+		return batchMeasurements.set(ctx, q, b.Id, measurements.name, b.MeasurementIds)
+	}
+	vessels.afterLoad = func(ctx context.Context, q queryer, v *models.Vessel) (err error) {
+		if v.BatchIds, err = batchVessels.inverse().ids(ctx, q, v.Id, batches.name); err != nil {
+			return err
+		}
+		v.Treatments, err = loadTreatments(ctx, q, v.Id)
+		return err
+	}
+	vessels.afterSave = func(ctx context.Context, q queryer, v *models.Vessel) error {
+		if err := batchVessels.inverse().set(ctx, q, v.Id, batches.name, v.BatchIds); err != nil {
+			return err
+		}
+		return saveTreatments(ctx, q, v.Id, v.Treatments)
+	}
+
+	return &store.Store{
+		Spirits:       spirits,
+		Batches:       batches,
+		Vessels:       vessels,
+		Measurements:  &measurementTable{measurements},
+		Descriptors:   descriptors,
+		Tastings:      tastings,
+		Users:         &userTable{users},
+		Movements:     &movementTable{movements},
+		Sessions:      &sessionTable{sessions},
+		ApiKeys:       &apiKeyTable{apiKeys},
+		UserTokens:    &userTokenTable{userTokens},
+		Lockouts:      &lockoutTable{lockouts},
+		Organisations: organisations,
+		Memberships:   &membershipTable{memberships},
+		Audit:         &auditTable{auditEntries},
+		Versions:      &versionTable{versions},
+	}
+}
@@ -0,0 +1,390 @@
+package sqlstore
+
+import (
+	"aging-api/models"
+	"aging-api/store"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func openTestStore(t *testing.T) *store.Store {
+	db, err := Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := Migrate(context.Background(), db)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("Migrate twice: applied: %v, error: %v", applied, err)
+	}
+	return New(db)
+}
+
+// openOrganisationStore is openTestStore scoped to a new organisation, as
+// the API uses it.
+func openOrganisationStore(t *testing.T) (*store.Store, models.Organisation) {
+	s := openTestStore(t)
+	organisation := models.Organisation{Name: "Test Distillery"}
+	if err := s.Organisations.Create(context.Background(), &organisation); err != nil {
+		t.Fatal(err)
+	}
+	return s.ForOrganisation(organisation.Id), organisation
+}
+
+func TestUserEmailIsUnique(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	first := models.User{Email: "a@test.test", Password: "x"}
+	if err := s.Users.Create(ctx, &first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Id.IsZero() {
+		t.Error("Create User: id was not generated")
+	}
+
+	second := models.User{Email: "a@test.test", Password: "y"}
+	if err := s.Users.Create(ctx, &second); err != store.ErrDuplicate {
+		t.Errorf("Create duplicate User: error: %v, want: %v", err, store.ErrDuplicate)
+	}
+
+	found, err := s.Users.FindByEmail(ctx, "a@test.test")
+	if err != nil || found.Id != first.Id {
+		t.Errorf("FindByEmail: got: %v, error: %v", found.Id, err)
+	}
+}
+
+func TestUserTokenIsUsedOnce(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	user := models.User{Email: "token@test.test", Password: "x"}
+	if err := s.Users.Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	token := models.UserToken{UserId: user.Id, Purpose: models.TokenResetPassword, TokenHash: "hash", ExpiresAt: now}
+	if err := s.UserTokens.Create(ctx, &token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UserTokens.MarkUsed(ctx, token.Id, now); err != nil {
+		t.Errorf("MarkUsed: error: %v", err)
+	}
+	if err := s.UserTokens.MarkUsed(ctx, token.Id, now); err != store.ErrNotFound {
+		t.Errorf("MarkUsed twice: error: %v, want: %v", err, store.ErrNotFound)
+	}
+	if found, err := s.UserTokens.FindById(ctx, token.Id); err != nil || found.UsedAt != now {
+		t.Errorf("Find used UserToken: got: %v, error: %v", found.UsedAt, err)
+	}
+}
+
+func TestBatchRelations(t *testing.T) {
+	s, _ := openOrganisationStore(t)
+	ctx := context.Background()
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	vessel := models.Vessel{CreatedAt: now, Volume: 200, Material: "American Oak"}
+	measurement := models.Measurement{CreatedAt: now, ABV: 62.1, Image: "a.jpg"}
+	if err := s.Vessels.Create(ctx, &vessel); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Measurements.Create(ctx, &measurement); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := models.Batch{
+		CreatedAt:      now,
+		Volume:         190,
+		VesselIds:      []primitive.ObjectID{vessel.Id},
+		MeasurementIds: []primitive.ObjectID{measurement.Id},
+	}
+	if err := s.Batches.Create(ctx, &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.Batches.FindById(ctx, batch.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found.VesselIds) != 1 || found.VesselIds[0] != vessel.Id {
+		t.Errorf("Batch vessels: got: %v", found.VesselIds)
+	}
+	if len(found.MeasurementIds) != 1 || found.MeasurementIds[0] != measurement.Id {
+		t.Errorf("Batch measurements: got: %v", found.MeasurementIds)
+	}
+
+	foundVessel, err := s.Vessels.FindById(ctx, vessel.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foundVessel.BatchIds) != 1 || foundVessel.BatchIds[0] != batch.Id {
+		t.Errorf("Vessel batches: got: %v", foundVessel.BatchIds)
+	}
+
+	if err := s.Vessels.Delete(ctx, vessel.Id); err != nil {
+		t.Fatal(err)
+	}
+	found, _ = s.Batches.FindById(ctx, batch.Id)
+	if len(found.VesselIds) != 0 {
+		t.Errorf("Batch vessels after delete: got: %v", found.VesselIds)
+	}
+	if err := s.Vessels.Delete(ctx, vessel.Id); err != store.ErrNotFound {
+		t.Errorf("Delete missing Vessel: error: %v, want: %v", err, store.ErrNotFound)
+	}
+}
+
+func TestMeasurementTemperature(t *testing.T) {
+	s, _ := openOrganisationStore(t)
+	ctx := context.Background()
+
+	temperature := float32(14.5)
+	readings := []models.Measurement{
+		{ABV: 61.9, ApparentABV: 60, Temperature: &temperature, Image: "a.jpg"},
+		{ABV: 62.1, Image: "b.jpg"},
+	}
+	for i := range readings {
+		if err := s.Measurements.Create(ctx, &readings[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := s.Measurements.FindById(ctx, readings[0].Id)
+	if err != nil || found.Temperature == nil || *found.Temperature != temperature || found.ApparentABV != 60 {
+		t.Errorf("Find Measurement: got: %+v, error: %v", found, err)
+	}
+	if found, _ := s.Measurements.FindById(ctx, readings[1].Id); found.Temperature != nil {
+		t.Errorf("Find Measurement without temperature: got: %v", *found.Temperature)
+	}
+}
+
+func TestOrganisationScope(t *testing.T) {
+	s, organisation := openOrganisationStore(t)
+	ctx := context.Background()
+
+	other := models.Organisation{Name: "Rival Distillery"}
+	if err := s.Organisations.Create(ctx, &other); err != nil {
+		t.Fatal(err)
+	}
+	rival := s.ForOrganisation(other.Id)
+
+	spirit := models.Spirit{Name: "Ours", Volume: 100, InitialABV: 63.5, OrganisationId: other.Id}
+	if err := s.Spirits.Create(ctx, &spirit); err != nil {
+		t.Fatal(err)
+	}
+	if spirit.OrganisationId != organisation.Id {
+		t.Errorf("Create Spirit: organisation: %v, want: %v", spirit.OrganisationId, organisation.Id)
+	}
+
+	if _, err := rival.Spirits.FindById(ctx, spirit.Id); err != store.ErrNotFound {
+		t.Errorf("Find other organisation's Spirit: error: %v, want: %v", err, store.ErrNotFound)
+	}
+	if spirits, err := rival.Spirits.FindAll(ctx); err != nil || len(spirits) != 0 {
+		t.Errorf("Find all Spirits of other organisation: got: %v, error: %v", spirits, err)
+	}
+	if err := rival.Spirits.Update(ctx, &spirit); err != store.ErrNotFound {
+		t.Errorf("Update other organisation's Spirit: error: %v, want: %v", err, store.ErrNotFound)
+	}
+	if err := rival.Spirits.Delete(ctx, spirit.Id); err != store.ErrNotFound {
+		t.Errorf("Delete other organisation's Spirit: error: %v, want: %v", err, store.ErrNotFound)
+	}
+
+	if spirits, err := s.Spirits.FindAll(ctx); err != nil || len(spirits) != 1 {
+		t.Errorf("Find all Spirits: got: %v, error: %v", spirits, err)
+	}
+}
+
+func TestSessionLookup(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	user := models.User{Email: "a@test.test", Password: "x"}
+	if err := s.Users.Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	session := models.Session{UserId: user.Id, TokenHash: "hash", ExpiresAt: primitive.NewDateTimeFromTime(time.Now().Add(time.Hour))}
+	if err := s.Sessions.Create(ctx, &session); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.Sessions.FindByTokenHash(ctx, "hash")
+	if err != nil || found.Id != session.Id || !found.Active(time.Now()) {
+		t.Errorf("Find Session by token: got: %+v, error: %v", found, err)
+	}
+	if sessions, err := s.Sessions.FindByUser(ctx, user.Id); err != nil || len(sessions) != 1 {
+		t.Errorf("Find Sessions by user: got: %v, error: %v", sessions, err)
+	}
+	if _, err := s.Sessions.FindByTokenHash(ctx, "other"); err != store.ErrNotFound {
+		t.Errorf("Find Session by unknown token: error: %v, want: %v", err, store.ErrNotFound)
+	}
+}
+
+func TestAuditEntries(t *testing.T) {
+	s, organisation := openOrganisationStore(t)
+	ctx := context.Background()
+	actor := store.Actor{UserId: primitive.NewObjectID()}
+	logged := s.AuditedBy(actor)
+
+	batch := models.Batch{Volume: 200}
+	if err := logged.Batches.Create(ctx, &batch); err != nil {
+		t.Fatal(err)
+	}
+	batch.Volume = 190
+	if err := logged.Batches.Update(ctx, &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.Audit.Find(ctx, organisation.Id, "batch", &batch.Id)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Find entries: got: %v, error: %v", entries, err)
+	}
+	if entries[1].Operation != models.AuditUpdate || entries[1].ActorId != actor.UserId || string(entries[1].Changes["volume"].After) != "190" {
+		t.Errorf("Update entry: got: %+v", entries[1])
+	}
+	if entries, _ := s.Audit.Find(ctx, organisation.Id, "vessel", nil); len(entries) != 0 {
+		t.Errorf("Find vessel entries: got: %v", entries)
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	s, organisation := openOrganisationStore(t)
+	ctx := context.Background()
+	logged := s.AuditedBy(store.Actor{UserId: primitive.NewObjectID()})
+
+	vessel := models.Vessel{CreatedAt: primitive.NewDateTimeFromTime(time.Now()), Volume: 200, Material: "American Oak"}
+	if err := logged.Vessels.Create(ctx, &vessel); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	filled := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	vessel.FillLevel = 150
+	if err := logged.Vessels.Update(ctx, &vessel); err != nil {
+		t.Fatal(err)
+	}
+
+	past := s.AsOf(organisation.Id, filled)
+	found, err := past.Vessels.FindById(ctx, vessel.Id)
+	if err != nil || found.FillLevel != 0 || found.Material != "American Oak" {
+		t.Errorf("Vessel as of before fill: got: %+v, error: %v", found, err)
+	}
+	if vessels, err := past.Vessels.FindAll(ctx); err != nil || len(vessels) != 1 {
+		t.Errorf("Vessels as of before fill: got: %v, error: %v", vessels, err)
+	}
+	if err := past.Vessels.Update(ctx, &found); err != store.ErrReadOnly {
+		t.Errorf("Update past Vessel: error: %v, want: %v", err, store.ErrReadOnly)
+	}
+	if found, _ := s.AsOf(organisation.Id, time.Now()).Vessels.FindById(ctx, vessel.Id); found.FillLevel != 150 {
+		t.Errorf("Vessel as of now: fill level: %v", found.FillLevel)
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	base := openTestStore(t)
+	ctx := context.Background()
+	organisation := models.Organisation{Name: "Test Distillery"}
+	if err := base.Organisations.Create(ctx, &organisation); err != nil {
+		t.Fatal(err)
+	}
+	s := base.ForOrganisation(organisation.Id)
+	user := primitive.NewObjectID()
+	logged := s.AuditedBy(store.Actor{UserId: user})
+
+	old := models.Spirit{Name: "Old", Deletion: models.Deletion{DeletedAt: primitive.NewDateTimeFromTime(time.Now().AddDate(0, 0, -40)), DeletedBy: &user}}
+	recent := models.Spirit{Name: "Recent", Deletion: models.Deletion{DeletedAt: primitive.NewDateTimeFromTime(time.Now()), DeletedBy: &user}}
+	live := models.Spirit{Name: "Live"}
+	for _, spirit := range []*models.Spirit{&old, &recent, &live} {
+		if err := logged.Spirits.Create(ctx, spirit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if spirits, err := s.Spirits.FindAll(ctx); err != nil || len(spirits) != 1 || spirits[0].Id != live.Id {
+		t.Errorf("Live spirits: got: %v, error: %v", spirits, err)
+	}
+	found, err := base.DeletedIn(organisation.Id).Spirits.FindById(ctx, recent.Id)
+	if err != nil || found.DeletedBy == nil || *found.DeletedBy != user {
+		t.Errorf("Deleted spirit: got: %+v, error: %v", found, err)
+	}
+
+	purged, err := base.PurgeDeleted(ctx, primitive.NewDateTimeFromTime(time.Now().AddDate(0, 0, -30)))
+	if err != nil || purged != 1 {
+		t.Fatalf("Purge: purged: %v, error: %v", purged, err)
+	}
+	if _, err := base.Spirits.FindById(ctx, old.Id); err != store.ErrNotFound {
+		t.Errorf("Find purged spirit: error: %v, want: %v", err, store.ErrNotFound)
+	}
+	if _, err := base.Spirits.FindById(ctx, recent.Id); err != nil {
+		t.Errorf("Find recently deleted spirit: error: %v", err)
+	}
+	entries, err := base.Audit.Find(ctx, organisation.Id, "spirit", &old.Id)
+	if err != nil || len(entries) != 2 || entries[1].Operation != models.AuditPurge {
+		t.Errorf("Audit entries of purged spirit: got: %+v, error: %v", entries, err)
+	}
+}
+
+func TestDescriptorTags(t *testing.T) {
+	s, _ := openOrganisationStore(t)
+	ctx := context.Background()
+
+	woody := models.Descriptor{Name: "Woody"}
+	if err := s.Descriptors.Create(ctx, &woody); err != nil {
+		t.Fatal(err)
+	}
+	vanilla := models.Descriptor{Name: "Vanilla", ParentId: &woody.Id, Synonyms: []string{"Vanillin"}}
+	if err := s.Descriptors.Create(ctx, &vanilla); err != nil {
+		t.Fatal(err)
+	}
+	found, err := s.Descriptors.FindById(ctx, vanilla.Id)
+	if err != nil || found.ParentId == nil || *found.ParentId != woody.Id || len(found.Synonyms) != 1 {
+		t.Errorf("Find Descriptor: got: %+v, error: %v", found, err)
+	}
+
+	measurement := models.Measurement{ABV: 60, Image: "a.jpg", Descriptors: []models.DescriptorTag{{DescriptorId: vanilla.Id, Intensity: 3}}}
+	if err := s.Measurements.Create(ctx, &measurement); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := s.Measurements.FindById(ctx, measurement.Id); err != nil || len(found.Descriptors) != 1 || found.Descriptors[0] != measurement.Descriptors[0] {
+		t.Errorf("Find Measurement tags: got: %+v, error: %v", found.Descriptors, err)
+	}
+}
+
+func TestTastingScores(t *testing.T) {
+	s, _ := openOrganisationStore(t)
+	ctx := context.Background()
+
+	batchId := primitive.NewObjectID()
+	sample := models.TastingSample{Id: primitive.NewObjectID(), Code: "417", BatchId: &batchId}
+	taster := primitive.NewObjectID()
+	session := models.TastingSession{Name: "Spring panel", OwnerId: primitive.NewObjectID(), Blind: true, Samples: []models.TastingSample{sample}, PanelIds: []primitive.ObjectID{taster}}
+	if err := s.Tastings.Create(ctx, &session); err != nil {
+		t.Fatal(err)
+	}
+	session.Scores = append(session.Scores, models.TastingScore{SampleId: sample.Id, TasterId: taster, Score: 86.5, Notes: "Raisins"})
+	session.ClosedAt = primitive.NewDateTimeFromTime(time.Now())
+	if err := s.Tastings.Update(ctx, &session); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.Tastings.FindById(ctx, session.Id)
+	if err != nil || !found.Closed() || !found.Blind || found.OwnerId != session.OwnerId || len(found.Samples) != 1 || found.Samples[0].Code != "417" || *found.Samples[0].BatchId != batchId || len(found.PanelIds) != 1 || len(found.Scores) != 1 || found.Scores[0].Score != 86.5 {
+		t.Errorf("Find TastingSession: got: %+v, error: %v", found, err)
+	}
+
+	score := float32(85.5)
+	measurement := models.Measurement{TastingId: &session.Id, Score: &score}
+	if err := s.Measurements.Create(ctx, &measurement); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := s.Measurements.FindById(ctx, measurement.Id); err != nil || found.TastingId == nil || *found.TastingId != session.Id || found.Score == nil || *found.Score != score {
+		t.Errorf("Find Measurement of a tasting: got: %+v, error: %v", found, err)
+	}
+}
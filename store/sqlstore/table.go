@@ -0,0 +1,199 @@
+package sqlstore
+
+import (
+	"aging-api/store"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// table maps a model onto a single row. The id column is always first and is
+// handled by the table itself; values and fields cover the remaining columns
+// in the order they are listed in columns.
+type table[T any] struct {
+	db      *sql.DB
+	name    string
+	columns []string
+	id      func(*T) *primitive.ObjectID
+	values  func(*T) []interface{}
+	fields  func(*T) []interface{}
+
+	afterLoad func(ctx context.Context, q queryer, document *T) error
+	afterSave func(ctx context.Context, q queryer, document *T) error
+}
+
+func (t *table[T]) selectColumns(alias string) string {
+	columns := append([]string{"id"}, t.columns...)
+	if alias != "" {
+		for i := range columns {
+			columns[i] = alias + "." + columns[i]
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+func (t *table[T]) scan(row interface{ Scan(...interface{}) error }) (T, error) {
+	var document T
+	dest := append([]interface{}{hexID{t.id(&document)}}, t.fields(&document)...)
+	err := row.Scan(dest...)
+	return document, err
+}
+
+func (t *table[T]) Create(ctx context.Context, document *T) error {
+	if t.id(document).IsZero() {
+		*t.id(document) = primitive.NewObjectID()
+	}
+
+	placeholders := make([]string, len(t.columns)+1)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.name, t.selectColumns(""), strings.Join(placeholders, ", "))
+
+	return t.inTx(ctx, func(tx *sql.Tx) error {
+		args := append([]interface{}{t.id(document).Hex()}, t.values(document)...)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return translate(err)
+		}
+		return t.save(ctx, tx, document)
+	})
+}
+
+func (t *table[T]) FindById(ctx context.Context, id primitive.ObjectID) (T, error) {
+	return t.findOne(ctx, "id = $1", id.Hex())
+}
+
+func (t *table[T]) FindAll(ctx context.Context) ([]T, error) {
+	return t.find(ctx, "", nil)
+}
+
+// FindByOrganisation is used by store.ForOrganisation for tables that have
+// an organisation_id column.
+func (t *table[T]) FindByOrganisation(ctx context.Context, organisationId primitive.ObjectID) ([]T, error) {
+	return t.find(ctx, "organisation_id = $1", []interface{}{organisationId.Hex()})
+}
+
+func (t *table[T]) Update(ctx context.Context, document *T) error {
+	assignments := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		assignments[i] = fmt.Sprintf("%s = $%d", column, i+2)
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $1", t.name, strings.Join(assignments, ", "))
+
+	return t.inTx(ctx, func(tx *sql.Tx) error {
+		args := append([]interface{}{t.id(document).Hex()}, t.values(document)...)
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return translate(err)
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if affected < 1 {
+			return store.ErrNotFound
+		}
+		return t.save(ctx, tx, document)
+	})
+}
+
+func (t *table[T]) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := t.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = $1", t.name), id.Hex())
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected < 1 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (t *table[T]) findOne(ctx context.Context, where string, args ...interface{}) (T, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", t.selectColumns(""), t.name, where)
+	document, err := t.scan(t.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return document, store.ErrNotFound
+	}
+	if err != nil {
+		return document, err
+	}
+	return document, t.load(ctx, t.db, &document)
+}
+
+func (t *table[T]) find(ctx context.Context, where string, args []interface{}) ([]T, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s", t.selectColumns(""), t.name)
+	if where != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY created_at, id"
+	return t.query(ctx, t.db, query, args...)
+}
+
+// query runs a SELECT whose columns match selectColumns and loads the
+// relations of every row it returns.
+func (t *table[T]) query(ctx context.Context, q queryer, query string, args ...interface{}) ([]T, error) {
+	results, err := t.rows(ctx, q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		if err := t.load(ctx, q, &results[i]); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (t *table[T]) rows(ctx context.Context, q queryer, query string, args ...interface{}) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]T, 0)
+	for rows.Next() {
+		document, err := t.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, document)
+	}
+	return results, rows.Err()
+}
+
+func (t *table[T]) load(ctx context.Context, q queryer, document *T) error {
+	if t.afterLoad == nil {
+		return nil
+	}
+	return t.afterLoad(ctx, q, document)
+}
+
+func (t *table[T]) save(ctx context.Context, q queryer, document *T) error {
+	if t.afterSave == nil {
+		return nil
+	}
+	return t.afterSave(ctx, q, document)
+}
+
+func (t *table[T]) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
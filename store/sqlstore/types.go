@@ -0,0 +1,147 @@
+package sqlstore
+
+import (
+	"aging-api/store"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// hexID scans an ObjectID stored as its 24 character hex string.
+type hexID struct {
+	id *primitive.ObjectID
+}
+
+func (h hexID) Scan(src interface{}) error {
+	var hex string
+	switch value := src.(type) {
+	case string:
+		hex = value
+	case []byte:
+		hex = string(value)
+	default:
+		return fmt.Errorf("cannot scan %T into ObjectID", src)
+	}
+
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return err
+	}
+	*h.id = id
+	return nil
+}
+
+// nullHexID scans a nullable ObjectID column into a pointer.
+type nullHexID struct {
+	id **primitive.ObjectID
+}
+
+func (h nullHexID) Scan(src interface{}) error {
+	if src == nil {
+		*h.id = nil
+		return nil
+	}
+	var id primitive.ObjectID
+	if err := (hexID{&id}).Scan(src); err != nil {
+		return err
+	}
+	*h.id = &id
+	return nil
+}
+
+func nullableHex(id *primitive.ObjectID) interface{} {
+	if id == nil {
+		return nil
+	}
+	return id.Hex()
+}
+
+// nullFloat scans a nullable REAL column into a pointer.
+type nullFloat struct {
+	value **float32
+}
+
+func (f nullFloat) Scan(src interface{}) error {
+	var value sql.NullFloat64
+	if err := value.Scan(src); err != nil {
+		return err
+	}
+	*f.value = nil
+	if value.Valid {
+		v := float32(value.Float64)
+		*f.value = &v
+	}
+	return nil
+}
+
+func nullableFloat(value *float32) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// jsonColumn scans a TEXT column holding JSON into value.
+type jsonColumn struct {
+	value interface{}
+}
+
+func (j jsonColumn) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(data), j.value)
+	case []byte:
+		return json.Unmarshal(data, j.value)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T as JSON", src)
+	}
+}
+
+func jsonValue(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// rawJSON scans a nullable TEXT column holding JSON without decoding it.
+type rawJSON struct {
+	value *json.RawMessage
+}
+
+func (r rawJSON) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case string:
+		*r.value = json.RawMessage(data)
+	case []byte:
+		*r.value = append(json.RawMessage(nil), data...)
+	case nil:
+		*r.value = nil
+	default:
+		return fmt.Errorf("cannot scan %T as JSON", src)
+	}
+	return nil
+}
+
+func nullableJSON(value json.RawMessage) interface{} {
+	if value == nil {
+		return nil
+	}
+	return string(value)
+}
+
+func translate(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return store.ErrDuplicate
+	}
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return store.ErrDuplicate
+	}
+	return err
+}
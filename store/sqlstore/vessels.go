@@ -0,0 +1,44 @@
+package sqlstore
+
+import (
+	"aging-api/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func loadTreatments(ctx context.Context, q queryer, vesselId primitive.ObjectID) ([]models.Treatment, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT date, process, notes FROM vessel_treatments WHERE vessel_id = $1 ORDER BY date",
+		vesselId.Hex(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	treatments := make([]models.Treatment, 0)
+	for rows.Next() {
+		var treatment models.Treatment
+		if err := rows.Scan((*int64)(&treatment.Date), &treatment.Process, &treatment.Notes); err != nil {
+			return nil, err
+		}
+		treatments = append(treatments, treatment)
+	}
+	return treatments, rows.Err()
+}
+
+func saveTreatments(ctx context.Context, q queryer, vesselId primitive.ObjectID, treatments []models.Treatment) error {
+	if _, err := q.ExecContext(ctx, "DELETE FROM vessel_treatments WHERE vessel_id = $1", vesselId.Hex()); err != nil {
+		return err
+	}
+	for _, treatment := range treatments {
+		if _, err := q.ExecContext(ctx,
+			"INSERT INTO vessel_treatments (vessel_id, date, process, notes) VALUES ($1, $2, $3, $4)",
+			vesselId.Hex(), int64(treatment.Date), treatment.Process, treatment.Notes,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"aging-api/models"
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrNotFound = errors.New("document not found")
+var ErrDuplicate = errors.New("document already exists")
+
+type Repository[T any] interface {
+	Create(ctx context.Context, document *T) error
+	FindById(ctx context.Context, id primitive.ObjectID) (T, error)
+	FindAll(ctx context.Context) ([]T, error)
+	Update(ctx context.Context, document *T) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type SpiritRepository interface {
+	Repository[models.Spirit]
+}
+
+type BatchRepository interface {
+	Repository[models.Batch]
+}
+
+type VesselRepository interface {
+	Repository[models.Vessel]
+}
+
+type MeasurementRepository interface {
+	Repository[models.Measurement]
+	FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Measurement, error)
+}
+
+type MovementRepository interface {
+	Repository[models.Movement]
+	FindByBatch(ctx context.Context, batchId primitive.ObjectID) ([]models.Movement, error)
+	FindByVessel(ctx context.Context, vesselId primitive.ObjectID) ([]models.Movement, error)
+}
+
+type DescriptorRepository interface {
+	Repository[models.Descriptor]
+}
+
+type TastingRepository interface {
+	Repository[models.TastingSession]
+}
+
+type UserRepository interface {
+	Repository[models.User]
+	FindByEmail(ctx context.Context, email string) (models.User, error)
+}
+
+type SessionRepository interface {
+	Repository[models.Session]
+	FindByTokenHash(ctx context.Context, hash string) (models.Session, error)
+	FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.Session, error)
+}
+
+type ApiKeyRepository interface {
+	Repository[models.ApiKey]
+	FindByKeyHash(ctx context.Context, hash string) (models.ApiKey, error)
+	FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.ApiKey, error)
+}
+
+type UserTokenRepository interface {
+	Repository[models.UserToken]
+	FindByTokenHash(ctx context.Context, hash string) (models.UserToken, error)
+	// MarkUsed sets the token's UsedAt unless it is already set, in one
+	// step, and returns ErrNotFound if the token is unknown or used.
+	MarkUsed(ctx context.Context, id primitive.ObjectID, usedAt primitive.DateTime) error
+}
+
+type LockoutRepository interface {
+	Repository[models.Lockout]
+	FindByKey(ctx context.Context, key string) (models.Lockout, error)
+}
+
+type OrganisationRepository interface {
+	Repository[models.Organisation]
+}
+
+type MembershipRepository interface {
+	Repository[models.Membership]
+	FindByUser(ctx context.Context, userId primitive.ObjectID) ([]models.Membership, error)
+	FindByOrganisation(ctx context.Context, organisationId primitive.ObjectID) ([]models.Membership, error)
+}
+
+// AuditRepository is append-only: entries are never changed or removed.
+type AuditRepository interface {
+	Create(ctx context.Context, entry *models.AuditEntry) error
+	// Find lists an organisation's entries oldest first, narrowed to one
+	// kind of entity unless entity is empty and to one entity if entityId
+	// is not nil.
+	Find(ctx context.Context, organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) ([]models.AuditEntry, error)
+}
+
+// VersionRepository is append-only, like AuditRepository.
+type VersionRepository interface {
+	Create(ctx context.Context, version *models.Version) error
+	// Find lists versions oldest first, narrowed like AuditRepository.Find.
+	Find(ctx context.Context, organisationId primitive.ObjectID, entity string, entityId *primitive.ObjectID) ([]models.Version, error)
+}
+
+type Store struct {
+	Spirits       SpiritRepository
+	Batches       BatchRepository
+	Vessels       VesselRepository
+	Measurements  MeasurementRepository
+	Descriptors   DescriptorRepository
+	Tastings      TastingRepository
+	Users         UserRepository
+	Movements     MovementRepository
+	Sessions      SessionRepository
+	ApiKeys       ApiKeyRepository
+	UserTokens    UserTokenRepository
+	Lockouts      LockoutRepository
+	Organisations OrganisationRepository
+	Memberships   MembershipRepository
+	Audit         AuditRepository
+	Versions      VersionRepository
+}
@@ -0,0 +1,110 @@
+package units
+
+import "math"
+
+// ReferenceTemperature is the temperature, in °C, true ABV is quoted at.
+const ReferenceTemperature = 20
+
+// The density of water-ethanol mixtures in kg/m³, as a function of the mass
+// fraction of ethanol and the temperature, from OIML R 22 (1975), which the
+// international alcoholometric tables and the EU and TTB tables derived from
+// them are computed with.
+var (
+	densityA = [...]float64{
+		9.982012300e2, -1.929769495e2, 3.891238958e2, -1.668103923e3,
+		1.352215441e4, -8.829278388e4, 3.062874042e5, -6.138381234e5,
+		7.470172998e5, -5.478461354e5, 2.234460334e5, -3.903285426e4,
+	}
+	densityB = [...]float64{
+		-2.0618513e-1, -5.2682542e-3, 3.6130013e-5, -3.8957702e-7,
+		7.1693540e-9, -9.9739231e-11,
+	}
+	densityC = [...][]float64{
+		{
+			1.693443461530087e-1, -1.046914743455169e1, 7.196353469546523e1,
+			-7.047478054272792e2, 3.924090430035045e3, -1.210164659068747e4,
+			2.248646550400788e4, -2.605562982188164e4, 1.852373922069467e4,
+			-7.420201433430137e3, 1.285617841998974e3,
+		},
+		{
+			-1.193013005057010e-2, 2.517399633803461e-1, -2.170575700536993,
+			1.353034988843029e1, -5.029988758547014e1, 1.096355666577570e2,
+			-1.422753946421155e2, 1.080435942856230e2, -4.414153236817392e1,
+			7.442971530188783,
+		},
+		{
+			-6.802995733503803e-4, 1.876837790289664e-2, -2.002561813734156e-1,
+			1.022992966719220, -2.895696483903638, 4.810060584300675,
+			-4.672147440794683, 2.458043105903461, -5.411227621436812e-1,
+		},
+		{
+			4.075376675622027e-6, -8.763058573471110e-6, 6.515031360099368e-6,
+			-1.515784836987210e-6,
+		},
+		{
+			-2.788074354782409e-8, 1.345612883493354e-8,
+		},
+	}
+)
+
+// glassExpansion is the cubical expansion of hydrometer glass per °C the
+// tables assume.
+const glassExpansion = 25e-6
+
+// density is the OIML R 22 density of a mixture with mass fraction p of
+// ethanol at celsius.
+func density(p float64, celsius float64) float64 {
+	t := celsius - ReferenceTemperature
+	rho := 0.0
+	for k := len(densityA) - 1; k >= 0; k-- {
+		rho = rho*p + densityA[k]
+	}
+	for k := len(densityB) - 1; k >= 0; k-- {
+		rho += densityB[k] * math.Pow(t, float64(k+1))
+	}
+	for i, row := range densityC {
+		for k, c := range row {
+			rho += c * math.Pow(p, float64(k+1)) * math.Pow(t, float64(i+1))
+		}
+	}
+	return rho
+}
+
+// abvOf is the ABV at 20 °C of a mixture with mass fraction p of ethanol.
+func abvOf(p float64) float64 {
+	return 100 * p * density(p, ReferenceTemperature) / density(1, ReferenceTemperature)
+}
+
+// massFraction finds the mass fraction at which f, which must fall as the
+// mass fraction rises, comes to want.
+func massFraction(f func(p float64) float64, want float64) float64 {
+	low, high := 0.0, 1.0
+	for i := 0; i < 60; i++ {
+		middle := (low + high) / 2
+		if f(middle) > want {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return (low + high) / 2
+}
+
+// CorrectABV converts an apparent hydrometer reading taken at celsius into
+// the true ABV at 20 °C. A glass hydrometer graduated at 20 °C reads the
+// strength whose density at 20 °C matches the liquid's at celsius, allowing
+// for the glass's own expansion, so this finds that density and then the
+// strength that has it at celsius. It agrees with the international
+// alcoholometric tables wherever the OIML formula holds, -20 to 40 °C.
+func CorrectABV(apparent float64, celsius float64) float64 {
+	switch {
+	case apparent <= 0:
+		return 0
+	case apparent >= 100:
+		return 100
+	}
+	apparentFraction := massFraction(func(p float64) float64 { return -abvOf(p) }, -apparent)
+	rho := density(apparentFraction, ReferenceTemperature) / (1 + glassExpansion*(celsius-ReferenceTemperature))
+	trueFraction := massFraction(func(p float64) float64 { return density(p, celsius) }, rho)
+	return abvOf(trueFraction)
+}
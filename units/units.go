@@ -0,0 +1,70 @@
+// Package units converts the litre volumes the API stores into the units
+// regulators and buyers work in.
+package units
+
+import "fmt"
+
+type Unit string
+
+const (
+	Litres       Unit = "litres"
+	Gallons      Unit = "gallons"
+	ProofGallons Unit = "proofGallons"
+)
+
+// LitresPerGallon is the US liquid gallon.
+const LitresPerGallon = 3.785411784
+
+// Parse reads a unit from a query parameter; empty means litres.
+func Parse(value string) (Unit, error) {
+	switch Unit(value) {
+	case "":
+		return Litres, nil
+	case Litres, Gallons, ProofGallons:
+		return Unit(value), nil
+	}
+	return "", fmt.Errorf("units must be one of %s, %s or %s", Litres, Gallons, ProofGallons)
+}
+
+// AbsoluteAlcohol is the litres of absolute alcohol (LAA) in a volume of
+// spirit at the given ABV.
+func AbsoluteAlcohol(litres float64, abv float64) float64 {
+	return litres * abv / 100
+}
+
+// ToProofGallons converts litres at the given ABV to proof gallons, a US
+// gallon of spirit at 50% ABV (100 proof).
+func ToProofGallons(litres float64, abv float64) float64 {
+	return litres / LitresPerGallon * abv / 50
+}
+
+// FromLitres expresses a volume of spirit at the given ABV in unit.
+func FromLitres(litres float64, abv float64, unit Unit) float64 {
+	switch unit {
+	case Gallons:
+		return litres / LitresPerGallon
+	case ProofGallons:
+		return ToProofGallons(litres, abv)
+	}
+	return litres
+}
+
+// Content is how much spirit and alcohol something holds. Volume is in Unit;
+// LAA and ProofGallons are always given so either regime can be reported.
+type Content struct {
+	Unit         Unit    `json:"unit"`
+	Volume       float64 `json:"volume"`
+	ABV          float64 `json:"abv"`
+	LAA          float64 `json:"laa"`
+	ProofGallons float64 `json:"proofGallons"`
+}
+
+func NewContent(litres float64, abv float64, unit Unit) Content {
+	return Content{
+		Unit:         unit,
+		Volume:       FromLitres(litres, abv, unit),
+		ABV:          abv,
+		LAA:          AbsoluteAlcohol(litres, abv),
+		ProofGallons: ToProofGallons(litres, abv),
+	}
+}
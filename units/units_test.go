@@ -0,0 +1,72 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewContent(t *testing.T) {
+	content := NewContent(200, 63.5, Gallons)
+	if math.Abs(content.Volume-52.834) > 0.001 {
+		t.Errorf("Volume: got %v", content.Volume)
+	}
+	if math.Abs(content.LAA-127) > 0.001 {
+		t.Errorf("LAA: got %v", content.LAA)
+	}
+	if math.Abs(content.ProofGallons-67.099) > 0.001 {
+		t.Errorf("ProofGallons: got %v", content.ProofGallons)
+	}
+	if proof := NewContent(200, 63.5, ProofGallons); proof.Volume != proof.ProofGallons {
+		t.Errorf("Volume in proof gallons: got %v", proof.Volume)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if unit, err := Parse(""); err != nil || unit != Litres {
+		t.Errorf("Parse empty: got %v, %v", unit, err)
+	}
+	if _, err := Parse("hogsheads"); err == nil {
+		t.Error("Parse unknown unit: expected an error")
+	}
+}
+
+func TestDensity(t *testing.T) {
+	// Densities of water and of ethanol in kg/m³ from the OIML tables.
+	tests := []struct {
+		p, celsius, want float64
+	}{
+		{0, 20, 998.20},
+		{0, 10, 999.70},
+		{0, 4, 999.97},
+		{0, 30, 995.65},
+		{1, 20, 789.24},
+		{1, 10, 797.75},
+		{1, 30, 780.65},
+	}
+	for _, test := range tests {
+		if got := density(test.p, test.celsius); math.Abs(got-test.want) > 0.01 {
+			t.Errorf("density(%v, %v): got %v, want %v", test.p, test.celsius, got, test.want)
+		}
+	}
+}
+
+func TestCorrectABV(t *testing.T) {
+	// Real strengths at 20 °C from the international alcoholometric tables,
+	// which give them to 0.1% vol.
+	tests := []struct {
+		apparent, celsius, want float64
+	}{
+		{40, 20, 40},
+		{40, 10, 44.0},
+		{40, 15, 42.0},
+		{40, 25, 38.0},
+		{40, 30, 36.0},
+		{63.5, 12, 66.2},
+		{96, 10, 98.0},
+	}
+	for _, test := range tests {
+		if got := CorrectABV(test.apparent, test.celsius); math.Abs(got-test.want) > 0.05 {
+			t.Errorf("CorrectABV(%v, %v): got %v, want %v", test.apparent, test.celsius, got, test.want)
+		}
+	}
+}